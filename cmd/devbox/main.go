@@ -2,14 +2,21 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/beclab/devbox/pkg/api/server"
+	"github.com/beclab/devbox/pkg/development/command"
 	"github.com/beclab/devbox/pkg/store/db"
 	"github.com/beclab/devbox/pkg/webhook"
 
+	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"gorm.io/gorm"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -27,8 +34,23 @@ func main() {
 	}
 	opts.BindFlags(flag.CommandLine)
 
+	dbDriver := pflag.String("db-driver", "", "database driver, postgres or sqlite (default from DB_DRIVER, or postgres)")
+	dbPath := pflag.String("db", "", "sqlite database file, implies --db-driver=sqlite")
+	chartRepo := pflag.String("chart-repo", command.DefaultChartRepoURL, "url of the chartmuseum the app charts are pushed to")
+	chartRetention := pflag.Int("chart-retention", command.DefaultChartRetention, "number of chart versions of an app kept in the chart repo")
+	lintRules := pflag.String("lint-rules", "", "file of the lint rules the charts of every app are checked with")
+	templateDir := pflag.String("template-dir", "", "directory of the scaffolding templates of the team, one in each sub directory")
+	templateRepo := pflag.String("template-repo", "", "git url of a repository of scaffolding templates laid out as --template-dir")
+
 	pflag.Parse()
 
+	dbConfig := func() db.Config {
+		if *dbPath != "" {
+			return db.Config{Driver: db.DriverSqlite, DSN: *dbPath}
+		}
+		return db.ConfigFromEnv(*dbDriver)
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
 	rootCmd := &cobra.Command{
@@ -43,6 +65,17 @@ func main() {
 		Long:  `Start the DevBox server`,
 		Run: func(cmd *cobra.Command, args []string) {
 			klog.Info("DevBox starting ... ")
+			command.ChartRetention = *chartRetention
+			command.ChartRepoURL = strings.TrimRight(*chartRepo, "/")
+			command.LintRulesFile = *lintRules
+			command.TemplateDir = *templateDir
+			command.TemplateRepo = *templateRepo
+
+			cfg := dbConfig()
+			db.SetConfig(cfg)
+			if err := db.Open(); err != nil {
+				klog.Fatalf("failed to open %s database: %v", cfg.Driver, err)
+			}
 
 			dbOp := db.NewDbOperator()
 			defer func() {
@@ -56,7 +89,9 @@ func main() {
 				}
 			}()
 
-			s := server.NewServer(dbOp)
+			stores := db.NewStores(dbOp)
+			db.SetStores(stores)
+			s := server.NewServer(stores)
 
 			// err := s.Init()
 			// if err != nil {
@@ -84,7 +119,83 @@ func main() {
 		},
 	}
 
-	rootCmd.AddCommand(serverCmd, cleanCmd)
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "DevBox database migrations",
+		Long:  `Apply, roll back or list the DevBox database migrations`,
+	}
+
+	connect := func() *gorm.DB {
+		cfg := dbConfig()
+		d, err := db.Connect(cfg)
+		if err != nil {
+			klog.Fatalf("failed to open %s database: %v", cfg.Driver, err)
+		}
+		return d
+	}
+
+	migrateUpCmd := &cobra.Command{
+		Use:   "up [version]",
+		Short: "Apply pending migrations, up to version if given",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := 0
+			if len(args) > 0 {
+				v, err := strconv.Atoi(args[0])
+				if err != nil {
+					return fmt.Errorf("invalid version %q", args[0])
+				}
+				target = v
+			}
+			return db.MigrateUp(connect(), target)
+		},
+	}
+
+	migrateDownCmd := &cobra.Command{
+		Use:   "down [steps]",
+		Short: "Roll back the last applied migrations, one by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps := 1
+			if len(args) > 0 {
+				v, err := strconv.Atoi(args[0])
+				if err != nil || v < 1 {
+					return fmt.Errorf("invalid steps %q", args[0])
+				}
+				steps = v
+			}
+			return db.MigrateDown(connect(), steps)
+		},
+	}
+
+	migrateStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "List migrations and whether they are applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := db.GetMigrationStatus(connect())
+			if err != nil {
+				return err
+			}
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Version", "Name", "Applied At"})
+			for _, s := range status {
+				appliedAt := "pending"
+				if s.AppliedAt != nil {
+					appliedAt = s.AppliedAt.Format(time.RFC3339)
+				}
+				t.AppendRow(table.Row{s.Version, s.Name, appliedAt})
+			}
+			t.SetStyle(table.StyleLight)
+			t.Render()
+			return nil
+		},
+	}
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+
+	rootCmd.AddCommand(serverCmd, cleanCmd, migrateCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		klog.Fatalln(err)
@@ -2,8 +2,39 @@ package server
 
 const (
 	empty     = "empty"
-	deployed  = "deployed"
 	deploying = "deploying"
 	undeploy  = "undeploy"
 	abnormal  = "abnormal"
 )
+
+const (
+	jobPending   = "pending"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+const (
+	stepLint    = "lint"
+	stepPrepare = "prepare"
+	stepVersion = "version"
+	stepPush    = "push"
+	stepUpload  = "upload"
+	stepInstall = "install"
+)
+
+const (
+	jobInstall  = "install"
+	jobRollback = "rollback"
+)
+
+var installSteps = []string{stepLint, stepPrepare, stepVersion, stepPush, stepUpload, stepInstall}
+
+// a rollback reinstalls a chart version already in the repo, so it neither lints nor pushes
+var rollbackSteps = []string{stepPrepare, stepUpload, stepInstall}
+
+var jobSteps = map[string][]string{
+	jobInstall:  installSteps,
+	jobRollback: rollbackSteps,
+}
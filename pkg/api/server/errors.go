@@ -35,6 +35,8 @@ func errToStatus(err error) int {
 		return http.StatusNotFound
 	case os.IsExist(err), err == ErrExist:
 		return http.StatusConflict
+	case errors.Is(err, ErrExist):
+		return http.StatusConflict
 	case errors.Is(err, ErrPermissionDenied):
 		return http.StatusForbidden
 	case errors.Is(err, ErrInvalidRequestParams):
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"github.com/beclab/devbox/pkg/reconciler"
 	"github.com/beclab/devbox/pkg/services"
 
 	"github.com/beclab/devbox/pkg/store/db"
@@ -10,10 +11,12 @@ import (
 )
 
 type handlers struct {
-	db         *db.DbOperator
+	store      *db.Stores
 	kubeConfig *rest.Config
 	appOp      services.AppOp
 	chartOp    services.ChartOp
+	jobs       *jobManager
+	reconciler *reconciler.Reconciler
 }
 
 type webhooks struct {
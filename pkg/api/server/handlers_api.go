@@ -14,17 +14,16 @@ import (
 	"github.com/beclab/devbox/pkg/development/command"
 	"github.com/beclab/devbox/pkg/development/container"
 	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/middlewares"
 	"github.com/beclab/devbox/pkg/store/db"
 	"github.com/beclab/devbox/pkg/store/db/model"
 	"github.com/beclab/devbox/pkg/utils"
 	"github.com/beclab/oachecker"
 
-	"github.com/emicklei/go-restful/v3"
 	"github.com/go-resty/resty/v2"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v2"
-	"gorm.io/gorm"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
@@ -206,6 +205,8 @@ func (h *handlers) bindContainer(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Request body error: %v", err),
 		})
 	}
+	middlewares.SetAudit(ctx, "bind", map[string]interface{}{"appId": postData.AppId, "container": postData.ContainerName})
+	username := ctx.Locals("username").(string)
 	var containerId int
 	if postData.ContainerId == nil {
 		// create a new dev container
@@ -220,9 +221,10 @@ func (h *handlers) bindContainer(ctx *fiber.Ctx) error {
 		devContainer := model.DevContainers{
 			DevEnv: *postData.DevEnv,
 			Name:   postData.DevContainerName,
+			Owner:  username,
 		}
-		err = h.db.DB.Where("name = ?", devContainer.Name).First(&model.DevContainers{}).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err = h.store.Containers.GetByName(username, devContainer.Name)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			return err
 		}
 
@@ -234,7 +236,7 @@ func (h *handlers) bindContainer(ctx *fiber.Ctx) error {
 			})
 		}
 
-		err = h.db.DB.Create(&devContainer).Error
+		err = h.store.Containers.Create(&devContainer)
 		if err != nil {
 			klog.Error("exec sql error, ", err)
 			return ctx.JSON(fiber.Map{
@@ -256,9 +258,8 @@ func (h *handlers) bindContainer(ctx *fiber.Ctx) error {
 		containerId = *postData.ContainerId
 
 		// container can be bind to just one app
-		var existsContainers *model.DevAppContainers
-		err = h.db.DB.Where("container_id = ?", containerId).First(&existsContainers).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err = h.store.Containers.GetBinding(uint(containerId))
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			klog.Error("exec sql error, ", err)
 			return ctx.JSON(fiber.Map{
 				"code":    http.StatusBadRequest,
@@ -284,7 +285,7 @@ func (h *handlers) bindContainer(ctx *fiber.Ctx) error {
 		Image:         postData.Image,
 	}
 
-	err = h.db.DB.Create(&appContainer).Error
+	err = h.store.Containers.CreateAppContainer(&appContainer)
 	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
@@ -316,6 +317,7 @@ func (h *handlers) unbindContainer(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Requst body error: %v", err),
 		})
 	}
+	middlewares.SetAudit(ctx, "unbind", map[string]interface{}{"appId": postData.AppId, "container": postData.ContainerName})
 
 	appContainer := model.DevAppContainers{
 		AppID:         uint(*postData.AppId),
@@ -324,11 +326,7 @@ func (h *handlers) unbindContainer(ctx *fiber.Ctx) error {
 		ContainerName: *postData.ContainerName,
 	}
 
-	err = h.db.DB.Where("container_id = ?", appContainer.ContainerID).
-		Where("pod_selector = ?", appContainer.PodSelector).
-		Where("container_name = ?", appContainer.ContainerName).
-		Where("app_id = ?", appContainer.AppID).
-		Delete(&appContainer).Error
+	err = h.store.Containers.DeleteAppContainer(&appContainer)
 	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
@@ -352,95 +350,14 @@ func (h *handlers) listAppContainersInChart(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Application Not Found"),
 		})
 	}
-	username := ctx.Locals("username").(string)
-
-	appName := fmt.Sprintf("%s-dev", app)
-	testNamespace := fmt.Sprintf("%s-%s", appName, username)
-
-	// mock vals
-	values := make(map[string]interface{})
-	values["bfl"] = map[string]interface{}{
-		"username": "bfl-username",
-	}
-	values["user"] = map[string]interface{}{
-		"zone": "user-zone",
-	}
-	values["schedule"] = map[string]interface{}{
-		"nodeName": "node",
-	}
-	values["userspace"] = map[string]interface{}{
-		"appCache": "appcache",
-		"userData": "userspace/Home",
-	}
-	values["os"] = map[string]interface{}{
-		"appKey":    "appKey",
-		"appSecret": "appSecret",
-	}
-	values["domain"] = map[string]interface{}{}
-	values["dep"] = map[string]interface{}{}
-	values["postgres"] = map[string]interface{}{
-		"username":  "username",
-		"databases": map[string]interface{}{},
-		"password":  "password",
-	}
-	values["redis"] = map[string]interface{}{
-		"username":  "username",
-		"databases": map[string]interface{}{},
-		"password":  "password",
-	}
-	values["mongodb"] = map[string]interface{}{
-		"username":  "username",
-		"databases": map[string]interface{}{},
-		"password":  "password",
-	}
-	values["zinc"] = map[string]interface{}{
-		"username": "username",
-		"indexes":  map[string]interface{}{},
-		"password": "password",
-	}
-	values["svcs"] = map[string]interface{}{}
-	values["cluster"] = map[string]interface{}{}
-	values["GPU"] = map[string]interface{}{
-		"Type": "nvidia",
-		"Cuda": os.Getenv("CUDA_VERSION"),
-	}
-
-	values["gpu"] = "nvidia"
-
-	path := getAppPath(username, app)
-	appCfgPath := filepath.Join(path, constants.AppCfgFileName)
-	data, err := os.ReadFile(appCfgPath)
-	if err != nil {
-		klog.Error("read app cfg error, ", err, ", ", app, ", ", appCfgPath)
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Read OlaresManifest.yaml failed: %v", err),
-		})
-	}
-
-	appcfg, err := utils.GetAppConfig(username, data)
-
-	if err != nil {
-		klog.Error("parse app cfg error, ", err)
-		klog.Error(string(data))
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Parse OlaresManifest.yaml failed: %v", err),
-		})
-	}
+	owner := appOwner(ctx)
 
-	entries := make(map[string]interface{})
-	for _, e := range appcfg.Entrances {
-		entries[e.Name] = "dryrun"
-	}
-	values["domain"] = entries
-
-	manifest, err := helm.DryRun(ctx.Context(), h.kubeConfig, testNamespace, appName, getAppPath(username, app), values)
+	manifest, err := renderManifest(owner, app)
 	if err != nil {
-		klog.Errorf("failed to dry run %v", err)
+		klog.Errorf("failed to render %v", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Dry run failed: %v", err),
+			"message": fmt.Sprintf("Render failed: %v", err),
 		})
 	}
 
@@ -453,12 +370,11 @@ func (h *handlers) listAppContainersInChart(ctx *fiber.Ctx) error {
 		})
 	}
 
-	var da *model.DevApp
-	err = h.db.DB.Where("app_name = ?", app).First(&da).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	da, err := h.store.Apps.Get(owner, app)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		return err
 	}
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(err, db.ErrNotFound) {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusNotFound,
 			"message": fmt.Sprintf("app %s can not found", app),
@@ -494,17 +410,15 @@ func (h *handlers) listAppContainersInChart(ctx *fiber.Ctx) error {
 			}
 		}
 
-		var dac *model.DevAppContainers
-		err = h.db.DB.Where("app_id = ?", da.ID).Where("container_name", containers[i].ContainerName).First(&dac).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		dac, err := h.store.Containers.GetAppContainer(da.ID, containers[i].ContainerName)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			return err
 		}
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			continue
 		}
-		var dc *model.DevContainers
-		err = h.db.DB.Where("id = ?", dac.ContainerID).First(&dc).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		dc, err := h.store.Containers.Get(dac.ContainerID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			return err
 		}
 		if err == nil {
@@ -642,51 +556,40 @@ func (h *handlers) cancel(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Application Not Found"),
 		})
 	}
+	owner := appOwner(ctx)
+	token := ctx.Locals("auth_token").(string)
 
-	appName := fmt.Sprintf("%s-dev", app)
-
-	token := ctx.Cookies("auth_token", "")
-	if token == "" {
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusUnauthorized,
-			"message": fmt.Sprintf("Auth token not found"),
-		})
-	}
-	username := ctx.Locals("username").(string)
-
-	url := "http://app-service.os-framework:6755/app-service/v1/apps/" + appName + "/cancel"
-	client := resty.New().SetTimeout(2 * time.Second)
-
-	resp, err := client.R().SetDebug(true).
-		SetHeader("X-Authorization", token).
-		SetHeader("Accept", "*/*").
-		SetHeader(restful.HEADER_ContentType, restful.MIME_JSON).
-		SetHeader("X-Bfl-User", username).
-		SetResult(&InstallationResponse{}).
-		Post(url)
+	middlewares.SetAudit(ctx, "cancel", nil)
+	// stop devbox's own pipeline first, the job restores the app state itself
+	jobCanceled := h.jobs.cancel(owner, app)
 
+	err := h.appOp.Cancel(ctx.Context(), owner, utils.DevName(app), token)
 	if err != nil {
-		klog.Error("cancel app error, ", err, ", ", appName)
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Cancel app failed: %v", err),
-		})
+		if !jobCanceled {
+			klog.Error("cancel app error, ", err, ", ", app)
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusBadRequest,
+				"message": fmt.Sprintf("Cancel app failed: %v", err),
+			})
+		}
+		klog.Infof("app-service has no operation of app %s to cancel, %v", app, err)
 	}
 
-	if resp.StatusCode() != http.StatusOK {
-		klog.Error("cancel app response error, ", resp.StatusCode(), ", ", string(resp.Body()), ", ", appName)
-
-		return ctx.JSON(fiber.Map{
-			"code":    resp.StatusCode(),
-			"message": string(resp.Body()),
-		})
+	if !jobCanceled {
+		h.reconciler.Untrack(owner, app)
+		err = UpdateDevAppState(owner, app, undeploy, "canceled")
+		if err != nil {
+			klog.Errorf("failed to update app=%s state to undeploy %v", app, err)
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusBadRequest,
+				"message": fmt.Sprintf("update app state err %v", err),
+			})
+		}
 	}
-	ret := resp.Result().(*InstallationResponse)
+
 	return ctx.JSON(fiber.Map{
-		"code": http.StatusOK,
-		"data": map[string]string{
-			"uid": ret.Data.UID,
-		},
+		"code":    http.StatusOK,
+		"message": "Cancel success",
 	})
 }
 
@@ -698,12 +601,12 @@ func (h *handlers) getDevContainer(ctx *fiber.Ctx) error {
 			"message": "Not a valid dev container name",
 		})
 	}
-	var dc *model.DevContainers
-	err := h.db.DB.Where("name = ?", name).First(&dc).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	username := ctx.Locals("username").(string)
+	dc, err := h.store.Containers.GetByName(username, name)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		return err
 	}
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(err, db.ErrNotFound) {
 		return ctx.JSON(fiber.Map{
 			"code": http.StatusOK,
 			"data": map[string]string{},
@@ -725,17 +628,15 @@ func (h *handlers) delDevContainer(ctx *fiber.Ctx) error {
 	}
 
 	// checkout is under binding
-
-	var dc *model.DevContainers
-	err := h.db.DB.Where("name = ?", name).First(&dc).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	username := ctx.Locals("username").(string)
+	dc, err := h.store.Containers.GetByName(username, name)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		return err
 	}
 	klog.Infof("get devcontainer %v", err)
 	if err == nil {
-		var dac *model.DevAppContainers
-		e := h.db.DB.Where("container_id = ?", dc.ID).First(&dac).Error
-		if e != nil && !errors.Is(e, gorm.ErrRecordNotFound) {
+		_, e := h.store.Containers.GetBinding(dc.ID)
+		if e != nil && !errors.Is(e, db.ErrNotFound) {
 			return ctx.JSON(fiber.Map{
 				"code":    http.StatusBadRequest,
 				"message": fmt.Sprintf("Can not delete devcontainer %s since it under binding", name),
@@ -747,7 +648,7 @@ func (h *handlers) delDevContainer(ctx *fiber.Ctx) error {
 				"message": fmt.Sprintf("Can not delete devcontainer %s since it under binding", name),
 			})
 		} else {
-			e := h.db.DB.Where("name = ?", name).Delete(&dc).Error
+			e := h.store.Containers.DeleteByName(username, name)
 			if e != nil {
 				klog.Error("delete error, ", e)
 			}
@@ -786,7 +687,8 @@ func (h *handlers) updateDevContainer(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = h.db.DB.Model(&model.DevContainers{}).Where("name = ?", name).Update("name", newName).Error
+	username := ctx.Locals("username").(string)
+	err = h.store.Containers.Rename(username, name, newName)
 	if err != nil {
 		klog.Errorf("failed to update dev container name=%s, err=%v", name, err)
 		return ctx.JSON(fiber.Map{
@@ -800,67 +702,14 @@ func (h *handlers) updateDevContainer(ctx *fiber.Ctx) error {
 	})
 }
 
-func GetAppContainersInChart(owner, app string) ([]*helm.ContainerInfo, error) {
-
-	appName := fmt.Sprintf("%s-dev", app)
-	testNamespace := fmt.Sprintf("%s-%s", appName, owner)
-
-	// mock vals
-	values := make(map[string]interface{})
-	values["bfl"] = map[string]interface{}{
-		"username": "bfl-username",
-	}
-	values["user"] = map[string]interface{}{
-		"zone": "user-zone",
-	}
-	values["schedule"] = map[string]interface{}{
-		"nodeName": "node",
-	}
-	values["userspace"] = map[string]interface{}{
-		"appCache": "appcache",
-		"userData": "userspace/Home",
-	}
-	values["os"] = map[string]interface{}{
-		"appKey":    "appKey",
-		"appSecret": "appSecret",
-	}
-	values["domain"] = map[string]interface{}{}
-	values["dep"] = map[string]interface{}{}
-	values["postgres"] = map[string]interface{}{
-		"username":  "username",
-		"databases": map[string]interface{}{},
-		"password":  "password",
-	}
-	values["redis"] = map[string]interface{}{
-		"username":  "username",
-		"databases": map[string]interface{}{},
-		"password":  "password",
-	}
-	values["mongodb"] = map[string]interface{}{
-		"username":  "username",
-		"databases": map[string]interface{}{},
-		"password":  "password",
-	}
-	values["zinc"] = map[string]interface{}{
-		"username": "username",
-		"indexes":  map[string]interface{}{},
-		"password": "password",
-	}
-	values["svcs"] = map[string]interface{}{}
-	values["cluster"] = map[string]interface{}{}
-	values["GPU"] = map[string]interface{}{
-		"Type": "nvidia",
-		"Cuda": os.Getenv("CUDA_VERSION"),
-	}
-
-	values["gpu"] = "nvidia"
-
+// dryRunValues mocks the values app-service passes to the chart of the app, so that it can be rendered.
+func dryRunValues(owner, app string) (map[string]interface{}, error) {
 	path := getAppPath(owner, app)
 	appCfgPath := filepath.Join(path, constants.AppCfgFileName)
 	data, err := os.ReadFile(appCfgPath)
 	if err != nil {
 		klog.Error("read app cfg error, ", err, ", ", app, ", ", appCfgPath)
-		return nil, err
+		return nil, fmt.Errorf("Read OlaresManifest.yaml failed: %v", err)
 	}
 
 	appcfg, err := utils.GetAppConfig(owner, data)
@@ -868,23 +717,36 @@ func GetAppContainersInChart(owner, app string) ([]*helm.ContainerInfo, error) {
 	if err != nil {
 		klog.Error("parse app cfg error, ", err)
 		klog.Error(string(data))
-		return nil, err
+		return nil, fmt.Errorf("Parse OlaresManifest.yaml failed: %v", err)
 	}
 
 	entries := make(map[string]interface{})
 	for _, e := range appcfg.Entrances {
 		entries[e.Name] = "dryrun"
 	}
-	values["domain"] = entries
-	kubeConfig, err := ctrl.GetConfig()
+	values := map[string]interface{}{
+		"domain": entries,
+		"GPU": map[string]interface{}{
+			"Cuda": os.Getenv("CUDA_VERSION"),
+		},
+	}
+	values, err = helm.FixtureValues(path, values)
 	if err != nil {
-		klog.Errorf("failed to get kube config %v", err)
+		klog.Errorf("failed to load value fixture of app=%s, err=%v", app, err)
 		return nil, err
 	}
+	return values, nil
+}
 
-	manifest, err := helm.DryRun(context.TODO(), kubeConfig, testNamespace, appName, getAppPath(owner, app), values)
+func GetAppContainersInChart(owner, app string) ([]*helm.ContainerInfo, error) {
+	manifest, err := renderManifest(owner, app)
 	if err != nil {
-		klog.Errorf("failed to parse manifest %v", err)
+		klog.Errorf("failed to render manifest %v", err)
+		return nil, err
+	}
+	kubeConfig, err := ctrl.GetConfig()
+	if err != nil {
+		klog.Errorf("failed to get kube config %v", err)
 		return nil, err
 	}
 
@@ -893,10 +755,9 @@ func GetAppContainersInChart(owner, app string) ([]*helm.ContainerInfo, error) {
 		klog.Errorf("failed to decode manifest %v", err)
 		return nil, err
 	}
-	op := db.NewDbOperator()
+	store := db.DefaultStores().Containers
 
-	var da *model.DevApp
-	err = op.DB.Where("app_name = ?", app).First(&da).Error
+	da, err := db.DefaultStores().Apps.Get(owner, app)
 	if err != nil {
 		klog.Errorf("GetAppContainersInchar: app_name:%s,err:%v", app, err)
 		return nil, err
@@ -931,17 +792,15 @@ func GetAppContainersInChart(owner, app string) ([]*helm.ContainerInfo, error) {
 			}
 		}
 
-		var dac *model.DevAppContainers
-		err = op.DB.Where("app_id = ?", da.ID).Where("container_name", containers[i].ContainerName).First(&dac).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		dac, err := store.GetAppContainer(da.ID, containers[i].ContainerName)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			return nil, err
 		}
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			continue
 		}
-		var dc *model.DevContainers
-		err = op.DB.Where("id = ?", dac.ContainerID).First(&dc).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		dc, err := store.Get(dac.ContainerID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			return nil, err
 		}
 		if err == nil {
@@ -952,8 +811,28 @@ func GetAppContainersInChart(owner, app string) ([]*helm.ContainerInfo, error) {
 	return containers, nil
 }
 
+// BindContainer binds a dev container to the container of an app and records it in the audit log.
 func BindContainer(data *BindData) error {
-	op := db.NewDbOperator()
+	err := bindDevContainer(data)
+	entry := &model.AuditLog{
+		Actor:   data.Owner,
+		Owner:   data.Owner,
+		AppName: data.AppName,
+		Action:  "bind",
+		Params:  map[string]interface{}{"container": data.ContainerName, "devContainer": data.DevContainerName},
+		Outcome: middlewares.OutcomeSucceeded,
+	}
+	if err != nil {
+		entry.Outcome, entry.Message = middlewares.OutcomeFailed, err.Error()
+	}
+	if e := db.DefaultStores().Audit.Append(entry); e != nil {
+		klog.Errorf("failed to write audit log of binding app=%s, err=%v", data.AppName, e)
+	}
+	return err
+}
+
+func bindDevContainer(data *BindData) error {
+	store := db.DefaultStores().Containers
 	var containerId int
 	if data.ContainerId == nil {
 		// create a new dev container
@@ -965,9 +844,10 @@ func BindContainer(data *BindData) error {
 		devContainer := model.DevContainers{
 			DevEnv: *data.DevEnv,
 			Name:   data.DevContainerName,
+			Owner:  data.Owner,
 		}
-		err := op.DB.Where("name = ?", devContainer.Name).First(&model.DevContainers{}).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err := store.GetByName(data.Owner, devContainer.Name)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			return err
 		}
 
@@ -975,7 +855,7 @@ func BindContainer(data *BindData) error {
 			return fmt.Errorf("devcontainer %s already exists", devContainer.Name)
 		}
 
-		err = op.DB.Create(&devContainer).Error
+		err = store.Create(&devContainer)
 		if err != nil {
 			klog.Error("exec sql error, ", err)
 			return err
@@ -991,9 +871,8 @@ func BindContainer(data *BindData) error {
 		containerId = *data.ContainerId
 
 		// container can be bind to just one app
-		var existsContainers *model.DevAppContainers
-		err := op.DB.Where("container_id = ?", containerId).First(&existsContainers).Error
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err := store.GetBinding(uint(containerId))
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
 			klog.Error("exec sql error, ", err)
 			return err
 		}
@@ -1012,7 +891,7 @@ func BindContainer(data *BindData) error {
 		Image:         data.Image,
 	}
 
-	err := op.DB.Create(&appContainer).Error
+	err := store.CreateAppContainer(&appContainer)
 	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return err
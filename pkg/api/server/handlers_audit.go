@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/store/db"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+const maxAuditPageSize = 100
+
+// listAudit returns a page of the audit log of the caller's apps and of the operations the caller did, newest first.
+func (h *handlers) listAudit(ctx *fiber.Ctx) error {
+	username := ctx.Locals("username").(string)
+	page := ctx.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	limit := ctx.QueryInt("limit", 20)
+	if limit < 1 || limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	list, total, err := h.store.Audit.List(db.AuditQuery{
+		Username: username,
+		AppName:  ctx.Query("app"),
+		Action:   ctx.Query("action"),
+		Offset:   (page - 1) * limit,
+		Limit:    limit,
+	})
+	if err != nil {
+		klog.Error("exec sql error, ", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": fiber.Map{
+			"items": list,
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
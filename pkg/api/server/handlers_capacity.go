@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/beclab/devbox/pkg/constants"
+	"github.com/beclab/devbox/pkg/development/capacity"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// checkCapacity checks the cluster can fit the app installed with the values profile,
+// from the requirements in its manifest and the pods of its rendered chart.
+func (h *handlers) checkCapacity(ctx context.Context, owner, name, profile string) (*capacity.Report, error) {
+	data, err := os.ReadFile(filepath.Join(getAppPath(owner, name), constants.AppCfgFileName))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := utils.GetAppConfig(owner, data)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("failed to read %s", constants.AppCfgFileName)
+	}
+	result, err := renderApp(owner, name, profile)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := helm.DecodeManifest(result.Manifest())
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(h.kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	devName := utils.DevName(name)
+	req := capacity.Requirements{
+		CPU:    cfg.Spec.RequiredCPU,
+		Memory: cfg.Spec.RequiredMemory,
+		Disk:   cfg.Spec.RequiredDisk,
+		GPU:    cfg.Spec.RequiredGPU,
+	}
+	return capacity.Check(ctx, client, fmt.Sprintf("%s-%s", devName, owner), req, objs)
+}
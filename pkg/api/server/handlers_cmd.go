@@ -17,8 +17,8 @@ import (
 	"time"
 
 	"github.com/beclab/devbox/pkg/development/command"
-	"github.com/beclab/devbox/pkg/development/container"
 	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/middlewares"
 	"github.com/beclab/devbox/pkg/services"
 	"github.com/beclab/devbox/pkg/store/db"
 	"github.com/beclab/devbox/pkg/store/db/model"
@@ -27,8 +27,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"github.com/kubernetes/kompose/pkg/kobject"
-	"gorm.io/gorm"
-	"helm.sh/helm/v3/pkg/storage/driver"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -41,8 +39,7 @@ var regxPattern = "^[a-zA-Z][a-zA-Z0-9 ._-]{0,30}$"
 
 func (h *handlers) listDevApps(ctx *fiber.Ctx) error {
 	username := ctx.Locals("username").(string)
-	list := make([]*model.DevApp, 0)
-	err := h.db.DB.Where("owner=?", username).Order("update_time desc").Find(&list).Error
+	list, err := h.store.Apps.List(username)
 	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
@@ -50,6 +47,26 @@ func (h *handlers) listDevApps(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Exec sql failed: %v", err),
 		})
 	}
+	for _, l := range list {
+		l.Role = middlewares.RoleOwner
+	}
+
+	shared, err := h.store.Apps.ListShared(username)
+	if err != nil {
+		klog.Error("exec sql error, ", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	for _, l := range shared {
+		c, err := h.store.Collaborators.Get(l.ID, username)
+		if err != nil {
+			continue
+		}
+		l.Role = c.Role
+		list = append(list, l)
+	}
 
 	appid := func(name string) string {
 		hash := md5.Sum([]byte(name + "-dev"))
@@ -141,7 +158,7 @@ func isSelectorMatch(podLabels, selector map[string]string) bool {
 }
 
 func (h *handlers) getDevApp(ctx *fiber.Ctx) error {
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	appName := ctx.Params("name")
 	if len(appName) == 0 {
 		return ctx.JSON(fiber.Map{
@@ -150,9 +167,8 @@ func (h *handlers) getDevApp(ctx *fiber.Ctx) error {
 		})
 	}
 
-	var app *model.DevApp
-	err := h.db.DB.Where("owner = ?", username).First(&app).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	app, err := h.store.Apps.Get(owner, appName)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		klog.Error("exec sql error, ")
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -160,7 +176,7 @@ func (h *handlers) getDevApp(ctx *fiber.Ctx) error {
 		})
 	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(err, db.ErrNotFound) {
 		return ctx.JSON(fiber.Map{
 			"code": http.StatusOK,
 			"data": map[string]string{},
@@ -187,7 +203,7 @@ func (h *handlers) getDevApp(ctx *fiber.Ctx) error {
 }
 
 func (h *handlers) updateDevAppRepo(ctx *fiber.Ctx) error {
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	app := make(map[string]string)
 	err := ctx.BodyParser(&app)
 	if err != nil {
@@ -207,7 +223,7 @@ func (h *handlers) updateDevAppRepo(ctx *fiber.Ctx) error {
 		})
 	}
 
-	_, err = command.UpdateRepo().WithDir(BaseDir).Run(ctx.Context(), username, name, false)
+	_, err = command.UpdateRepo().WithDir(BaseDir).Run(ctx.Context(), owner, name, false)
 	if err != nil {
 		klog.Error("command upgraderepo error, ", err, ", ", name)
 		return ctx.JSON(fiber.Map{
@@ -223,7 +239,7 @@ func (h *handlers) updateDevAppRepo(ctx *fiber.Ctx) error {
 }
 
 func (h *handlers) installDevApp(ctx *fiber.Ctx) error {
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	var err error
 	app := make(map[string]string)
 	err = ctx.BodyParser(&app)
@@ -246,141 +262,137 @@ func (h *handlers) installDevApp(ctx *fiber.Ctx) error {
 		})
 	}
 
-	devName := utils.DevName(name)
-	devNamespace := fmt.Sprintf("%s-%s", devName, username)
-
-	canOp, err := h.appOp.IsAllowedDeploy(ctx.Context(), username, devName, token)
-	if err != nil {
-		klog.Errorf("failed to check %s can deploy %v", name, err)
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": err.Error(),
-		})
+	opts := installOptions{
+		bump:    command.VersionBump{Kind: app["bump"], Label: app["label"], Version: app["version"], Changelog: app["changelog"]},
+		profile: app["profile"],
 	}
-	if !canOp {
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("app %s operation is already running", name),
-		})
-	}
-
-	defer func() {
+	if opts.profile != "" {
+		err = command.CheckValuesProfile(owner, name, opts.profile)
 		if err != nil {
-			err = UpdateDevAppState(username, name, abnormal, err.Error())
-			if err != nil {
-				klog.Errorf("update app state to abnormal err %v", err)
-			}
-		}
-	}()
-	err = UpdateDevAppState(username, name, deploying, "deploying")
-	if err != nil {
-		klog.Errorf("failed to update dev app state name=%s,err=%v", name, err)
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("update app state err %v", err),
-		})
-	}
-
-	err = command.Lint().WithDir(BaseDir).Run(context.TODO(), username, name)
-	if err != nil {
-		klog.Errorf("failed to lint app=%s, err=%v", name, err)
-		return ctx.JSON(fiber.Map{
-			"code":    http.StatusBadRequest,
-			"message": err.Error(),
-		})
-	}
-
-	var releaseNotExist bool
-
-	err = helm.GetRelease(h.kubeConfig, devNamespace, devName)
-	if err != nil {
-		if !errors.Is(err, driver.ErrReleaseNotFound) {
-			klog.Errorf("failed to get release %s %v", devName, err)
 			return ctx.JSON(fiber.Map{
 				"code":    http.StatusBadRequest,
 				"message": err.Error(),
 			})
 		}
-		releaseNotExist = true
 	}
-	if !releaseNotExist {
-		err = waitForUninstall(username, name, token)
+	// force skips the check, e.g. if the nodes are about to scale up
+	if app["force"] != "true" {
+		report, err := h.checkCapacity(ctx.Context(), owner, name, opts.profile)
 		if err != nil {
+			// the install reports what is wrong with the app, the check does not block it
+			klog.Errorf("failed to check cluster capacity for app=%s, err=%v", name, err)
+		} else if !report.Fits {
 			return ctx.JSON(fiber.Map{
 				"code":    http.StatusBadRequest,
-				"message": fmt.Sprintf("Wait for uninstall failed: %v", err),
+				"message": fmt.Sprintf("Cluster can not fit app %s: %s", name, report.Error()),
+				"data":    report,
 			})
 		}
 	}
-
-	klog.Info("preinstall, create a labeled namespace for webhook")
-	_, err = container.CreateOrUpdateDevNamespace(ctx.Context(), h.kubeConfig, username, devName)
+	opts.security, err = h.checkSecurity(owner, name, opts.profile)
 	if err != nil {
-		klog.Errorf("failed to check namespace %v", err)
+		klog.Errorf("failed to check security of app=%s, err=%v", name, err)
+	} else if !opts.security.Passed {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Check namespace failed: %v", err),
+			"message": fmt.Sprintf("Security check failed: %v", &command.LintError{Result: opts.security}),
+			"data":    opts.security,
 		})
 	}
-	version := "0.0.1"
+	return h.startInstallJob(ctx, jobInstall, owner, name, token, opts)
+}
+
+// startInstallJob starts a job installing the app in background.
+func (h *handlers) startInstallJob(ctx *fiber.Ctx, kind, owner, name, token string, opts installOptions) error {
+	devName := utils.DevName(name)
+	devNamespace := fmt.Sprintf("%s-%s", devName, owner)
 
-	klog.Infof("auto update repo, name %s", name)
-	version, err = command.UpdateRepo().WithDir(BaseDir).Run(ctx.Context(), username, name, false)
+	canOp, err := h.appOp.IsAllowedDeploy(ctx.Context(), owner, devName, token)
 	if err != nil {
-		klog.Errorf("command upgrade repo error name %s %v ", name, err)
+		klog.Errorf("failed to check %s can deploy %v", name, err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Update repo failed: %v", err),
+			"message": err.Error(),
+		})
+	}
+	if !canOp {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("app %s operation is already running", name),
 		})
 	}
 
-	isChartVersionExist, err := h.chartOp.CheckVersion(ctx.Context(), username, devName, version)
+	devApp, err := h.store.Apps.Get(owner, name)
 	if err != nil {
+		klog.Errorf("failed to get dev app %s, err=%v", name, err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("check chart veresion failed: %v", err),
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
 		})
 	}
-	if !isChartVersionExist {
-		err = h.chartOp.Upload(context.TODO(), username, devName, token, version)
+
+	if opts.version == "" {
+		opts.bump, err = h.resolveBump(ctx.Context(), owner, name, opts.bump)
 		if err != nil {
+			klog.Errorf("failed to resolve next version of app=%s, err=%v", name, err)
 			return ctx.JSON(fiber.Map{
-				"code":    http.StatusBadRequest,
-				"message": fmt.Sprintf("upload chart failed: %v", err),
+				"code":    errToStatus(err),
+				"message": err.Error(),
 			})
 		}
 	}
 
-	err = command.Install().Run(ctx.Context(), username, name, token, version)
-
+	job, err := newInstallJob(h.store, h.jobs, kind, ctx.Locals("username").(string), owner, name)
 	if err != nil {
-		klog.Error("command install error, ", err, ", ", name)
+		klog.Errorf("failed to create install job for app=%s, err=%v", name, err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("Install failed: %v", err),
+			"message": fmt.Sprintf("Create install job failed: %v", err),
+		})
+	}
+	job.job.Version = opts.version
+	jobCtx, cancel := context.WithCancel(context.Background())
+	if !h.jobs.acquire(owner, name, cancel) {
+		cancel()
+		job.finish(fmt.Errorf("app %s operation is already running", name))
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("app %s operation is already running", name),
 		})
 	}
 
-	err = UpdateDevAppState(username, name, deployed, "deployed")
+	h.reconciler.Untrack(owner, name)
+	err = UpdateDevAppState(owner, name, deploying, "deploying")
 	if err != nil {
-		klog.Errorf("failed to update app=%s state to deployed %v", name, err)
+		klog.Errorf("failed to update dev app state name=%s,err=%v", name, err)
+		h.jobs.release(owner, name)
+		job.finish(err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
-			"message": fmt.Sprintf("update app state to deployed err %v", err),
+			"message": fmt.Sprintf("update app state err %v", err),
 		})
 	}
+
+	middlewares.SetAudit(ctx, kind+".start", map[string]interface{}{"jobId": job.job.JobID, "version": opts.version, "bump": opts.bump, "profile": opts.profile})
+	go h.runInstallJob(jobCtx, job, owner, name, token, devApp.State, opts)
+
+	data := fiber.Map{
+		"namespace": devNamespace,
+		"jobId":     job.job.JobID,
+	}
+	if opts.security != nil {
+		data["security"] = opts.security
+	}
 	return ctx.JSON(fiber.Map{
-		"code": http.StatusOK,
-		"data": map[string]string{
-			"namespace": devNamespace,
-		},
-		"message": "Install success",
+		"code":    http.StatusOK,
+		"data":    data,
+		"message": "Install started",
 	})
 }
 
 func (h *handlers) downloadDevAppChart(ctx *fiber.Ctx) error {
 	app := ctx.Query("app")
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	if app == "" {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -388,7 +400,24 @@ func (h *handlers) downloadDevAppChart(ctx *fiber.Ctx) error {
 		})
 	}
 
-	buf, err := command.PackageChart().WithDir(BaseDir).WithUser(username).Run(app)
+	// a download only packages the dependencies already vendored in charts/, an editor builds them
+	chart, err := helm.LoadChart(getAppPath(owner, app))
+	if err != nil {
+		klog.Errorf("failed to load app=%s chart %v", app, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Package chart Failed: %v", err),
+		})
+	}
+	err = helm.CheckDependencies(chart)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Run dependency build before downloading the chart: %v", err),
+		})
+	}
+
+	buf, err := command.PackageChart().WithDir(BaseDir).WithUser(owner).Run(app)
 	if err != nil {
 		klog.Errorf("failed to package app=%s chart %v", app, err)
 		return ctx.JSON(fiber.Map{
@@ -503,12 +532,13 @@ func (h *handlers) deleteDevApp(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Application name is empty"),
 		})
 	}
+	middlewares.SetAudit(ctx, "delete", nil)
 	username := ctx.Locals("username").(string)
 	devName := utils.DevName(name)
+	h.reconciler.Untrack(username, name)
 
-	var devApp *model.DevApp
-	err = h.db.DB.Where("owner = ?", username).Where("app_name = ?", name).First(&devApp).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	devApp, err := h.store.Apps.Get(username, name)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -516,8 +546,8 @@ func (h *handlers) deleteDevApp(ctx *fiber.Ctx) error {
 		})
 	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		klog.Error("app not found in db, ", devApp.AppName)
+	if errors.Is(err, db.ErrNotFound) {
+		klog.Error("app not found in db, ", name)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusNotFound,
 			"message": fmt.Sprintf("Application Not Found"),
@@ -525,8 +555,17 @@ func (h *handlers) deleteDevApp(ctx *fiber.Ctx) error {
 	}
 
 	// unbind app's containers
-	err = h.db.DB.Where("app_id = ?", devApp.ID).Delete(&model.DevAppContainers{}).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	err = h.store.Containers.DeleteAppContainers(devApp.ID)
+	if err != nil {
+		klog.Error("exec sql error, ", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql Failed: %v", err),
+		})
+	}
+
+	err = h.store.Collaborators.DeleteAll(devApp.ID)
+	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -535,16 +574,16 @@ func (h *handlers) deleteDevApp(ctx *fiber.Ctx) error {
 	}
 
 	klog.Infof("devApp.ID: %v", devApp.ID)
-	err = h.db.DB.Where("id = ?", devApp.ID).Delete(&model.DevApp{}).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	err = h.store.Apps.Delete(devApp.ID)
+	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
 			"message": fmt.Sprintf("Exec sql Failed: %v", err),
 		})
 	}
-	err = h.db.DB.Where("name = ?", devApp.AppName).Delete(&model.DevContainers{}).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	err = h.store.Containers.DeleteByName(username, devApp.AppName)
+	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -562,10 +601,20 @@ func (h *handlers) deleteDevApp(ctx *fiber.Ctx) error {
 	}
 	token := ctx.Locals("auth_token").(string)
 
-	// also delete chart on market chart repo
-	err = h.chartOp.Delete(context.TODO(), username, devName, token, devApp.ChartVersion)
+	// also delete every chart version in chartmuseum and on market chart repo
+	err = command.DeleteChartVersions(username, name)
 	if err != nil {
-		klog.Errorf("failed to delete app %s chart in market %v", name, err)
+		klog.Errorf("failed to delete app %s charts in chartmuseum %v", name, err)
+	}
+	versions, err := h.chartOp.Versions(context.TODO(), username, devName)
+	if err != nil {
+		klog.Errorf("failed to get app %s chart versions in market %v", name, err)
+	}
+	for _, version := range versions {
+		err = h.chartOp.Delete(context.TODO(), username, devName, token, version)
+		if err != nil {
+			klog.Errorf("failed to delete app %s chart %s in market %v", name, version, err)
+		}
 	}
 
 	return ctx.JSON(fiber.Map{
@@ -583,7 +632,7 @@ func (h *handlers) uploadDevAppChart(ctx *fiber.Ctx) error {
 		})
 	}
 
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 
 	// parse incomming chart tgz/zip file
 	fileHeader, err := ctx.FormFile("chart")
@@ -610,7 +659,7 @@ func (h *handlers) uploadDevAppChart(ctx *fiber.Ctx) error {
 
 	// uncompress tgz/zip
 	untarPath := filepath.Join("/tmp", uniqueId)
-	untarPathWithName := filepath.Join(untarPath, username)
+	untarPathWithName := filepath.Join(untarPath, owner)
 	err = os.MkdirAll(untarPathWithName, 0655)
 	if err != nil {
 		return ctx.JSON(fiber.Map{
@@ -628,18 +677,19 @@ func (h *handlers) uploadDevAppChart(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = command.Lint().WithDir(untarPath).Run(context.TODO(), username, app)
+	err = command.Lint().WithDir(untarPath).Run(context.TODO(), owner, app)
 	if err != nil {
 		klog.Error("check chart error, ", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
 			"message": fmt.Sprintf("Lint Failed: %v", err),
+			"data":    command.LintResultOf(err),
 		})
 	}
 
 	// copy uploaded chart
 	klog.Infof("upload dev Chart untarPath: %s, baseDir: %s, app: %s", untarPath, BaseDir, app)
-	err = command.CopyApp().WithDir(BaseDir).Run(filepath.Join(untarPathWithName, app), filepath.Join(username, app))
+	err = command.CopyApp().WithDir(BaseDir).Run(filepath.Join(untarPathWithName, app), filepath.Join(owner, app))
 	if err != nil {
 		klog.Error("copy chart error, ", err, ", ")
 		return ctx.JSON(fiber.Map{
@@ -648,6 +698,7 @@ func (h *handlers) uploadDevAppChart(ctx *fiber.Ctx) error {
 		})
 	}
 
+	commitApp(ctx.Context(), owner, app, ctx.Locals("username").(string), "Upload chart")
 	return ctx.JSON(fiber.Map{
 		"code":    http.StatusOK,
 		"message": "Upload chart to Application success",
@@ -662,9 +713,9 @@ func (h *handlers) lintDevAppChart(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Application Not Found"),
 		})
 	}
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 
-	err := command.Lint().WithDir(BaseDir).Run(ctx.Context(), username, app)
+	result, err := h.lintApp(ctx.Context(), owner, app)
 	if err != nil {
 		klog.Errorf("failed to lint app %s, err=%v", app, err)
 		return ctx.JSON(fiber.Map{
@@ -672,15 +723,22 @@ func (h *handlers) lintDevAppChart(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Lint Failed: %v", err),
 		})
 	}
+	if !result.Passed {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Lint Failed: %v", &command.LintError{Result: result}),
+			"data":    result,
+		})
+	}
 
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
-		"data": map[string]string{"result": ""},
+		"data": result,
 	})
 }
 
 func (h *handlers) uninstall(ctx *fiber.Ctx) error {
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	name := ctx.Params("name")
 	if name == "" {
 		return ctx.JSON(fiber.Map{
@@ -689,6 +747,7 @@ func (h *handlers) uninstall(ctx *fiber.Ctx) error {
 		})
 	}
 	klog.Info("uninstall name: ", name)
+	middlewares.SetAudit(ctx, "uninstall", nil)
 	token := ctx.Cookies("auth_token")
 	if token == "" {
 		klog.Error("token is empty")
@@ -698,8 +757,8 @@ func (h *handlers) uninstall(ctx *fiber.Ctx) error {
 		})
 	}
 	devName := fmt.Sprintf("%s-%s", name, "dev")
-	//res, err := uninstall(devName, token, username)
-	res, err := h.appOp.Uninstall(ctx.Context(), username, devName, token)
+	//res, err := uninstall(devName, token, owner)
+	res, err := h.appOp.Uninstall(ctx.Context(), owner, devName, token)
 	if err != nil {
 		klog.Errorf("failed to uninstall %s, err=%v", devName, err)
 		return ctx.JSON(fiber.Map{
@@ -707,7 +766,8 @@ func (h *handlers) uninstall(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Uninstall Failed: %v", err),
 		})
 	}
-	err = UpdateDevAppState(username, name, undeploy, "undeploy")
+	h.reconciler.Untrack(owner, name)
+	err = UpdateDevAppState(owner, name, undeploy, "undeploy")
 	if err != nil {
 		klog.Errorf("update dev app state to undeploy err %v", err)
 	}
@@ -779,6 +839,7 @@ func (h *handlers) createAppByArchive(ctx *fiber.Ctx) error {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
 			"message": fmt.Sprintf("Lint failed: %v", err),
+			"data":    command.LintResultOf(err),
 		})
 	}
 	//klog.Infof("output: %s\n", output)
@@ -788,9 +849,8 @@ func (h *handlers) createAppByArchive(ctx *fiber.Ctx) error {
 	//		"message": output,
 	//	})
 	//}
-	var exists *model.DevApp
-	err = h.db.DB.Where("app_name = ?", cfg.Metadata.Name).First(&exists).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	_, err = h.store.Apps.Get(username, cfg.Metadata.Name)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		klog.Error("exec sql error, ", err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -835,7 +895,7 @@ func (h *handlers) createAppByArchive(ctx *fiber.Ctx) error {
 	//chartDir := filepath.Dir(findAppCfgFile(filepath.Join("/tmp", uniqueId)))
 	err = command.CopyApp().WithDir(BaseDir).WithUser(username).Run(filepath.Join("/tmp", uniqueId, cfg.Metadata.Name), cfg.Metadata.Name)
 	if err != nil {
-		e := h.db.DB.Where("id = ?", appID).Delete(&model.DevApp{}).Error
+		e := h.store.Apps.Delete(uint(appID))
 		if err != nil {
 			klog.Error(e)
 		}
@@ -845,6 +905,7 @@ func (h *handlers) createAppByArchive(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Copy app withdir failed: %v", err),
 		})
 	}
+	commitApp(ctx.Context(), username, cfg.Metadata.Name, username, "Import app from archive")
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]interface{}{
@@ -854,19 +915,9 @@ func (h *handlers) createAppByArchive(ctx *fiber.Ctx) error {
 }
 
 func InsertDevApp(app *model.DevApp) (appId int64, err error) {
-	op := db.NewDbOperator()
-	// if err rollback db
-	defer func() {
-		if err != nil {
-			e := op.DB.Where("owner = ?", app.Owner).Where("app_name = ?", app.AppName).Delete(&model.DevApp{}).Error
-			if e != nil {
-				klog.Warning("delete to rollback db error, ", err)
-			}
-		}
-	}()
-	var exists *model.DevApp
-	err = op.DB.Where("owner = ?", app.Owner).Where("app_name = ?", app.AppName).First(&exists).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	store := db.DefaultStores().Apps
+	_, err = store.Get(app.Owner, app.AppName)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		klog.Error("exec sql error, ", err)
 		return appId, err
 	}
@@ -875,18 +926,16 @@ func InsertDevApp(app *model.DevApp) (appId int64, err error) {
 		return appId, ErrAppIsExist
 	}
 
-	err = op.DB.Create(app).Error
-	if err != nil {
-		klog.Error("exec sql error, ", err)
-		return appId, err
+	// the unique index on owner and app name catches a concurrent insert of the same app
+	err = store.Create(app)
+	if errors.Is(err, db.ErrDuplicated) {
+		return appId, ErrAppIsExist
 	}
-
-	appId = int64(app.ID)
 	if err != nil {
-		klog.Error("get last insert id error, ", err)
+		klog.Error("exec sql error, ", err)
 		return appId, err
 	}
-	return appId, nil
+	return int64(app.ID), nil
 }
 
 func UpdateDevAppState(owner, name string, state, reason string) error {
@@ -901,17 +950,17 @@ func UpdateDevAppState(owner, name string, state, reason string) error {
 	return nil
 }
 
-func waitForUninstall(owner, name, token string) error {
+func waitForUninstall(ctx context.Context, owner, name, token string) error {
 	appOp := services.NewAppOp()
 	devName := utils.DevName(name)
 
-	_, err := appOp.Uninstall(context.TODO(), owner, devName, token)
+	_, err := appOp.Uninstall(ctx, owner, devName, token)
 	if err != nil {
 		return err
 	}
 	devNamespace := fmt.Sprintf("%s-%s", devName, owner)
 	klog.Infof("wait for uninstall: %s", devNamespace)
-	return wait.PollUntilContextTimeout(context.TODO(), time.Second, 5*time.Minute, true, func(ctx context.Context) (done bool, err error) {
+	return wait.PollUntilContextTimeout(ctx, time.Second, 5*time.Minute, true, func(ctx context.Context) (done bool, err error) {
 		if err != nil {
 			return false, err
 		}
@@ -949,14 +998,14 @@ func (h *handlers) createApp(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Bad Request: this field must conform to the pattern ^[a-zA-Z][a-zA-Z0-9 ._-]{0,29}$"),
 		})
 	}
-	err = h.db.DB.Where("owner = ?", username).Where("title = ?", app.Title).First(&model.DevApp{}).Error
+	_, err = h.store.Apps.GetByTitle(username, app.Title)
 	if err == nil {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
 			"message": fmt.Sprintf("create app failed, app ID %s already exists", appName),
 		})
 	}
-	err = h.db.DB.Where("owner = ?", username).Where("app_name = ?", appName).First(&model.DevApp{}).Error
+	_, err = h.store.Apps.Get(username, appName)
 	if err == nil {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -988,11 +1037,23 @@ func (h *handlers) createApp(ctx *fiber.Ctx) error {
 	})
 }
 
+// createFromTemplate selects the template an app is created from, the body is a
+// CreateWithOneDockerConfig if it is not set.
+type createFromTemplate struct {
+	Template string                 `json:"template"`
+	Params   map[string]interface{} `json:"params"`
+}
+
 func (h *handlers) fillApp(ctx *fiber.Ctx) error {
 	username := ctx.Locals("username").(string)
 	name := ctx.Params("name")
-	var cfg command.CreateWithOneDockerConfig
 
+	var tc createFromTemplate
+	if err := ctx.BodyParser(&tc); err == nil && tc.Template != "" {
+		return h.fillAppWithTemplate(ctx, username, name, &tc)
+	}
+
+	var cfg command.CreateWithOneDockerConfig
 	err := ctx.BodyParser(&cfg)
 	if err != nil {
 		klog.Errorf("parse create config err %v", err)
@@ -1037,6 +1098,55 @@ func (h *handlers) fillApp(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("update app err %v", err),
 		})
 	}
+	commitApp(ctx.Context(), username, cfg.Name, username, "Create app")
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": map[string]interface{}{
+			"appId": appId,
+		},
+	})
+}
+
+func (h *handlers) fillAppWithTemplate(ctx *fiber.Ctx, username, name string, tc *createFromTemplate) error {
+	app, err := h.store.Apps.Get(username, name)
+	if err != nil {
+		klog.Errorf("get app name=%s err %v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("create app err %v", err),
+		})
+	}
+	t, err := command.GetTemplate(ctx.Context(), tc.Template)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Bad Request: %v", err),
+		})
+	}
+	data := command.TemplateData{Name: name, Title: app.Title, Owner: username, Params: tc.Params}
+	err = t.Instantiate(utils.GetAppPath(username, name), data)
+	if err != nil {
+		klog.Errorf("instantiate template %s for app %s err %v", t.Name, name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("create app err %v", err),
+		})
+	}
+
+	updates := map[string]interface{}{
+		"app_type": db.CommunityApp,
+		"dev_env":  "default",
+		"state":    undeploy,
+	}
+	appId, err := utils.UpdateDevApp(username, name, updates)
+	if err != nil {
+		klog.Errorf("failed to update dev app %s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("update app err %v", err),
+		})
+	}
+	commitApp(ctx.Context(), username, name, username, "Create app from template "+t.Name)
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]interface{}{
@@ -1047,11 +1157,9 @@ func (h *handlers) fillApp(ctx *fiber.Ctx) error {
 
 func (h *handlers) appState(ctx *fiber.Ctx) error {
 	name := ctx.Params("name")
-	var app *model.DevApp
 
-	username := ctx.Locals("username").(string)
-	op := db.NewDbOperator()
-	err := op.DB.Where("owner = ?", username).Where("app_name = ?", name).First(&app).Error
+	owner := appOwner(ctx)
+	app, err := h.store.Apps.Get(owner, name)
 	if err != nil {
 		klog.Errorf("get app name=%s err %v", name, err)
 		return ctx.JSON(fiber.Map{
@@ -1109,6 +1217,7 @@ func (h *handlers) fillAppWithExample(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("update app err %v", err),
 		})
 	}
+	commitApp(ctx.Context(), username, name, username, "Create app from example")
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]interface{}{
@@ -1119,6 +1228,7 @@ func (h *handlers) fillAppWithExample(ctx *fiber.Ctx) error {
 
 type BindData struct {
 	ContainerId      *int
+	Owner            string
 	AppName          string
 	AppId            int64
 	PodSelector      string
@@ -1198,6 +1308,7 @@ func (h *handlers) fillAppWithDevContainer(ctx *fiber.Ctx) error {
 	}
 
 	bindData := &BindData{
+		Owner:            username,
 		AppId:            appId,
 		AppName:          name,
 		PodSelector:      containers[0].PodSelector,
@@ -1209,8 +1320,8 @@ func (h *handlers) fillAppWithDevContainer(ctx *fiber.Ctx) error {
 	err = BindContainer(bindData)
 	if err != nil {
 		klog.Errorf("failed to bind container app=%s,err=%v", name, err)
-		e := h.db.DB.Where("app_id = ?", appId).Delete(&model.DevAppContainers{}).Error
-		if e != nil && !errors.Is(e, gorm.ErrRecordNotFound) {
+		e := h.store.Containers.DeleteAppContainers(uint(appId))
+		if e != nil {
 			klog.Errorf("delete devAppContainer app_id=%d err %v", appId, e)
 		}
 		return ctx.JSON(fiber.Map{
@@ -1219,6 +1330,7 @@ func (h *handlers) fillAppWithDevContainer(ctx *fiber.Ctx) error {
 		})
 	}
 
+	commitApp(ctx.Context(), username, name, username, "Create app with dev container")
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]interface{}{
@@ -1240,9 +1352,10 @@ func (h *handlers) updateAppTitle(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Bad Request: %v", err),
 		})
 	}
-	err = h.db.DB.Where("owner = ?", username).Where("app_name = ?", name).First(&model.DevApp{}).Error
+	middlewares.SetAudit(ctx, "rename", map[string]interface{}{"title": app.Title})
+	_, err = h.store.Apps.Get(username, name)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, db.ErrNotFound) {
 			return ctx.JSON(fiber.Map{
 				"code":    http.StatusBadRequest,
 				"message": fmt.Sprintf("app %s is not found", name),
@@ -1290,14 +1403,14 @@ func (h *handlers) createAppFromComposeFile(ctx *fiber.Ctx) error {
 		})
 	}
 
-	err = h.db.DB.Where("owner = ?", username).Where("title = ?", cfg.Title).First(&model.DevApp{}).Error
+	_, err = h.store.Apps.GetByTitle(username, cfg.Title)
 	if err == nil {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
 			"message": fmt.Sprintf("create app failed, app ID %s already exists", appName),
 		})
 	}
-	err = h.db.DB.Where("owner = ?", username).Where("app_name = ?", appName).First(&model.DevApp{}).Error
+	_, err = h.store.Apps.Get(username, appName)
 	if err == nil {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
@@ -1434,6 +1547,7 @@ func (h *handlers) createAppFromComposeFile(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("create app err %v", err),
 		})
 	}
+	commitApp(ctx.Context(), username, appName, username, "Create app from compose file")
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]interface{}{
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/store/db"
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// appRole returns the role of username on the app of owner, it is empty if the user has no access.
+func (h *handlers) appRole(owner, app, username string) (string, error) {
+	if owner == username {
+		return middlewares.RoleOwner, nil
+	}
+	devApp, err := h.store.Apps.Get(owner, app)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	c, err := h.store.Collaborators.Get(devApp.ID, username)
+	if errors.Is(err, db.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.Role, nil
+}
+
+func (h *handlers) listCollaborators(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	app, err := h.store.Apps.Get(owner, name)
+	if err != nil {
+		klog.Errorf("failed to get app %s of %s, err=%v", name, owner, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusNotFound,
+			"message": fmt.Sprintf("app %s is not found", name),
+		})
+	}
+	list, err := h.store.Collaborators.List(app.ID)
+	if err != nil {
+		klog.Error("exec sql error, ", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": list,
+	})
+}
+
+func (h *handlers) setCollaborator(ctx *fiber.Ctx) error {
+	username := ctx.Locals("username").(string)
+	name := ctx.Params("name")
+	user := ctx.Params("user")
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	err := ctx.BodyParser(&req)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Bad Request: %v", err),
+		})
+	}
+	if !middlewares.IsCollaboratorRole(req.Role) {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("invalid role %q, must be one of viewer, editor, deployer", req.Role),
+		})
+	}
+	if user == "" || user == username {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": "the owner can not be a collaborator",
+		})
+	}
+
+	app, err := h.store.Apps.Get(username, name)
+	if err != nil {
+		klog.Errorf("failed to get app %s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusNotFound,
+			"message": fmt.Sprintf("app %s is not found", name),
+		})
+	}
+	c := &model.DevAppCollaborator{AppID: app.ID, Username: user, Role: req.Role}
+	err = h.store.Collaborators.Save(c)
+	if err != nil {
+		klog.Errorf("failed to save collaborator %s of app %s, err=%v", user, name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": c,
+	})
+}
+
+func (h *handlers) deleteCollaborator(ctx *fiber.Ctx) error {
+	username := ctx.Locals("username").(string)
+	name := ctx.Params("name")
+
+	app, err := h.store.Apps.Get(username, name)
+	if err != nil {
+		klog.Errorf("failed to get app %s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusNotFound,
+			"message": fmt.Sprintf("app %s is not found", name),
+		})
+	}
+	err = h.store.Collaborators.Delete(app.ID, ctx.Params("user"))
+	if err != nil {
+		klog.Error("exec sql error, ", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": map[string]string{},
+	})
+}
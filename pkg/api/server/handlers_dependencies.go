@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// listDependencies returns the dependencies declared in Chart.yaml of the app and
+// whether they are vendored in charts/.
+func (h *handlers) listDependencies(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	chart, err := helm.LoadChart(getAppPath(owner, name))
+	if err != nil {
+		klog.Errorf("failed to load chart of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Load chart failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": map[string]interface{}{
+			"dependencies": helm.Dependencies(chart),
+			"locked":       chart.Lock != nil,
+		},
+	})
+}
+
+// updateDependencies resolves the dependencies of the app again and rewrites Chart.lock.
+func (h *handlers) updateDependencies(ctx *fiber.Ctx) error {
+	return h.vendorDependencies(ctx, "dependency.update", "Update dependencies", helm.UpdateDependencies)
+}
+
+// buildDependencies vendors the dependencies locked in Chart.lock of the app.
+func (h *handlers) buildDependencies(ctx *fiber.Ctx) error {
+	return h.vendorDependencies(ctx, "dependency.build", "Build dependencies", helm.BuildDependencies)
+}
+
+func (h *handlers) vendorDependencies(ctx *fiber.Ctx, action, message string, vendor func(path, root string, out io.Writer) error) error {
+	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	middlewares.SetAudit(ctx, action, nil)
+
+	var out bytes.Buffer
+	err := vendor(getAppPath(owner, name), utils.GetUserBaseDir(owner), &out)
+	if err != nil {
+		klog.Errorf("failed to vendor dependencies of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("%s failed: %v", message, err),
+		})
+	}
+	commitApp(ctx.Context(), owner, name, username, message)
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": out.String(),
+	})
+}
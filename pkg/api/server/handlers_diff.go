@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/klog/v2"
+)
+
+const (
+	diffBaseRelease = "release"
+	diffBaseChart   = "chart"
+	diffBaseNone    = "none"
+)
+
+// diffInstall renders the chart in the workspace and compares it with the installed
+// release, or with the last chart version in the chart repo if the app is not installed.
+func (h *handlers) diffInstall(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	devName := utils.DevName(name)
+	devNamespace := fmt.Sprintf("%s-%s", devName, owner)
+
+	var (
+		base, baseVersion string
+		values            map[string]interface{}
+		source            = diffBaseNone
+	)
+	rel, err := helm.GetDeployedRelease(h.kubeConfig, devNamespace, devName)
+	switch {
+	case err == nil:
+		// render with the values of the release, so only changes of the chart show up
+		base, values, source = rel.Manifest, rel.Config, diffBaseRelease
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			baseVersion = rel.Chart.Metadata.Version
+		}
+	case errors.Is(err, driver.ErrReleaseNotFound):
+		values, err = dryRunValues(owner, name)
+		if err != nil {
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusBadRequest,
+				"message": err.Error(),
+			})
+		}
+		base, baseVersion, err = h.renderStoredChart(ctx, owner, name, values)
+		if err != nil {
+			klog.Errorf("failed to render stored chart of app=%s, err=%v", name, err)
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusBadRequest,
+				"message": fmt.Sprintf("Render stored chart failed: %v", err),
+			})
+		}
+		if baseVersion != "" {
+			source = diffBaseChart
+		}
+	default:
+		klog.Errorf("failed to get release %s, err=%v", devName, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Get release failed: %v", err),
+		})
+	}
+
+	chart, err := helm.LoadChart(getAppPath(owner, name))
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Load chart failed: %v", err),
+		})
+	}
+	// the chart is pushed under the dev name, render it the same way
+	chart.Metadata.Name = devName
+	manifest, err := helm.DryRunChart(ctx.Context(), h.kubeConfig, devNamespace, devName, chart, values)
+	if err != nil {
+		klog.Errorf("failed to dry run app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Dry run failed: %v", err),
+		})
+	}
+
+	diff, err := helm.DiffManifests(base, manifest)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Diff manifest failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": fiber.Map{
+			"base":        source,
+			"baseVersion": baseVersion,
+			"added":       diff.Added,
+			"removed":     diff.Removed,
+			"changed":     diff.Changed,
+		},
+	})
+}
+
+// renderStoredChart renders the last installed chart version of the app, or the
+// newest one in the chart repo, it returns an empty manifest if there is none.
+func (h *handlers) renderStoredChart(ctx *fiber.Ctx, owner, name string, values map[string]interface{}) (string, string, error) {
+	version := ""
+	if devApp, err := h.store.Apps.Get(owner, name); err == nil {
+		version = devApp.ChartVersion
+	}
+	versions, err := command.ListChartVersions(owner, name)
+	if err != nil {
+		return "", "", err
+	}
+	found := false
+	for _, v := range versions {
+		if v.Version == version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		if len(versions) == 0 {
+			return "", "", nil
+		}
+		version = versions[0].Version
+	}
+
+	data, err := command.FetchChartArchive(owner, name, version)
+	if err != nil {
+		return "", "", err
+	}
+	chart, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return "", "", err
+	}
+	devName := utils.DevName(name)
+	manifest, err := helm.DryRunChart(ctx.Context(), h.kubeConfig, fmt.Sprintf("%s-%s", devName, owner), devName, chart, values)
+	return manifest, version, err
+}
@@ -10,8 +10,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/beclab/devbox/pkg/constants"
 	"github.com/beclab/devbox/pkg/development/command"
 	"github.com/beclab/devbox/pkg/files"
+	"github.com/beclab/devbox/pkg/middlewares"
 	"github.com/beclab/devbox/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/otiai10/copy"
@@ -21,16 +23,16 @@ import (
 
 func (h *handlers) getFiles(ctx *fiber.Ctx) error {
 	path := ctx.Params("*1")
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 
-	userBaseDir := utils.GetUserBaseDir(username)
+	userBaseDir := utils.GetUserBaseDir(owner)
 	file, err := files.NewFileInfo(files.FileOptions{
 		Fs:         afero.NewBasePathFs(afero.NewOsFs(), userBaseDir),
 		Path:       path,
 		Modify:     true,
 		Expand:     true,
 		ReadHeader: true,
-		Checker:    &noCheck{},
+		Checker:    &gitDirCheck{},
 		Content:    true,
 	})
 	if err != nil {
@@ -53,6 +55,7 @@ func (h *handlers) getFiles(ctx *fiber.Ctx) error {
 func (h *handlers) saveFile(ctx *fiber.Ctx) error {
 	path := ctx.Params("*1")
 	content := ctx.Body()
+	middlewares.SetAudit(ctx, "file.save", map[string]interface{}{"path": path})
 
 	pathParts := strings.SplitN(path, "/", 2)
 	if len(pathParts) == 0 {
@@ -61,65 +64,87 @@ func (h *handlers) saveFile(ctx *fiber.Ctx) error {
 			"message": "Invalid path format",
 		})
 	}
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	appName := pathParts[0]
-	file, err := WriteFileAndLint(ctx.Context(), username, path, appName, bytes.NewReader(content), command.Lint().WithDir(BaseDir).Run)
+	if appRelPath(path) == constants.AppCfgFileName {
+		// field errors are reported before the chart is written and linted
+		result, err := command.ValidateManifest(filepath.Join(utils.GetUserBaseDir(owner), appName), content)
+		if err != nil {
+			klog.Errorf("failed to validate manifest of app=%s %v", appName, err)
+		} else if !result.Passed {
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusBadRequest,
+				"message": (&command.LintError{Result: result}).Error(),
+				"lint":    result,
+			})
+		}
+	}
+	file, result, err := WriteFileAndLint(ctx.Context(), owner, path, appName, bytes.NewReader(content), command.Lint().WithDir(BaseDir).Check)
 	if err != nil {
 		klog.Errorf("failed to write app=%s file path=%s %v", appName, path, err)
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusBadRequest,
 			"message": err.Error(),
+			"lint":    result,
 		})
 	}
+	commitApp(ctx.Context(), owner, appName, ctx.Locals("username").(string), "Update "+appRelPath(path))
 
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": file,
+		"lint": result,
 	})
 }
 
-func WriteFileAndLint(ctx context.Context, owner, originFilePath, name string, content io.Reader, lintFunc func(context.Context, string, string) error) (os.FileInfo, error) {
+// WriteFileAndLint writes the file and lints the app, the file is restored if the lint
+// finds an error. The lint result is returned along with the written file.
+func WriteFileAndLint(ctx context.Context, owner, originFilePath, name string, content io.Reader, lintFunc func(context.Context, string, string) (*command.LintResult, error)) (os.FileInfo, *command.LintResult, error) {
 	exists := PathExists("/tmp")
 	if !exists {
 		err := os.MkdirAll("/tmp", 0755)
 		if err != nil {
 			klog.Errorf("failed to mkdir dir=%s,err=%v", "/tmp", err)
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
 	tempFile, err := os.CreateTemp("/tmp", "bak-*"+filepath.Base(originFilePath))
 	if err != nil {
 		klog.Infof("failed to crate temp file %v", err)
-		return nil, fmt.Errorf("create bak temp file failed %v", tempFile)
+		return nil, nil, fmt.Errorf("create bak temp file failed %v", tempFile)
 	}
 
 	userBaseDir := utils.GetUserBaseDir(owner)
-	fullOriginFilePath := filepath.Join(userBaseDir, originFilePath)
+	fullOriginFilePath := ownerFilePath(userBaseDir, originFilePath)
 	bakContent, err := os.ReadFile(fullOriginFilePath)
 	if err != nil {
 		klog.Errorf("failed to read origin file path=%s,err=%v", originFilePath, err)
-		return nil, fmt.Errorf("read origin file %s failed %v", originFilePath, err)
+		return nil, nil, fmt.Errorf("read origin file %s failed %v", originFilePath, err)
 	}
 
 	_, err = tempFile.Write(bakContent)
 	if err != nil {
 		klog.Errorf("failed to write bak content to temp file %v", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	file, err := files.WriteFile(afero.NewBasePathFs(afero.NewOsFs(), userBaseDir), originFilePath, content)
 	if err != nil {
 		klog.Infof("failed to write file path=%s, err=%v", originFilePath, err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	if err = lintFunc(ctx, owner, name); err != nil {
+	result, err := lintFunc(ctx, owner, name)
+	if err == nil && !result.Passed {
+		err = &command.LintError{Result: result}
+	}
+	if err != nil {
 		if restoreErr := copy.Copy(tempFile.Name(), fullOriginFilePath); restoreErr != nil {
 			klog.Errorf("failed to lint and restore, path=%s,err=%v", fullOriginFilePath, restoreErr)
-			return nil, fmt.Errorf("lint failed: %v, and restore bak failed: %v", err, restoreErr)
+			return nil, result, fmt.Errorf("lint failed: %v, and restore bak failed: %v", err, restoreErr)
 		}
-		return nil, fmt.Errorf("lint failed: %v", err)
+		return nil, result, fmt.Errorf("lint failed: %w", err)
 	}
 	if _, err = os.Stat(tempFile.Name()); err == nil {
 		e := os.Remove(tempFile.Name())
@@ -128,15 +153,16 @@ func WriteFileAndLint(ctx context.Context, owner, originFilePath, name string, c
 		}
 	}
 
-	return file, nil
+	return file, result, nil
 }
 
 func (h *handlers) resourcePostHandler(ctx *fiber.Ctx) error {
 	path := ctx.Params("*1")
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	klog.Infof("resourcePostHandler: %s", path)
-	userBaseDir := utils.GetUserBaseDir(username)
-	fullPath := filepath.Join(userBaseDir, path)
+	middlewares.SetAudit(ctx, "file.create", map[string]interface{}{"path": path, "type": ctx.Query("file_type")})
+	userBaseDir := utils.GetUserBaseDir(owner)
+	fullPath := ownerFilePath(userBaseDir, path)
 
 	isDir := ctx.Query("file_type") == "dir"
 	if isDir {
@@ -173,6 +199,7 @@ func (h *handlers) resourcePostHandler(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Write file failed: %v path: %s", err, path),
 		})
 	}
+	commitApp(ctx.Context(), owner, appDir(path), ctx.Locals("username").(string), "Create "+appRelPath(path))
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": file,
@@ -181,15 +208,16 @@ func (h *handlers) resourcePostHandler(ctx *fiber.Ctx) error {
 
 func (h *handlers) resourceDeleteHandler(ctx *fiber.Ctx) error {
 	path := ctx.Params("*1")
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
+	middlewares.SetAudit(ctx, "file.delete", map[string]interface{}{"path": path})
 	if len(strings.Split(path, "/")) < 2 {
 		return ctx.JSON(fiber.Map{
 			"code":    http.StatusForbidden,
 			"message": "Permission denied",
 		})
 	}
-	userBaseDir := utils.GetUserBaseDir(username)
-	fullPath := filepath.Join(userBaseDir, path)
+	userBaseDir := utils.GetUserBaseDir(owner)
+	fullPath := ownerFilePath(userBaseDir, path)
 	_, err := os.Stat(fullPath)
 	if os.IsNotExist(err) {
 		return ctx.JSON(fiber.Map{
@@ -205,6 +233,7 @@ func (h *handlers) resourceDeleteHandler(ctx *fiber.Ctx) error {
 			"message": fmt.Sprintf("Delete file failed: %v", err),
 		})
 	}
+	commitApp(ctx.Context(), owner, appDir(path), ctx.Locals("username").(string), "Delete "+appRelPath(path))
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]string{},
@@ -213,13 +242,21 @@ func (h *handlers) resourceDeleteHandler(ctx *fiber.Ctx) error {
 
 func (h *handlers) resourcePatchHandler(ctx *fiber.Ctx) error {
 	path := ctx.Params("*1")
-	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
 	dst := ctx.Query("destination")
 	action := ctx.Query("action")
 	override := ctx.Query("override") == "true"
+	middlewares.SetAudit(ctx, "file."+action, map[string]interface{}{"src": path, "dst": dst})
 
-	userBaseDir := utils.GetUserBaseDir(username)
-	dstFullPath := filepath.Join(userBaseDir, dst)
+	// a collaborator can only move files inside the shared app
+	if owner != ctx.Locals("username").(string) && appDir(dst) != appDir(path) {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusForbidden,
+			"message": "Permission denied",
+		})
+	}
+	userBaseDir := utils.GetUserBaseDir(owner)
+	dstFullPath := ownerFilePath(userBaseDir, dst)
 	if !override {
 		if _, err := os.Stat(dstFullPath); err == nil {
 			return ctx.JSON(fiber.Map{
@@ -228,7 +265,9 @@ func (h *handlers) resourcePatchHandler(ctx *fiber.Ctx) error {
 			})
 		}
 	}
-	src := filepath.Join(userBaseDir, path)
+	src := ownerFilePath(userBaseDir, path)
+	message := fmt.Sprintf("Rename %s to %s", appRelPath(path), appRelPath(dst))
+	dstApp := appDir(dst)
 	dst = dstFullPath
 	klog.Infof("src: %s", src)
 	klog.Infof("dst: %s", dst)
@@ -240,6 +279,11 @@ func (h *handlers) resourcePatchHandler(ctx *fiber.Ctx) error {
 			"message": err.Error(),
 		})
 	}
+	username := ctx.Locals("username").(string)
+	commitApp(ctx.Context(), owner, appDir(path), username, message)
+	if dstApp != appDir(path) {
+		commitApp(ctx.Context(), owner, dstApp, username, message)
+	}
 	return ctx.JSON(fiber.Map{
 		"code": http.StatusOK,
 		"data": map[string]string{},
@@ -255,7 +299,38 @@ func patchAction(action, src, dst string) error {
 	}
 }
 
-type noCheck struct {
+// ownerFilePath joins a request path to the user base dir without leaving it.
+func ownerFilePath(userBaseDir, p string) string {
+	return filepath.Join(userBaseDir, filepath.Clean("/"+p))
+}
+
+func appDir(p string) string {
+	return strings.SplitN(strings.TrimPrefix(filepath.Clean("/"+p), "/"), "/", 2)[0]
+}
+
+// gitDirCheck hides the git directory of the apps from the file listing.
+type gitDirCheck struct {
 }
 
-func (*noCheck) Check(path string) bool { return true }
+func (*gitDirCheck) Check(path string) bool { return !inGitDir(path) }
+
+func inGitDir(p string) bool {
+	for _, e := range strings.Split(filepath.ToSlash(filepath.Clean("/"+p)), "/") {
+		if e == ".git" {
+			return true
+		}
+	}
+	return false
+}
+
+// denyGitDir rejects file requests on the git directory of an app, its hooks and
+// config are only changed by devbox.
+func denyGitDir(ctx *fiber.Ctx) error {
+	if inGitDir(ctx.Path()) || inGitDir(ctx.Query("destination")) {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusForbidden,
+			"message": "Permission denied",
+		})
+	}
+	return ctx.Next()
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/development/command"
+	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// commitApp commits the changes of the app on behalf of actor, a failure is only logged
+// since the change itself is already made.
+func commitApp(ctx context.Context, owner, app, actor, message string) {
+	dir := utils.GetAppPath(owner, app)
+	// only app charts are versioned, not any directory of the user
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err != nil {
+		return
+	}
+	hash, err := command.Git().WithDir(dir).Commit(ctx, actor, message)
+	if err != nil {
+		klog.Errorf("failed to commit app=%s of %s, err=%v", app, owner, err)
+		return
+	}
+	if hash != "" {
+		klog.Infof("commit %s app=%s of %s: %s", hash, app, owner, message)
+	}
+}
+
+// appRelPath returns a files api path relative to its app directory.
+func appRelPath(p string) string {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+func (h *handlers) gitLog(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	limit := ctx.QueryInt("limit", 50)
+	commits, err := command.Git().WithDir(utils.GetAppPath(owner, name)).Log(ctx.Context(), ctx.Query("path"), limit)
+	if err != nil {
+		klog.Errorf("failed to get git log of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Get git log failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": commits,
+	})
+}
+
+func (h *handlers) gitDiff(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	diff, err := command.Git().WithDir(utils.GetAppPath(owner, name)).
+		Diff(ctx.Context(), ctx.Query("from", "HEAD"), ctx.Query("to"), ctx.Query("path"))
+	if err != nil {
+		klog.Errorf("failed to get git diff of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Get git diff failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": diff,
+	})
+}
+
+func (h *handlers) gitRestore(ctx *fiber.Ctx) error {
+	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	var req struct {
+		Commit string `json:"commit"`
+		Path   string `json:"path"`
+	}
+	err := ctx.BodyParser(&req)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Bad Request: %v", err),
+		})
+	}
+	middlewares.SetAudit(ctx, "git.restore", map[string]interface{}{"commit": req.Commit, "path": req.Path})
+
+	hash, err := command.Git().WithDir(utils.GetAppPath(owner, name)).Restore(ctx.Context(), username, req.Commit, req.Path)
+	if err != nil {
+		klog.Errorf("failed to restore %s of app=%s to %s, err=%v", req.Path, name, req.Commit, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Restore failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": map[string]string{"commit": hash},
+	})
+}
+
+func (h *handlers) gitSetRemote(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	var req struct {
+		URL string `json:"url"`
+	}
+	err := ctx.BodyParser(&req)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Bad Request: %v", err),
+		})
+	}
+	err = command.Git().WithDir(utils.GetAppPath(owner, name)).SetRemote(ctx.Context(), req.URL)
+	if err != nil {
+		klog.Errorf("failed to set git remote of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Set remote failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": map[string]string{},
+	})
+}
+
+func (h *handlers) gitPush(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	middlewares.SetAudit(ctx, "git.push", nil)
+	output, err := command.Git().WithDir(utils.GetAppPath(owner, name)).Push(ctx.Context())
+	if err != nil {
+		klog.Errorf("failed to push app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Push failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": output,
+	})
+}
+
+func (h *handlers) gitPull(ctx *fiber.Ctx) error {
+	username := ctx.Locals("username").(string)
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	middlewares.SetAudit(ctx, "git.pull", nil)
+	output, err := command.Git().WithDir(utils.GetAppPath(owner, name)).Pull(ctx.Context(), username)
+	if err != nil {
+		klog.Errorf("failed to pull app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Pull failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": output,
+	})
+}
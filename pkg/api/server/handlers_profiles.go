@@ -0,0 +1,34 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// listValuesProfiles returns the values profiles of the app, a profile is kept in
+// values.<profile>.yaml and edited through the files api.
+func (h *handlers) listValuesProfiles(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	profiles, err := command.ValuesProfiles(owner, name)
+	if err != nil {
+		klog.Errorf("failed to list values profiles of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    errToStatus(err),
+			"message": fmt.Sprintf("List values profiles failed: %v", err),
+		})
+	}
+	list := make([]map[string]string, 0, len(profiles))
+	for _, p := range profiles {
+		list = append(list, map[string]string{"name": p, "file": command.ValuesProfileFile(p)})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": list,
+	})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/klog/v2"
+)
+
+// renderDevApp renders the templates of the app with the helm engine, without a cluster.
+func (h *handlers) renderDevApp(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	result, err := renderApp(owner, name, ctx.Query("profile"))
+	if err != nil {
+		klog.Errorf("failed to render app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Render failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": result,
+	})
+}
+
+// renderApp renders the chart of the app as it is installed, with the mocked values
+// of app-service and the values profile if it is not empty.
+func renderApp(owner, app, profile string) (*helm.RenderResult, error) {
+	values, err := dryRunValues(owner, app)
+	if err != nil {
+		return nil, err
+	}
+	chart, err := helm.LoadChart(getAppPath(owner, app))
+	if err != nil {
+		return nil, err
+	}
+	if profile != "" {
+		profileValues, err := command.ValuesProfile(owner, app, profile)
+		if err != nil {
+			return nil, err
+		}
+		chart.Values = chartutil.CoalesceTables(profileValues, chart.Values)
+	}
+	devName := utils.DevName(app)
+	chart.Metadata.Name = devName
+	return helm.RenderChart(chart, fmt.Sprintf("%s-%s", devName, owner), devName, values)
+}
+
+// renderManifest renders the chart of the app into a manifest, failing on any render error.
+func renderManifest(owner, app string) (string, error) {
+	result, err := renderApp(owner, app, "")
+	if err != nil {
+		return "", err
+	}
+	if len(result.Errors) > 0 {
+		return "", fmt.Errorf("render %s failed: %s", result.Errors[0].Template, result.Errors[0].Message)
+	}
+	return result.Manifest(), nil
+}
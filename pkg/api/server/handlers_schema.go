@@ -0,0 +1,28 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// getManifestSchema returns the JSON Schema of OlaresManifest.yaml for the editor.
+func (h *handlers) getManifestSchema(ctx *fiber.Ctx) error {
+	schema, err := command.ManifestSchema()
+	if err != nil {
+		klog.Errorf("failed to generate manifest schema %v", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusInternalServerError,
+			"message": fmt.Sprintf("Get manifest schema failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": json.RawMessage(schema),
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/store/db"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// securityAllowlist returns the allowlist the owner set on the app, it is empty for an app
+// that is not created yet.
+func (h *handlers) securityAllowlist(owner, name string) (*command.SecurityAllowlist, error) {
+	app, err := h.store.Apps.Get(owner, name)
+	if errors.Is(err, db.ErrNotFound) {
+		return &command.SecurityAllowlist{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return command.ParseSecurityAllowlist(app.SecurityAllowlist)
+}
+
+// lintApp lints the app in BaseDir along with the security checks, accepting what the
+// owner allows. A save, an upload or an install only runs the lint without them, the
+// install checks the security of the app as it is installed.
+func (h *handlers) lintApp(ctx context.Context, owner, name string) (*command.LintResult, error) {
+	allowlist, err := h.securityAllowlist(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	return command.Lint().WithDir(BaseDir).WithSecurityAllowlist(allowlist).Check(ctx, owner, name)
+}
+
+// checkSecurity analyzes the pod specs of the app rendered as it is installed with the values profile.
+func (h *handlers) checkSecurity(owner, name, profile string) (*command.LintResult, error) {
+	result, err := renderApp(owner, name, profile)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := h.securityAllowlist(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	return command.NewLintResult(command.SecurityFindings(result, allowlist)), nil
+}
+
+func (h *handlers) getSecurityAllowlist(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	allowlist, err := h.securityAllowlist(owner, name)
+	if err != nil {
+		klog.Errorf("failed to get security allowlist of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Get security allowlist failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": allowlist,
+	})
+}
+
+func (h *handlers) setSecurityAllowlist(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	var allowlist command.SecurityAllowlist
+	err := ctx.BodyParser(&allowlist)
+	if err == nil {
+		err = allowlist.Validate()
+	}
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Bad Request: %v", err),
+		})
+	}
+	middlewares.SetAudit(ctx, "security.allowlist", map[string]interface{}{"allow": allowlist.Allow})
+	_, err = h.store.Apps.Update(owner, name, map[string]interface{}{"security_allowlist": allowlist.String()})
+	if err != nil {
+		klog.Errorf("failed to set security allowlist of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Set security allowlist failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": allowlist,
+	})
+}
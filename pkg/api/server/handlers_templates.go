@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// listTemplates returns the scaffolding templates an app can be created from.
+func (h *handlers) listTemplates(ctx *fiber.Ctx) error {
+	templates, err := command.Templates(ctx.Context())
+	if err != nil {
+		klog.Errorf("failed to list templates %v", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusInternalServerError,
+			"message": fmt.Sprintf("List templates failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": templates,
+	})
+}
+
+func (h *handlers) getTemplate(ctx *fiber.Ctx) error {
+	t, err := command.GetTemplate(ctx.Context(), ctx.Params("name"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, command.ErrTemplateNotFound) {
+			code = http.StatusNotFound
+		}
+		return ctx.JSON(fiber.Map{
+			"code":    code,
+			"message": fmt.Sprintf("Get template failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": t,
+	})
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/beclab/devbox/pkg/development/command"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+type chartVersionInfo struct {
+	command.ChartVersion
+	Current bool `json:"current"`
+}
+
+// listChartVersions returns the chart versions of the app kept in the chart repo, newest first.
+func (h *handlers) listChartVersions(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	devApp, err := h.store.Apps.Get(owner, name)
+	if err != nil {
+		klog.Errorf("failed to get app %s of %s, err=%v", name, owner, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusNotFound,
+			"message": fmt.Sprintf("app %s is not found", name),
+		})
+	}
+	versions, err := command.ListChartVersions(owner, name)
+	if err != nil {
+		klog.Errorf("failed to list chart versions of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("List chart versions failed: %v", err),
+		})
+	}
+	list := make([]chartVersionInfo, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, chartVersionInfo{ChartVersion: v, Current: v.Version == devApp.ChartVersion})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": list,
+	})
+}
+
+// rollbackDevApp reinstalls a chart version kept in the chart repo.
+func (h *handlers) rollbackDevApp(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	token := ctx.Locals("auth_token").(string)
+
+	var req struct {
+		Version string `json:"version"`
+	}
+	err := ctx.BodyParser(&req)
+	if err != nil || req.Version == "" {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": "version to roll back to is required",
+		})
+	}
+
+	versions, err := command.ListChartVersions(owner, name)
+	if err != nil {
+		klog.Errorf("failed to list chart versions of app=%s, err=%v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("List chart versions failed: %v", err),
+		})
+	}
+	found := false
+	for _, v := range versions {
+		if v.Version == req.Version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusNotFound,
+			"message": fmt.Sprintf("version %s of app %s is not kept in the chart repo", req.Version, name),
+		})
+	}
+
+	return h.startInstallJob(ctx, jobRollback, owner, name, token, installOptions{version: req.Version})
+}
+
+// removeNewerMarketVersions deletes the chart versions of the app above version from the market.
+func (h *handlers) removeNewerMarketVersions(ctx context.Context, owner, name, token, version string) error {
+	target, err := semver.NewVersion(version)
+	if err != nil {
+		return err
+	}
+	devName := utils.DevName(name)
+	versions, err := h.chartOp.Versions(ctx, owner, devName)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		sv, err := semver.NewVersion(v)
+		if err != nil {
+			klog.Warningf("skip invalid chart version %s of app=%s in market, %v", v, name, err)
+			continue
+		}
+		if !sv.GreaterThan(target) {
+			continue
+		}
+		err = h.chartOp.Delete(ctx, owner, devName, token, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bumpChartVersion sets the next version and the changelog of the app before its chart is
+// downloaded or pushed, and commits them as a release.
+func (h *handlers) bumpChartVersion(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	var bump command.VersionBump
+	err := ctx.BodyParser(&bump)
+	if err != nil {
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Bad Request: %v", err),
+		})
+	}
+	bump, err = h.resolveBump(ctx.Context(), owner, name, bump)
+	if err == nil {
+		_, err = command.BumpChartVersion(owner, name, bump)
+	}
+	if err != nil {
+		klog.Errorf("failed to bump app=%s chart version %v", name, err)
+		return ctx.JSON(fiber.Map{
+			"code":    errToStatus(err),
+			"message": fmt.Sprintf("Bump chart version failed: %v", err),
+		})
+	}
+	middlewares.SetAudit(ctx, "chart.bump", map[string]interface{}{"bump": bump})
+	commitApp(ctx.Context(), owner, name, ctx.Locals("username").(string), "Release "+bump.Version)
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": bump,
+	})
+}
+
+// resolveBump pins the version bump of the next build of the app to an explicit
+// version, rejecting versions the chart repo already has.
+func (h *handlers) resolveBump(ctx context.Context, owner, name string, bump command.VersionBump) (command.VersionBump, error) {
+	chart, err := helm.LoadChart(getAppPath(owner, name))
+	if err != nil {
+		return bump, err
+	}
+	current, err := helm.GetChartVersion(chart)
+	if err != nil {
+		return bump, err
+	}
+	next, err := bump.Next(current)
+	if err != nil {
+		return bump, fmt.Errorf("%w: %v", ErrInvalidRequestParams, err)
+	}
+	exist, err := h.chartOp.CheckVersion(ctx, owner, utils.DevName(name), next.String())
+	if err != nil {
+		return bump, err
+	}
+	if exist {
+		return bump, fmt.Errorf("%w: version %s of %s", ErrExist, next, name)
+	}
+	bump.Version = next.String()
+	return bump, nil
+}
@@ -0,0 +1,532 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/beclab/devbox/pkg/development/command"
+	"github.com/beclab/devbox/pkg/development/container"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/reconciler"
+	"github.com/beclab/devbox/pkg/store/db"
+	"github.com/beclab/devbox/pkg/store/db/model"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/klog/v2"
+)
+
+// jobManager keeps track of running jobs and fans out job snapshots to watchers.
+type jobManager struct {
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc
+	watchers map[string]map[chan model.DevAppJob]struct{}
+}
+
+func newJobManager() *jobManager {
+	return &jobManager{
+		running:  make(map[string]context.CancelFunc),
+		watchers: make(map[string]map[chan model.DevAppJob]struct{}),
+	}
+}
+
+func jobKey(owner, name string) string {
+	return owner + "/" + name
+}
+
+// acquire marks the app as having a running job, it returns false if there is one already.
+func (m *jobManager) acquire(owner, name string, cancel context.CancelFunc) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.running[jobKey(owner, name)]; ok {
+		return false
+	}
+	m.running[jobKey(owner, name)] = cancel
+	return true
+}
+
+func (m *jobManager) release(owner, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cancel, ok := m.running[jobKey(owner, name)]; ok {
+		cancel()
+		delete(m.running, jobKey(owner, name))
+	}
+}
+
+// cancel stops the running job of the app, it returns false if there is none.
+func (m *jobManager) cancel(owner, name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cancel, ok := m.running[jobKey(owner, name)]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (m *jobManager) watch(jobID string) (<-chan model.DevAppJob, func()) {
+	ch := make(chan model.DevAppJob, 1)
+	m.mu.Lock()
+	if m.watchers[jobID] == nil {
+		m.watchers[jobID] = make(map[chan model.DevAppJob]struct{})
+	}
+	m.watchers[jobID][ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watchers[jobID], ch)
+		if len(m.watchers[jobID]) == 0 {
+			delete(m.watchers, jobID)
+		}
+	}
+}
+
+func (m *jobManager) publish(job model.DevAppJob) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.watchers[job.JobID] {
+		// every snapshot carries the whole job, so a slow watcher only needs the latest one
+		select {
+		case ch <- job:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- job
+		}
+	}
+}
+
+func isJobFinished(job *model.DevAppJob) bool {
+	return job.State == jobSucceeded || job.State == jobFailed || job.State == jobCanceled
+}
+
+// failInterruptedJobs marks jobs left running by a previous devbox process as failed.
+func failInterruptedJobs(store db.DevAppJobStore) error {
+	return store.UpdateStates([]string{jobPending, jobRunning}, jobFailed, "interrupted by devbox restart")
+}
+
+// trackApps tracks the apps app-service may still change again, the reconciler does not
+// keep them across restarts.
+func trackApps(store db.DevAppStore, r *reconciler.Reconciler) error {
+	apps, err := store.ListInStates(deploying, reconciler.StateInstalling, reconciler.StateRunning, reconciler.StateSuspended)
+	if err != nil {
+		return err
+	}
+	for _, a := range apps {
+		r.Track(a.Owner, a.AppName, a.State)
+	}
+	return nil
+}
+
+type installJob struct {
+	store db.DevAppJobStore
+	audit db.AuditStore
+	jobs  *jobManager
+	job   *model.DevAppJob
+	actor string
+}
+
+func newInstallJob(store *db.Stores, jobs *jobManager, kind, actor, owner, name string) (*installJob, error) {
+	steps := make([]model.DevJobStep, 0, len(jobSteps[kind]))
+	for _, s := range jobSteps[kind] {
+		steps = append(steps, model.DevJobStep{Name: s, State: jobPending})
+	}
+	job := &model.DevAppJob{
+		JobID:      uuid.New().String(),
+		AppName:    name,
+		Owner:      owner,
+		Kind:       kind,
+		State:      jobPending,
+		Steps:      steps,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+	}
+	err := store.Jobs.Create(job)
+	if err != nil {
+		return nil, err
+	}
+	return &installJob{store: store.Jobs, audit: store.Audit, jobs: jobs, job: job, actor: actor}, nil
+}
+
+func (j *installJob) step(name string) *model.DevJobStep {
+	for i := range j.job.Steps {
+		if j.job.Steps[i].Name == name {
+			return &j.job.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (j *installJob) start(name string) {
+	now := time.Now()
+	if s := j.step(name); s != nil {
+		s.State = jobRunning
+		s.StartTime = &now
+	}
+	j.job.State = jobRunning
+	j.job.Step = name
+	j.save()
+}
+
+func (j *installJob) done(name, message string) {
+	now := time.Now()
+	if s := j.step(name); s != nil {
+		s.State = jobSucceeded
+		s.Message = message
+		s.EndTime = &now
+	}
+	j.save()
+}
+
+// detail sets the structured outcome of a step.
+func (j *installJob) detail(name string, detail interface{}) {
+	if s := j.step(name); s != nil {
+		s.Detail = detail
+	}
+}
+
+// finish closes the job, a non nil err fails the current step and the job.
+func (j *installJob) finish(err error) {
+	if err != nil {
+		j.stop(jobFailed, err.Error())
+		j.record(middlewares.OutcomeFailed, err.Error())
+		return
+	}
+	j.job.State = jobSucceeded
+	j.save()
+	j.record(middlewares.OutcomeSucceeded, "")
+}
+
+func (j *installJob) canceled() {
+	j.stop(jobCanceled, "canceled by user")
+	j.record(middlewares.OutcomeCanceled, "canceled by user")
+}
+
+func (j *installJob) stop(state, reason string) {
+	now := time.Now()
+	if s := j.step(j.job.Step); s != nil && s.State == jobRunning {
+		s.State = state
+		s.Message = reason
+		s.EndTime = &now
+	}
+	j.job.State = state
+	j.job.Reason = reason
+	j.save()
+}
+
+func (j *installJob) save() {
+	j.job.UpdateTime = time.Now()
+	err := j.store.Save(j.job)
+	if err != nil {
+		klog.Errorf("failed to save job %s of app=%s, err=%v", j.job.JobID, j.job.AppName, err)
+	}
+	j.jobs.publish(*j.job)
+}
+
+// record appends the outcome of the job to the audit log, the request that started it is recorded by the middleware.
+func (j *installJob) record(outcome, message string) {
+	err := j.audit.Append(&model.AuditLog{
+		Actor:   j.actor,
+		Owner:   j.job.Owner,
+		AppName: j.job.AppName,
+		Action:  j.job.Kind,
+		Params:  map[string]interface{}{"jobId": j.job.JobID, "version": j.job.Version},
+		Outcome: outcome,
+		Message: message,
+	})
+	if err != nil {
+		klog.Errorf("failed to write audit log of job %s, err=%v", j.job.JobID, err)
+	}
+}
+
+// installOptions tells an install job which chart it installs.
+type installOptions struct {
+	// version is the chart version to roll back to, a new one is built if it is empty
+	version string
+	// bump derives the version of a new build
+	bump command.VersionBump
+	// profile is the values profile merged into a new build
+	profile string
+	// security is the analysis of the pod specs, returned when the job starts
+	security *command.LintResult
+}
+
+// runInstallJob builds and installs a new chart version of the app, or reinstalls
+// opts.version from the chart repo if it is not empty.
+func (h *handlers) runInstallJob(ctx context.Context, j *installJob, owner, name, token, prevState string, opts installOptions) {
+	var err error
+	// the state to leave the app in if the job is canceled, it follows what the job has already changed
+	restoreState := prevState
+	if restoreState == deploying {
+		restoreState = undeploy
+	}
+	defer h.jobs.release(owner, name)
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			klog.Infof("install job %s of app=%s is canceled at step %s", j.job.JobID, name, j.job.Step)
+			e := UpdateDevAppState(owner, name, restoreState, "canceled")
+			if e != nil {
+				klog.Errorf("update app state to %s err %v", restoreState, e)
+			}
+			j.canceled()
+			return
+		}
+		if err != nil {
+			e := UpdateDevAppState(owner, name, abnormal, err.Error())
+			if e != nil {
+				klog.Errorf("update app state to abnormal err %v", e)
+			}
+		}
+		j.finish(err)
+	}()
+
+	devName := utils.DevName(name)
+	devNamespace := fmt.Sprintf("%s-%s", devName, owner)
+
+	version := opts.version
+	rollback := version != ""
+	if !rollback {
+		j.start(stepLint)
+		err = helm.EnsureDependencies(getAppPath(owner, name), utils.GetUserBaseDir(owner))
+		if err != nil {
+			klog.Errorf("failed to build dependencies of app=%s, err=%v", name, err)
+			err = fmt.Errorf("build dependencies failed: %v", err)
+			return
+		}
+		var result *command.LintResult
+		result, err = command.Lint().WithDir(BaseDir).Check(ctx, owner, name)
+		if err != nil {
+			klog.Errorf("failed to lint app=%s, err=%v", name, err)
+			return
+		}
+		j.detail(stepLint, result)
+		if !result.Passed {
+			err = &command.LintError{Result: result}
+			klog.Errorf("failed to lint app=%s, err=%v", name, err)
+			return
+		}
+		j.done(stepLint, "")
+	}
+
+	j.start(stepPrepare)
+	var releaseNotExist bool
+	err = helm.GetRelease(h.kubeConfig, devNamespace, devName)
+	if err != nil {
+		if !errors.Is(err, driver.ErrReleaseNotFound) {
+			klog.Errorf("failed to get release %s %v", devName, err)
+			return
+		}
+		err = nil
+		releaseNotExist = true
+	}
+	// the old release is gone, or about to be, from here on
+	restoreState = undeploy
+	if !releaseNotExist {
+		err = waitForUninstall(ctx, owner, name, token)
+		if err != nil {
+			err = fmt.Errorf("wait for uninstall failed: %v", err)
+			return
+		}
+	}
+
+	klog.Info("preinstall, create a labeled namespace for webhook")
+	_, err = container.CreateOrUpdateDevNamespace(ctx, h.kubeConfig, owner, devName)
+	if err != nil {
+		klog.Errorf("failed to check namespace %v", err)
+		err = fmt.Errorf("check namespace failed: %v", err)
+		return
+	}
+	j.done(stepPrepare, "")
+
+	if !rollback {
+		klog.Infof("auto update repo, name %s", name)
+		j.start(stepVersion)
+		version, err = command.UpdateRepo().WithDir(BaseDir).WithBump(opts.bump).WithProfile(opts.profile).
+			WithBeforePush(func() {
+				j.done(stepVersion, "")
+				j.start(stepPush)
+			}).
+			Run(ctx, owner, name, false)
+		if err != nil {
+			klog.Errorf("command upgrade repo error name %s %v ", name, err)
+			err = fmt.Errorf("update repo failed: %v", err)
+			return
+		}
+		j.job.Version = version
+		j.done(stepPush, version)
+		commitApp(ctx, owner, name, j.actor, "Release "+version)
+	}
+
+	j.start(stepUpload)
+	if rollback {
+		// the market installs the latest version it has, so the versions above the
+		// rollback target are taken out of it first
+		err = h.removeNewerMarketVersions(ctx, owner, name, token, version)
+		if err != nil {
+			err = fmt.Errorf("remove newer chart versions failed: %v", err)
+			return
+		}
+	}
+	isChartVersionExist, err := h.chartOp.CheckVersion(ctx, owner, devName, version)
+	if err != nil {
+		err = fmt.Errorf("check chart version failed: %v", err)
+		return
+	}
+	if !isChartVersionExist {
+		err = h.chartOp.Upload(ctx, owner, devName, token, version)
+		if err != nil {
+			err = fmt.Errorf("upload chart failed: %v", err)
+			return
+		}
+	}
+	j.done(stepUpload, "")
+
+	j.start(stepInstall)
+	err = command.Install().Run(ctx, owner, name, token, version)
+	if err != nil {
+		klog.Error("command install error, ", err, ", ", name)
+		err = fmt.Errorf("install failed: %v", err)
+		return
+	}
+
+	// app-service installs the app in background, the reconciler follows it from here
+	err = UpdateDevAppState(owner, name, reconciler.StateInstalling, "installing")
+	if err != nil {
+		klog.Errorf("failed to update app=%s state to installing %v", name, err)
+		err = fmt.Errorf("update app state to installing err %v", err)
+		return
+	}
+	h.reconciler.Track(owner, name, reconciler.StateInstalling)
+	j.done(stepInstall, devNamespace)
+}
+
+// findJob returns a job of the caller, or of the owner in the owner query if the
+// caller can view the app of the job.
+func (h *handlers) findJob(ctx *fiber.Ctx, jobID string) (*model.DevAppJob, error) {
+	username := ctx.Locals("username").(string)
+	owner := ctx.Query("owner", username)
+	job, err := h.store.Jobs.Get(owner, jobID)
+	if err != nil || owner == username {
+		return job, err
+	}
+	role, err := h.appRole(owner, job.AppName, username)
+	if err != nil {
+		return nil, err
+	}
+	if !middlewares.HasRole(role, middlewares.RoleViewer) {
+		return nil, db.ErrNotFound
+	}
+	return job, nil
+}
+
+func (h *handlers) getJob(ctx *fiber.Ctx) error {
+	job, err := h.findJob(ctx, ctx.Params("id"))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusNotFound,
+				"message": "job not found",
+			})
+		}
+		klog.Errorf("failed to get job %s, err=%v", ctx.Params("id"), err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": job,
+	})
+}
+
+func (h *handlers) listAppJobs(ctx *fiber.Ctx) error {
+	owner := appOwner(ctx)
+	name := ctx.Params("name")
+	list, err := h.store.Jobs.List(owner, name, ctx.QueryInt("limit", 20))
+	if err != nil {
+		klog.Error("exec sql error, ", err)
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+	return ctx.JSON(fiber.Map{
+		"code": http.StatusOK,
+		"data": list,
+	})
+}
+
+// watchJob streams job snapshots as server-sent events until the job is finished.
+func (h *handlers) watchJob(ctx *fiber.Ctx) error {
+	jobID := ctx.Params("id")
+
+	// start watching before reading the job, so no transition between them is lost
+	ch, stop := h.jobs.watch(jobID)
+	job, err := h.findJob(ctx, jobID)
+	if err != nil {
+		stop()
+		if errors.Is(err, db.ErrNotFound) {
+			return ctx.JSON(fiber.Map{
+				"code":    http.StatusNotFound,
+				"message": "job not found",
+			})
+		}
+		return ctx.JSON(fiber.Map{
+			"code":    http.StatusBadRequest,
+			"message": fmt.Sprintf("Exec sql failed: %v", err),
+		})
+	}
+
+	ctx.Set("Content-Type", "text/event-stream")
+	ctx.Set("Cache-Control", "no-cache")
+	ctx.Set("Connection", "keep-alive")
+	ctx.Set("X-Accel-Buffering", "no")
+
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer stop()
+		send := func(job *model.DevAppJob) bool {
+			data, err := json.Marshal(job)
+			if err != nil {
+				klog.Errorf("failed to marshal job %v", err)
+				return false
+			}
+			fmt.Fprintf(w, "event: job\ndata: %s\n\n", data)
+			return w.Flush() == nil
+		}
+
+		if !send(job) || isJobFinished(job) {
+			return
+		}
+		ticker := time.NewTicker(15 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case j := <-ch:
+				if !send(&j) || isJobFinished(&j) {
+					return
+				}
+			case <-ticker.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
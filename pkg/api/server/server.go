@@ -1,10 +1,12 @@
 package server
 
 import (
+	"context"
 	"os"
 	"strconv"
 
 	"github.com/beclab/devbox/pkg/middlewares"
+	"github.com/beclab/devbox/pkg/reconciler"
 	"github.com/beclab/devbox/pkg/services"
 	"github.com/beclab/devbox/pkg/store/db"
 	"github.com/beclab/devbox/pkg/webhook"
@@ -31,22 +33,33 @@ var (
 	tlsKeyEnv              = "WEBHOOK_TLS_KEY"
 )
 
-func NewServer(db *db.DbOperator) *server {
+func NewServer(store *db.Stores) *server {
 	config := ctrl.GetConfigOrDie()
 	// wire services here if needed in future
 	webhook := &webhook.Webhook{
 		KubeClient: kubernetes.NewForConfigOrDie(config),
-		DB:         db,
+		Store:      store,
 	}
 	utilruntime.Must(webhook.CreateOrUpdateDevContainerMutatingWebhook())
 	utilruntime.Must(webhook.CreateOrUpdateImageManagerMutatingWebhook())
 
+	if err := failInterruptedJobs(store.Jobs); err != nil {
+		klog.Errorf("failed to mark interrupted jobs as failed %v", err)
+	}
+
+	appOp := services.NewAppOp()
+	r := reconciler.New(appOp, UpdateDevAppState)
+	if err := trackApps(store.Apps, r); err != nil {
+		klog.Errorf("failed to track the deployed apps %v", err)
+	}
 	return &server{
 		handlers: &handlers{
-			db:         db,
+			store:      store,
 			kubeConfig: config,
-			appOp:      services.NewAppOp(),
+			appOp:      appOp,
 			chartOp:    services.NewChartOp(),
+			jobs:       newJobManager(),
+			reconciler: r,
 		},
 		webhooks: &webhooks{
 			webhook: webhook,
@@ -72,20 +85,35 @@ func (s *server) Start() {
 
 	api := app.Group("api")
 	api.Use(middlewares.TokenAuth())
+	api.Use(middlewares.Audit(s.handlers.store.Audit.Append))
+
+	// a request with the owner query acts on an app shared by that owner
+	viewer := func(name middlewares.AppName) fiber.Handler {
+		return middlewares.AppAccess(s.handlers.appRole, middlewares.RoleViewer, name)
+	}
+	editor := func(name middlewares.AppName) fiber.Handler {
+		return middlewares.AppAccess(s.handlers.appRole, middlewares.RoleEditor, name)
+	}
+	deployer := func(name middlewares.AppName) fiber.Handler {
+		return middlewares.AppAccess(s.handlers.appRole, middlewares.RoleDeployer, name)
+	}
+	owner := func(name middlewares.AppName) fiber.Handler {
+		return middlewares.AppAccess(s.handlers.appRole, middlewares.RoleOwner, name)
+	}
 
 	// commands /api/command
 	command := api.Group("command")
 	//command.Post("/create-app", s.handlers.createDevApp)
 	command.Get("/list-app", s.handlers.listDevApps)
-	command.Get("/apps/:name", s.handlers.getDevApp)
-	command.Post("/update-app-repo", s.handlers.updateDevAppRepo)
-	command.Post("/install-app", s.handlers.installDevApp)
-	command.Get("/download-app-chart", s.handlers.downloadDevAppChart)
+	command.Get("/apps/:name", viewer(middlewares.AppParam("name")), s.handlers.getDevApp)
+	command.Post("/update-app-repo", editor(middlewares.AppBody("name")), s.handlers.updateDevAppRepo)
+	command.Post("/install-app", deployer(middlewares.AppBody("name")), s.handlers.installDevApp)
+	command.Get("/download-app-chart", viewer(middlewares.AppQuery("app")), s.handlers.downloadDevAppChart)
 	command.Post("/open-application", s.handlers.openApplication)
-	command.Post("/delete-app", s.handlers.deleteDevApp)
-	command.Post("/upload-app-chart", s.handlers.uploadDevAppChart)
-	command.Get("/lint-app-chart", s.handlers.lintDevAppChart)
-	command.Post("/uninstall/:name", s.handlers.uninstall)
+	command.Post("/delete-app", owner(middlewares.AppBody("name")), s.handlers.deleteDevApp)
+	command.Post("/upload-app-chart", editor(middlewares.AppForm("app")), s.handlers.uploadDevAppChart)
+	command.Get("/lint-app-chart", viewer(middlewares.AppQuery("app")), s.handlers.lintDevAppChart)
+	command.Post("/uninstall/:name", deployer(middlewares.AppParam("name")), s.handlers.uninstall)
 	command.Post("/upload-app-archive", s.handlers.createAppByArchive)
 
 	command.Post("/apps/create", s.handlers.createApp)
@@ -94,40 +122,81 @@ func (s *server) Start() {
 	command.Post("/apps/:name/vscode/create", s.handlers.fillAppWithDevContainer)
 	command.Post("/apps/kompose", s.handlers.createAppFromComposeFile)
 
-	command.Put("/apps/title/:name", s.handlers.updateAppTitle)
+	command.Put("/apps/title/:name", owner(middlewares.AppParam("name")), s.handlers.updateAppTitle)
+
+	command.Get("/apps/:name/collaborators", viewer(middlewares.AppParam("name")), s.handlers.listCollaborators)
+	command.Put("/apps/:name/collaborators/:user", owner(middlewares.AppParam("name")), s.handlers.setCollaborator)
+	command.Delete("/apps/:name/collaborators/:user", owner(middlewares.AppParam("name")), s.handlers.deleteCollaborator)
+
+	command.Get("/apps/:name/install-diff", viewer(middlewares.AppParam("name")), s.handlers.diffInstall)
+	command.Get("/apps/:name/render", viewer(middlewares.AppParam("name")), s.handlers.renderDevApp)
+	command.Get("/apps/:name/versions", viewer(middlewares.AppParam("name")), s.handlers.listChartVersions)
+	command.Get("/apps/:name/profiles", viewer(middlewares.AppParam("name")), s.handlers.listValuesProfiles)
+	command.Get("/apps/:name/dependencies", viewer(middlewares.AppParam("name")), s.handlers.listDependencies)
+	command.Post("/apps/:name/dependencies/update", editor(middlewares.AppParam("name")), s.handlers.updateDependencies)
+	command.Post("/apps/:name/dependencies/build", editor(middlewares.AppParam("name")), s.handlers.buildDependencies)
+	command.Post("/apps/:name/rollback", deployer(middlewares.AppParam("name")), s.handlers.rollbackDevApp)
+	command.Post("/apps/:name/bump", editor(middlewares.AppParam("name")), s.handlers.bumpChartVersion)
+
+	command.Get("/apps/:name/security-allowlist", viewer(middlewares.AppParam("name")), s.handlers.getSecurityAllowlist)
+	command.Put("/apps/:name/security-allowlist", owner(middlewares.AppParam("name")), s.handlers.setSecurityAllowlist)
+
+	command.Get("/apps/:name/git/log", viewer(middlewares.AppParam("name")), s.handlers.gitLog)
+	command.Get("/apps/:name/git/diff", viewer(middlewares.AppParam("name")), s.handlers.gitDiff)
+	command.Post("/apps/:name/git/restore", editor(middlewares.AppParam("name")), s.handlers.gitRestore)
+	command.Put("/apps/:name/git/remote", owner(middlewares.AppParam("name")), s.handlers.gitSetRemote)
+	command.Post("/apps/:name/git/push", editor(middlewares.AppParam("name")), s.handlers.gitPush)
+	command.Post("/apps/:name/git/pull", editor(middlewares.AppParam("name")), s.handlers.gitPull)
+
+	command.Get("/schemas/manifest", s.handlers.getManifestSchema)
+	command.Get("/templates", s.handlers.listTemplates)
+	command.Get("/templates/:name", s.handlers.getTemplate)
+
+	command.Get("/apps/:name/jobs", viewer(middlewares.AppParam("name")), s.handlers.listAppJobs)
+	command.Get("/jobs/:id", s.handlers.getJob)
+	command.Get("/jobs/:id/events", s.handlers.watchJob)
 
 	// files /api/files
 	files := api.Group("files")
-	files.Get("/*", s.handlers.getFiles)
-	files.Put("/*", s.handlers.saveFile)
-	files.Post("/*", s.handlers.resourcePostHandler)
-	files.Delete("/*", s.handlers.resourceDeleteHandler)
-	files.Patch("/*", s.handlers.resourcePatchHandler)
+	files.Use(denyGitDir)
+	files.Get("/*", viewer(middlewares.AppPath("*1")), s.handlers.getFiles)
+	files.Put("/*", editor(middlewares.AppPath("*1")), s.handlers.saveFile)
+	files.Post("/*", editor(middlewares.AppPath("*1")), s.handlers.resourcePostHandler)
+	files.Delete("/*", editor(middlewares.AppPath("*1")), s.handlers.resourceDeleteHandler)
+	files.Patch("/*", editor(middlewares.AppPath("*1")), s.handlers.resourcePatchHandler)
 
 	// front end api  /api
 	//api.Post("/bind-container", s.handlers.bindContainer)
 	//api.Post("/unbind-container", s.handlers.unbindContainer)
-	api.Get("/list-app-containers", s.handlers.listAppContainersInChart)
+	api.Get("/list-app-containers", viewer(middlewares.AppQuery("app")), s.handlers.listAppContainersInChart)
 	//api.Get("/list-my-containers", s.handlers.listMyContainers)
 	//api.Get("/app-cfg", s.handlers.getAppConfig)
 	//api.Post("/app-cfg", s.handlers.updateAppConfig)
 
 	api.Get("/app-state", s.handlers.getAppState)
 	api.Get("/app-status", s.handlers.getAppStatus)
-	//api.Post("/apps/:name/cancel", s.handlers.cancel)
+	api.Post("/apps/:name/cancel", deployer(middlewares.AppParam("name")), s.handlers.cancel)
 	api.Get("/dev-container/:name", s.handlers.getDevContainer)
 	api.Delete("/dev-container/:name", s.handlers.delDevContainer)
 	api.Patch("/dev-container/:name", s.handlers.updateDevContainer)
 
-	api.Get("/apps/:name/status", s.handlers.appState)
+	api.Get("/apps/:name/status", viewer(middlewares.AppParam("name")), s.handlers.appState)
 
 	api.Get("/dev-containers/:id", s.handlers.getDevContainer)
 
+	api.Get("/audit", s.handlers.listAudit)
+
 	// webhooks /webhook, do not need auth token
 	wh := webhookServer.Group("webhook")
 	wh.Post("/devcontainer", s.webhooks.devcontainer)
 	wh.Post("/imagemanager", s.webhooks.imageManager)
 
+	nc, err := reconciler.ConnectNats()
+	if err != nil {
+		klog.Warningf("reconcile dev app state without market updates, %v", err)
+	}
+	go s.handlers.reconciler.Run(context.Background(), nc)
+
 	klog.Info("dev box api server listening on 8088 ")
 
 	go func() {
@@ -136,7 +205,7 @@ func (s *server) Start() {
 		klog.Fatal(err)
 	}()
 
-	err := app.Listen(":8088")
+	err = app.Listen(":8088")
 	webhookServer.Shutdown()
 
 	klog.Fatal(err)
@@ -13,10 +13,20 @@ import (
 	"github.com/beclab/devbox/pkg/utils"
 	"github.com/beclab/oachecker"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/mholt/archiver/v3"
 	"k8s.io/klog/v2"
 )
 
+// appOwner returns the owner of the app a request acts on, which is set by the
+// app access middleware, the caller owns the app otherwise.
+func appOwner(ctx *fiber.Ctx) string {
+	if owner, ok := ctx.Locals("owner").(string); ok && owner != "" {
+		return owner
+	}
+	return ctx.Locals("username").(string)
+}
+
 func getAppPath(owner, app string) string {
 	return filepath.Join(BaseDir, owner, app)
 }
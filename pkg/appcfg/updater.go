@@ -1,6 +1,7 @@
 package appcfg
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -146,3 +147,66 @@ func UpdateEntrancesTitleAddDev(appDir string) error {
 	newContent := strings.Join(lines, "\n")
 	return os.WriteFile(appCfgPath, []byte(newContent), 0644)
 }
+
+// UpdateSpecField sets one field under spec: in place, the field is added if it is missing.
+// The value is written as a quoted scalar so that any text is kept as is.
+func UpdateSpecField(appDir string, field string, value string) error {
+	appCfgPath := filepath.Join(appDir, constants.AppCfgFileName)
+	data, err := os.ReadFile(appCfgPath)
+	if err != nil {
+		return err
+	}
+	quoted, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	leadingWS := func(s string) string {
+		return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+	}
+	lines := strings.Split(string(data), "\n")
+	specIdx, indent := -1, ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if specIdx < 0 {
+			if strings.TrimRight(line, " \r") == "spec:" {
+				specIdx = i
+			}
+			continue
+		}
+		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+			break
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent == "" {
+			indent = leadingWS(line)
+		}
+		if leadingWS(line) != indent || !strings.HasPrefix(trimmed, field+":") {
+			continue
+		}
+		// drop the lines of a multi line value along with the field
+		end := i + 1
+		for end < len(lines) && (strings.TrimSpace(lines[end]) == "" || len(leadingWS(lines[end])) > len(indent)) {
+			end++
+		}
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		lines = append(append(lines[:i], indent+field+": "+string(quoted)), lines[end:]...)
+		return os.WriteFile(appCfgPath, []byte(strings.Join(lines, "\n")), 0644)
+	}
+
+	if indent == "" {
+		indent = "  "
+	}
+	entry := indent + field + ": " + string(quoted)
+	if specIdx < 0 {
+		content := strings.TrimRight(string(data), "\n") + "\nspec:\n" + entry + "\n"
+		return os.WriteFile(appCfgPath, []byte(content), 0644)
+	}
+	lines = append(lines[:specIdx+1], append([]string{entry}, lines[specIdx+1:]...)...)
+	return os.WriteFile(appCfgPath, []byte(strings.Join(lines, "\n")), 0644)
+}
@@ -14,10 +14,20 @@ const (
 	ApplicationGpuInjectKey            = "applications.app.bytetrade.io/gpu-inject"
 	ApplicationDefaultThirdLevelDomain = "applications.app.bytetrade.io/default-thirdlevel-domains"
 	SupportOsVersion                   = ">=1.12.1-0"
+	StudioDir                          = ".studio"
+	ValuesFixtureFileName              = StudioDir + "/values.fixture.yaml"
+	LintRulesFileName                  = StudioDir + "/lint-rules.yaml"
 )
 
 var (
 	Namespace = ""
+
+	// GpuVendorResources are the resources the nodes advertise their GPUs with, by vendor.
+	GpuVendorResources = map[string]string{
+		"nvidia": "nvidia.com/gpu",
+		"amd":    "amd.com/gpu",
+		"intel":  "gpu.intel.com/i915",
+	}
 )
 
 func init() {
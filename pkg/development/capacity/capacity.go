@@ -0,0 +1,371 @@
+package capacity
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceGPU stands for the requiredGpu of the manifest, the nodes advertise their GPUs
+// with the resource of the vendor and the app needs them from a single vendor.
+const ResourceGPU corev1.ResourceName = "gpu"
+
+// checked are the resources always compared with the free resources of the nodes, the
+// extended resources the pods request are compared too.
+var checked = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory, corev1.ResourceEphemeralStorage, ResourceGPU}
+
+// Requirements are the requiredCpu, requiredMemory, requiredDisk and requiredGpu of OlaresManifest.yaml.
+type Requirements struct {
+	CPU    string
+	Memory string
+	Disk   string
+	GPU    string
+}
+
+// Shortage is a resource the cluster can not fit for the app, or for a pod of it.
+type Shortage struct {
+	Resource string `json:"resource"`
+	// Workload is the kind/name of the workload whose pod fits on no node, empty for the app.
+	Workload  string `json:"workload,omitempty"`
+	Required  string `json:"required"`
+	Available string `json:"available"`
+	Message   string `json:"message"`
+}
+
+// Report is the result of checking whether the cluster can fit the app.
+type Report struct {
+	Fits bool `json:"fits"`
+	// Required adds up the requirements of the manifest and the requests of the pods, for each resource the larger.
+	Required  map[string]string `json:"required"`
+	Available map[string]string `json:"available"`
+	Shortages []Shortage        `json:"shortages"`
+}
+
+func (r *Report) Error() string {
+	msgs := make([]string, 0, len(r.Shortages))
+	for _, s := range r.Shortages {
+		msgs = append(msgs, s.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type podRequests struct {
+	workload string
+	replicas int64
+	requests corev1.ResourceList
+}
+
+// Check compares what the app requires with the allocatable resources of the schedulable
+// nodes minus the requests of the pods running on them. The pods in namespace are left
+// out, the install replaces them.
+func Check(ctx context.Context, client kubernetes.Interface, namespace string, req Requirements, objs []runtime.Object) (*Report, error) {
+	required, err := req.resourceList()
+	if err != nil {
+		return nil, err
+	}
+	pods := workloadPods(objs)
+	podTotal := corev1.ResourceList{}
+	for _, p := range pods {
+		for name, q := range p.requests {
+			total := podTotal[name]
+			for i := int64(0); i < p.replicas; i++ {
+				total.Add(q)
+			}
+			podTotal[name] = total
+		}
+	}
+	for name, q := range podTotal {
+		if r, ok := required[name]; !ok || q.Cmp(r) > 0 {
+			required[name] = q
+		}
+	}
+
+	names := checkedResources(pods)
+	free, err := nodeFree(ctx, client, namespace, names)
+	if err != nil {
+		return nil, err
+	}
+	available := corev1.ResourceList{}
+	for _, f := range free {
+		for name, q := range f {
+			total := available[name]
+			total.Add(q)
+			available[name] = total
+		}
+	}
+
+	report := &Report{Fits: true, Required: map[string]string{}, Available: map[string]string{}, Shortages: []Shortage{}}
+	for _, name := range names {
+		r, ok := required[name]
+		if !ok || r.IsZero() {
+			continue
+		}
+		a := freeOf(available, name)
+		report.Required[string(name)] = r.String()
+		report.Available[string(name)] = a.String()
+		if r.Cmp(a) > 0 {
+			report.Shortages = append(report.Shortages, Shortage{
+				Resource:  string(name),
+				Required:  r.String(),
+				Available: a.String(),
+				Message:   fmt.Sprintf("insufficient %s in the cluster, %s is required and %s is free", displayName(name), r.String(), a.String()),
+			})
+		}
+	}
+
+	// each pod has to fit on a single node
+	for _, p := range pods {
+		for _, name := range names {
+			r, ok := p.requests[name]
+			if !ok || r.IsZero() {
+				continue
+			}
+			largest := resource.Quantity{}
+			for _, f := range free {
+				if q := freeOf(f, name); q.Cmp(largest) > 0 {
+					largest = q
+				}
+			}
+			if r.Cmp(largest) <= 0 {
+				continue
+			}
+			report.Shortages = append(report.Shortages, Shortage{
+				Resource:  string(name),
+				Workload:  p.workload,
+				Required:  r.String(),
+				Available: largest.String(),
+				Message:   fmt.Sprintf("insufficient %s on all nodes for a pod of %s, %s is required and at most %s is free on a node", displayName(name), p.workload, r.String(), largest.String()),
+			})
+		}
+	}
+	report.Fits = len(report.Shortages) == 0
+	return report, nil
+}
+
+// checkedResources returns the resources checked for the pods, those always checked
+// followed by the extended resources any of them requests.
+func checkedResources(pods []podRequests) []corev1.ResourceName {
+	names := append([]corev1.ResourceName{}, checked...)
+	seen := make(map[corev1.ResourceName]bool)
+	for _, p := range pods {
+		for name := range p.requests {
+			if isExtendedResource(name) && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names[len(checked):], func(i, j int) bool {
+		return names[len(checked)+i] < names[len(checked)+j]
+	})
+	return names
+}
+
+// isExtendedResource reports whether name is a resource advertised by a device plugin or
+// the cluster admin, one in a domain other than kubernetes.io, as the api server tells them.
+func isExtendedResource(name corev1.ResourceName) bool {
+	s := string(name)
+	return strings.Contains(s, "/") && !strings.Contains(s, corev1.ResourceDefaultNamespacePrefix) &&
+		!strings.HasPrefix(s, corev1.DefaultResourceRequestsPrefix)
+}
+
+// freeOf returns the free quantity of name in list, for ResourceGPU that of the GPU
+// vendor with the most.
+func freeOf(list corev1.ResourceList, name corev1.ResourceName) resource.Quantity {
+	if name != ResourceGPU {
+		return list[name]
+	}
+	largest := resource.Quantity{}
+	for _, vendor := range constants.GpuVendorResources {
+		if q := list[corev1.ResourceName(vendor)]; q.Cmp(largest) > 0 {
+			largest = q
+		}
+	}
+	return largest
+}
+
+func displayName(name corev1.ResourceName) string {
+	if name == corev1.ResourceEphemeralStorage {
+		return "disk"
+	}
+	return string(name)
+}
+
+func (r Requirements) resourceList() (corev1.ResourceList, error) {
+	list := corev1.ResourceList{}
+	for _, v := range []struct {
+		field string
+		name  corev1.ResourceName
+		value string
+	}{
+		{"requiredCpu", corev1.ResourceCPU, r.CPU},
+		{"requiredMemory", corev1.ResourceMemory, r.Memory},
+		{"requiredDisk", corev1.ResourceEphemeralStorage, r.Disk},
+		{"requiredGpu", ResourceGPU, r.GPU},
+	} {
+		if v.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", v.field, v.value, err)
+		}
+		list[v.name] = q
+	}
+	return list, nil
+}
+
+// nodeFree returns the resources in names free on each schedulable and ready node, with
+// the resources of the GPU vendors for ResourceGPU.
+func nodeFree(ctx context.Context, client kubernetes.Interface, namespace string, names []corev1.ResourceName) ([]corev1.ResourceList, error) {
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]corev1.ResourceList)
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || pod.Namespace == namespace ||
+			pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		list, ok := used[pod.Spec.NodeName]
+		if !ok {
+			list = corev1.ResourceList{}
+			used[pod.Spec.NodeName] = list
+		}
+		for name, q := range podSpecRequests(&pod.Spec) {
+			total := list[name]
+			total.Add(q)
+			list[name] = total
+		}
+	}
+
+	free := make([]corev1.ResourceList, 0, len(nodes.Items))
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable || !nodeReady(&node) {
+			continue
+		}
+		list := corev1.ResourceList{}
+		for _, name := range nodeResources(names) {
+			q := node.Status.Allocatable[name].DeepCopy()
+			q.Sub(used[node.Name][name])
+			if q.Sign() < 0 {
+				q = resource.Quantity{}
+			}
+			list[name] = q
+		}
+		free = append(free, list)
+	}
+	return free, nil
+}
+
+// nodeResources replaces ResourceGPU in names with the resources of the GPU vendors.
+func nodeResources(names []corev1.ResourceName) []corev1.ResourceName {
+	list := make([]corev1.ResourceName, 0, len(names)+len(constants.GpuVendorResources))
+	for _, name := range names {
+		if name != ResourceGPU {
+			list = append(list, name)
+		}
+	}
+	for _, vendor := range constants.GpuVendorResources {
+		list = append(list, corev1.ResourceName(vendor))
+	}
+	return list
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == corev1.NodeReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// workloadPods returns the requests of a pod of each workload in objs, sorted by workload.
+func workloadPods(objs []runtime.Object) []podRequests {
+	pods := make([]podRequests, 0)
+	add := func(kind, name string, replicas *int32, spec *corev1.PodSpec) {
+		n := int64(1)
+		if replicas != nil {
+			n = int64(*replicas)
+		}
+		pods = append(pods, podRequests{workload: kind + "/" + name, replicas: n, requests: podSpecRequests(spec)})
+	}
+	for _, o := range objs {
+		switch obj := o.(type) {
+		case *appsv1.Deployment:
+			add("Deployment", obj.Name, obj.Spec.Replicas, &obj.Spec.Template.Spec)
+		case *appsv1.StatefulSet:
+			add("StatefulSet", obj.Name, obj.Spec.Replicas, &obj.Spec.Template.Spec)
+		case *appsv1.DaemonSet:
+			add("DaemonSet", obj.Name, nil, &obj.Spec.Template.Spec)
+		case *appsv1.ReplicaSet:
+			add("ReplicaSet", obj.Name, obj.Spec.Replicas, &obj.Spec.Template.Spec)
+		case *batchv1.Job:
+			add("Job", obj.Name, obj.Spec.Parallelism, &obj.Spec.Template.Spec)
+		case *batchv1.CronJob:
+			add("CronJob", obj.Name, obj.Spec.JobTemplate.Spec.Parallelism, &obj.Spec.JobTemplate.Spec.Template.Spec)
+		case *corev1.Pod:
+			add("Pod", obj.Name, nil, &obj.Spec)
+		}
+	}
+	sort.SliceStable(pods, func(i, j int) bool { return pods[i].workload < pods[j].workload })
+	return pods
+}
+
+// podSpecRequests returns what the scheduler reserves for the pod, the containers add up
+// and an init container needs as much as it requests while it runs alone.
+func podSpecRequests(spec *corev1.PodSpec) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	for _, c := range spec.Containers {
+		for name, q := range containerRequests(&c) {
+			total := list[name]
+			total.Add(q)
+			list[name] = total
+		}
+	}
+	for _, c := range spec.InitContainers {
+		for name, q := range containerRequests(&c) {
+			if q.Cmp(list[name]) > 0 {
+				list[name] = q
+			}
+		}
+	}
+	for name, q := range spec.Overhead {
+		total := list[name]
+		total.Add(q)
+		list[name] = total
+	}
+	return list
+}
+
+// containerRequests defaults a request to the limit, as the api server does.
+func containerRequests(c *corev1.Container) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	for name, q := range c.Resources.Limits {
+		list[name] = q.DeepCopy()
+	}
+	for name, q := range c.Resources.Requests {
+		list[name] = q.DeepCopy()
+	}
+	return list
+}
@@ -0,0 +1,128 @@
+package capacity
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testNode(name, cpu, memory string, ready bool) *corev1.Node {
+	status := corev1.ConditionTrue
+	if !ready {
+		status = corev1.ConditionFalse
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:              resource.MustParse(cpu),
+				corev1.ResourceMemory:           resource.MustParse(memory),
+				corev1.ResourceEphemeralStorage: resource.MustParse("100Gi"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}},
+		},
+	}
+}
+
+func testPod(namespace, name, node, cpu, memory string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Containers: []corev1.Container{{
+				Name: "c",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(memory),
+				}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+func testDeployment(replicas int32, memory string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:      "web",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memory)}},
+				}},
+				InitContainers: []corev1.Container{{
+					Name:      "init",
+					Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")}},
+				}},
+			}},
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	client := fake.NewClientset(
+		testNode("node1", "4", "8Gi", true),
+		testNode("node2", "4", "8Gi", true),
+		testNode("node3", "64", "256Gi", false),
+		testPod("other", "busy", "node1", "3", "6Gi"),
+		// replaced by the install
+		testPod("app-dev-alice", "old", "node2", "4", "8Gi"),
+	)
+	ctx := context.Background()
+
+	report, err := Check(ctx, client, "app-dev-alice", Requirements{CPU: "1", Memory: "4Gi"}, []runtime.Object{testDeployment(2, "3Gi")})
+	assert.NoError(t, err)
+	assert.True(t, report.Fits)
+	assert.Equal(t, "6Gi", report.Required["memory"])
+	assert.Equal(t, "10Gi", report.Available["memory"])
+	assert.Equal(t, "1", report.Required["cpu"])
+
+	report, err = Check(ctx, client, "app-dev-alice", Requirements{}, []runtime.Object{testDeployment(1, "9Gi")})
+	assert.NoError(t, err)
+	assert.False(t, report.Fits)
+	if assert.Len(t, report.Shortages, 1) {
+		s := report.Shortages[0]
+		assert.Equal(t, "Deployment/web", s.Workload)
+		assert.Equal(t, "8Gi", s.Available)
+		assert.Equal(t, "insufficient memory on all nodes for a pod of Deployment/web, 9Gi is required and at most 8Gi is free on a node", s.Message)
+	}
+
+	report, err = Check(ctx, client, "app-dev-alice", Requirements{Memory: "12Gi", GPU: "1"}, nil)
+	assert.NoError(t, err)
+	assert.False(t, report.Fits)
+	assert.Equal(t, "insufficient memory in the cluster, 12Gi is required and 10Gi is free; insufficient gpu in the cluster, 1 is required and 0 is free", report.Error())
+
+	_, err = Check(ctx, client, "app-dev-alice", Requirements{CPU: "two"}, nil)
+	assert.Error(t, err)
+}
+
+func TestCheckExtendedResources(t *testing.T) {
+	node := testNode("node1", "4", "8Gi", true)
+	node.Status.Allocatable["amd.com/gpu"] = resource.MustParse("2")
+	client := fake.NewClientset(node)
+	ctx := context.Background()
+
+	report, err := Check(ctx, client, "app-dev-alice", Requirements{GPU: "2"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, report.Fits)
+	assert.Equal(t, "2", report.Available["gpu"])
+
+	fpga := testDeployment(1, "1Gi")
+	fpga.Spec.Template.Spec.Containers[0].Resources.Limits["example.com/fpga"] = resource.MustParse("1")
+	fpga.Spec.Template.Spec.Containers[0].Resources.Limits["amd.com/gpu"] = resource.MustParse("1")
+	report, err = Check(ctx, client, "app-dev-alice", Requirements{GPU: "3"}, []runtime.Object{fpga})
+	assert.NoError(t, err)
+	assert.False(t, report.Fits)
+	assert.Equal(t, "1", report.Required["amd.com/gpu"])
+	assert.Equal(t, "insufficient gpu in the cluster, 3 is required and 2 is free; "+
+		"insufficient example.com/fpga in the cluster, 1 is required and 0 is free; "+
+		"insufficient example.com/fpga on all nodes for a pod of Deployment/web, 1 is required and at most 0 is free on a node", report.Error())
+}
@@ -5,22 +5,78 @@ import (
 	"fmt"
 	"k8s.io/klog/v2"
 	"net/http"
+	"sort"
 	"time"
 
+	"github.com/beclab/devbox/pkg/utils"
+
 	"github.com/go-resty/resty/v2"
 	helm_repo "helm.sh/helm/v3/pkg/repo"
 	"sigs.k8s.io/yaml"
 )
 
+// DefaultChartRetention is the number of chart versions of an app kept in chartmuseum by default.
+const DefaultChartRetention = 5
+
+// ChartRetention is the number of chart versions of an app kept in chartmuseum,
+// older ones are deleted once a new version is pushed.
+var ChartRetention = DefaultChartRetention
+
+// DefaultChartRepoURL is the chartmuseum the charts of the apps are pushed to by default.
+const DefaultChartRepoURL = "http://127.0.0.1:8888"
+
+// ChartRepoURL is the chartmuseum the charts of the apps are pushed to.
+var ChartRepoURL = DefaultChartRepoURL
+
+// ChartVersion is a chart version of an app stored in chartmuseum.
+type ChartVersion struct {
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+	Digest  string    `json:"digest"`
+}
+
+// ListChartVersions returns the chart versions of the app stored in chartmuseum, newest first.
+func ListChartVersions(owner, app string) ([]ChartVersion, error) {
+	chartVersions, err := getChartVersions(owner, utils.DevName(app))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(chartVersions))
+	versions := make([]ChartVersion, 0, len(chartVersions))
+	for _, cv := range chartVersions {
+		versions = append(versions, ChartVersion{Version: cv.Version, Created: cv.Created, Digest: cv.Digest})
+	}
+	return versions, nil
+}
+
+// FetchChartArchive downloads the packaged chart of a version of the app from chartmuseum.
+func FetchChartArchive(owner, app, version string) ([]byte, error) {
+	client := resty.New().SetTimeout(30 * time.Second)
+	url := fmt.Sprintf("%s/%s/charts/%s-%s.tgz", ChartRepoURL, owner, utils.DevName(app), version)
+	resp, err := client.R().Get(url)
+	if err != nil {
+		klog.Errorf("failed to send request to url=%s,err=%v", url, err)
+		return nil, err
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("fetch chart %s version %s from chartmuseum return unexpected status code %d", app, version, resp.StatusCode())
+	}
+	return resp.Body(), nil
+}
+
 func getChartVersions(owner, name string) (helm_repo.ChartVersions, error) {
 	chartVersions := make(helm_repo.ChartVersions, 0)
 	client := resty.New().SetTimeout(5 * time.Second)
-	url := fmt.Sprintf("http://127.0.0.1:8888/%s/api/charts/%s", owner, name)
+	url := fmt.Sprintf("%s/%s/api/charts/%s", ChartRepoURL, owner, name)
 	resp, err := client.R().Get(url)
 	if err != nil {
 		klog.Errorf("failed to send request to url=%s,err=%v", url, err)
 		return chartVersions, err
 	}
+	// chartmuseum answers 404 for a chart without any version
+	if resp.StatusCode() == http.StatusNotFound {
+		return chartVersions, nil
+	}
 	if resp.StatusCode() != http.StatusOK {
 		klog.Errorf("get chart versions from chartmuseum return unexpected status code %d,err=%v", resp.StatusCode(), resp.String())
 		return chartVersions, fmt.Errorf("get chart versions from chartmuseum return unexpected status code, %d", resp.StatusCode())
@@ -34,7 +90,7 @@ func getChartVersions(owner, name string) (helm_repo.ChartVersions, error) {
 
 func deleteChartVersion(owner, name, version string) error {
 	client := resty.New().SetTimeout(5 * time.Second)
-	url := fmt.Sprintf("http://127.0.0.1:8888/%s/api/charts/%s/%s", owner, name, version)
+	url := fmt.Sprintf("%s/%s/api/charts/%s/%s", ChartRepoURL, owner, name, version)
 	resp, err := client.R().Delete(url)
 	if err != nil {
 		klog.Errorf("failed to send request to url=%s,err=%v", url, err)
@@ -47,3 +103,49 @@ func deleteChartVersion(owner, name, version string) error {
 	}
 	return nil
 }
+
+// DeleteChartVersions deletes every chart version of the app stored in chartmuseum.
+func DeleteChartVersions(owner, app string) error {
+	name := utils.DevName(app)
+	chartVersions, err := getChartVersions(owner, name)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, 0)
+	for _, cv := range chartVersions {
+		err = deleteChartVersion(owner, name, cv.Version)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return AggregateErrs(errs)
+}
+
+// pruneChartVersions deletes all but the keep newest versions of the chart, the
+// version just pushed is always kept.
+func pruneChartVersions(owner, name, pushed string, keep int) error {
+	chartVersions, err := getChartVersions(owner, name)
+	if err != nil {
+		return err
+	}
+	if keep < 1 {
+		keep = 1
+	}
+	sort.Sort(sort.Reverse(chartVersions))
+	errs := make([]error, 0)
+	kept := 1
+	for _, cv := range chartVersions {
+		if cv.Version == pushed {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		err = deleteChartVersion(owner, name, cv.Version)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return AggregateErrs(errs)
+}
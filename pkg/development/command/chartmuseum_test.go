@@ -0,0 +1,116 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+func TestPruneChartVersions(t *testing.T) {
+	var mu sync.Mutex
+	deleted := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			assert.Equal(t, "/alice/api/charts/app-dev", r.URL.Path)
+			versions := []map[string]string{}
+			for _, v := range []string{"0.0.2", "0.0.10", "0.0.1", "0.0.9", "0.0.3"} {
+				versions = append(versions, map[string]string{"name": "app-dev", "version": v})
+			}
+			_ = json.NewEncoder(w).Encode(versions)
+		case http.MethodDelete:
+			mu.Lock()
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/alice/api/charts/app-dev/"))
+			mu.Unlock()
+		}
+	}))
+	defer srv.Close()
+	defer func(url string) { ChartRepoURL = url }(ChartRepoURL)
+	ChartRepoURL = srv.URL
+
+	assert.NoError(t, pruneChartVersions("alice", "app-dev", "0.0.10", 3))
+	sort.Strings(deleted)
+	assert.Equal(t, []string{"0.0.1", "0.0.2"}, deleted)
+
+	versions, err := ListChartVersions("alice", "app")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 5) {
+		assert.Equal(t, "0.0.10", versions[0].Version)
+	}
+
+	deleted = deleted[:0]
+	assert.NoError(t, DeleteChartVersions("alice", "app"))
+	sort.Strings(deleted)
+	assert.Equal(t, []string{"0.0.1", "0.0.10", "0.0.2", "0.0.3", "0.0.9"}, deleted)
+}
+
+func TestPushChart(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app-dev\nversion: 0.0.2\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "templates", "cm.yaml"), []byte("kind: ConfigMap\n"), 0644))
+
+	defer func(retries int, wait time.Duration) { chartPushRetries, chartPushRetryWait = retries, wait }(chartPushRetries, chartPushRetryWait)
+	chartPushRetryWait = time.Millisecond
+	defer func(url string) { ChartRepoURL = url }(ChartRepoURL)
+
+	var calls int
+	var pushed *chart.Chart
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/alice/api/charts", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("force"))
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		f, _, err := r.FormFile("chart")
+		if assert.NoError(t, err) {
+			pushed, err = loader.LoadArchive(f)
+			assert.NoError(t, err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"saved":true}`))
+	}))
+	defer srv.Close()
+	ChartRepoURL = srv.URL
+
+	name, err := PushChart(context.Background(), "alice", dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "app-dev-0.0.2.tgz", name)
+	assert.Equal(t, 2, calls)
+	if assert.NotNil(t, pushed) {
+		assert.Equal(t, "app-dev", pushed.Name())
+		assert.Equal(t, "0.0.2", pushed.Metadata.Version)
+	}
+
+	calls = 0
+	rejected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid chart"}`))
+	}))
+	defer rejected.Close()
+	ChartRepoURL = rejected.URL
+
+	_, err = PushChart(context.Background(), "alice", dir)
+	var repoErr *ChartRepoError
+	if assert.ErrorAs(t, err, &repoErr) {
+		assert.Equal(t, http.StatusBadRequest, repoErr.StatusCode)
+		assert.Equal(t, "invalid chart", repoErr.Message)
+	}
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/beclab/devbox/pkg/development/helm"
+
+	"github.com/go-resty/resty/v2"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/klog/v2"
+)
+
+var (
+	chartPushRetries   = 3
+	chartPushRetryWait = time.Second
+)
+
+// ChartRepoError is an upload rejected by the chart repo.
+type ChartRepoError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ChartRepoError) Error() string {
+	return fmt.Sprintf("chart repo returned status code %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether the upload may succeed if it is retried.
+func (e *ChartRepoError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError || e.StatusCode == http.StatusTooManyRequests
+}
+
+// PushChart packages the chart in dir and uploads it to the chart repo of owner,
+// an existing chart of the same version is replaced. It returns the archive name.
+func PushChart(ctx context.Context, owner, dir string) (string, error) {
+	chart, err := helm.LoadChart(dir)
+	if err != nil {
+		return "", err
+	}
+	err = helm.CheckDependencies(chart)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp("", "chart-push-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	archive, err := chartutil.Save(chart, tmp)
+	if err != nil {
+		klog.Errorf("failed to package chart path=%s, err=%v", dir, err)
+		return "", err
+	}
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(archive)
+	return name, pushChartArchive(ctx, owner, name, data)
+}
+
+// pushChartArchive uploads a packaged chart, retrying on network errors and
+// temporary failures of the chart repo.
+func pushChartArchive(ctx context.Context, owner, name string, data []byte) error {
+	url := fmt.Sprintf("%s/%s/api/charts", ChartRepoURL, owner)
+	var err error
+	for attempt := 0; attempt <= chartPushRetries; attempt++ {
+		if attempt > 0 {
+			klog.Warningf("retry pushing chart %s to %s, attempt=%d, err=%v", name, url, attempt, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(chartPushRetryWait * time.Duration(attempt)):
+			}
+		}
+		err = uploadChart(ctx, url, name, data)
+		var repoErr *ChartRepoError
+		if err == nil || ctx.Err() != nil || (errors.As(err, &repoErr) && !repoErr.Temporary()) {
+			return err
+		}
+	}
+	return err
+}
+
+func uploadChart(ctx context.Context, url, name string, data []byte) error {
+	client := resty.New().SetTimeout(30 * time.Second)
+	resp, err := client.R().SetContext(ctx).
+		SetQueryParam("force", "true").
+		SetFileReader("chart", name, bytes.NewReader(data)).
+		Post(url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != http.StatusCreated && resp.StatusCode() != http.StatusOK {
+		// chartmuseum explains a failure in the error field
+		var body struct {
+			Error string `json:"error"`
+		}
+		msg := resp.String()
+		if json.Unmarshal(resp.Body(), &body) == nil && body.Error != "" {
+			msg = body.Error
+		}
+		return &ChartRepoError{StatusCode: resp.StatusCode(), Message: msg}
+	}
+	return nil
+}
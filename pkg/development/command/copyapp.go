@@ -55,6 +55,12 @@ func (c *copyApp) Run(src, dstApp string) error {
 		}
 	}
 
+	// the git directory of an archive could carry hooks and config that run on the server,
+	// an app only has the repository devbox made for it
+	if err = os.RemoveAll(filepath.Join(src, ".git")); err != nil {
+		return err
+	}
+
 	srcChart, err := helm.LoadChart(src)
 	if err != nil {
 		klog.Errorf("failed to load chart from source %s, err=%v", src, err)
@@ -78,6 +84,19 @@ func (c *copyApp) Run(src, dstApp string) error {
 				}
 			}
 		}
+		// keep the git history of the app, the new chart becomes a change in it
+		gitDir, keptGitDir := filepath.Join(realPath, ".git"), realPath+".git"
+		if existDir(gitDir) {
+			err = os.Rename(gitDir, keptGitDir)
+			if err != nil {
+				return fmt.Errorf("failed to keep git dir of %s,err=%v", realPath, err)
+			}
+			defer func() {
+				if e := os.Rename(keptGitDir, gitDir); e != nil {
+					klog.Errorf("failed to restore git dir of %s, err=%v", realPath, e)
+				}
+			}()
+		}
 		err = os.RemoveAll(realPath)
 		if err != nil {
 			msg := fmt.Sprintf("failed to remove app chart path %s,err=%v", realPath, err)
@@ -16,6 +16,7 @@ import (
 	"github.com/beclab/oachecker"
 
 	jvalidator "github.com/go-playground/validator/v10"
+	"github.com/thoas/go-funk"
 	"helm.sh/helm/v3/pkg/chart"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -24,40 +25,50 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-var vendorGpuMap = map[string]string{
-	"nvidia": "nvidia.com/gpu",
-	"amd":    "amd.com/gpu",
-	"intel":  "gpu.intel.com/i915",
-}
-
 var validate = jvalidator.New()
 
 type CreateWithOneDockerConfig struct {
-	ID             string                       `json:"id"`
-	Title          string                       `json:"title"`
-	Name           string                       `json:"name" validate:"required,name"`
-	Container      CreateWithOneDockerContainer `json:"container"`
-	RequiredCpu    string                       `json:"requiredCpu" validate:"required,requiredCpu"`
-	LimitedCpu     string                       `json:"limitedCpu" validate:"limitedCpu"`
-	RequiredMemory string                       `json:"requiredMemory" validate:"required,requiredMemory"`
-	LimitedMemory  string                       `json:"limitedMemory" validate:"limitedMemory"`
-	RequiredDisk   string                       `json:"requiredDisk" validate:"requiredDisk"`
-	LimitedDisk    string                       `json:"limitedDisk" validate:"limitedDisk"`
-	RequiredGpu    bool                         `json:"requiredGpu"`
-	GpuVendor      string                       `json:"gpuVendor" validate:"gpuVendor"`
-	NeedPg         bool                         `json:"needPg"`
-	NeedRedis      bool                         `json:"needRedis"`
-	Env            map[string]string            `json:"env"`
-	Mounts         map[string]string            `json:"mounts"`
-	ExposePorts    string                       `json:"exposePorts"`
-	SshEnable      bool                         `json:"sshEnable"`
+	ID        string                       `json:"id"`
+	Title     string                       `json:"title"`
+	Name      string                       `json:"name" validate:"required,name"`
+	Container CreateWithOneDockerContainer `json:"container"`
+	// Containers run beside Container in the pod, InitContainers run to completion before
+	// them and Sidecars are started before them and kept running.
+	Containers     []CreateWithOneDockerContainer `json:"containers" validate:"dive"`
+	InitContainers []CreateWithOneDockerContainer `json:"initContainers" validate:"dive"`
+	Sidecars       []CreateWithOneDockerContainer `json:"sidecars" validate:"dive"`
+	RequiredCpu    string                         `json:"requiredCpu" validate:"required,requiredCpu"`
+	LimitedCpu     string                         `json:"limitedCpu" validate:"limitedCpu"`
+	RequiredMemory string                         `json:"requiredMemory" validate:"required,requiredMemory"`
+	LimitedMemory  string                         `json:"limitedMemory" validate:"limitedMemory"`
+	RequiredDisk   string                         `json:"requiredDisk" validate:"requiredDisk"`
+	LimitedDisk    string                         `json:"limitedDisk" validate:"limitedDisk"`
+	RequiredGpu    bool                           `json:"requiredGpu"`
+	GpuVendor      string                         `json:"gpuVendor" validate:"gpuVendor"`
+	NeedPg         bool                           `json:"needPg"`
+	NeedRedis      bool                           `json:"needRedis"`
+	Env            map[string]string              `json:"env"`
+	Mounts         map[string]string              `json:"mounts"`
+	ExposePorts    string                         `json:"exposePorts"`
+	SshEnable      bool                           `json:"sshEnable"`
 }
 
+// CreateWithOneDockerContainer is a container of the app. Container takes its resources from
+// CreateWithOneDockerConfig and adds its own env and mounts to the ones there.
 type CreateWithOneDockerContainer struct {
-	Image        string `json:"image" validate:"required,image"`
-	StartCmd     string `json:"startCmd"`
-	StartCmdArgs string `json:"startCmdArgs"`
-	Port         int    `json:"port"`
+	// Name defaults to the app name for Container and to one numbered after it for the others.
+	Name           string            `json:"name" validate:"containerName"`
+	Image          string            `json:"image" validate:"required,image"`
+	StartCmd       string            `json:"startCmd"`
+	StartCmdArgs   string            `json:"startCmdArgs"`
+	Port           int               `json:"port"`
+	Ports          []int             `json:"ports"`
+	Env            map[string]string `json:"env"`
+	Mounts         map[string]string `json:"mounts"`
+	RequiredCpu    string            `json:"requiredCpu" validate:"limitedCpu"`
+	LimitedCpu     string            `json:"limitedCpu" validate:"limitedCpu"`
+	RequiredMemory string            `json:"requiredMemory" validate:"limitedMemory"`
+	LimitedMemory  string            `json:"limitedMemory" validate:"limitedMemory"`
 }
 
 type CreateWithHelloConfig struct {
@@ -91,6 +102,141 @@ func (c *createWithOneDocker) Run(cfg *CreateWithOneDockerConfig, owner string)
 	return at.WriteDockerFile(cfg, appPath)
 }
 
+// containerResources are the requests and limits of a container, a zero quantity is not set.
+type containerResources struct {
+	requiredCPU    resource.Quantity
+	requiredMemory resource.Quantity
+	limitedCPU     resource.Quantity
+	limitedMemory  resource.Quantity
+}
+
+// newContainerResources parses the resources of a container, a limit is not less than
+// the request.
+func newContainerResources(requiredCpu, limitedCpu, requiredMemory, limitedMemory string) containerResources {
+	var r containerResources
+	r.requiredCPU, _ = resource.ParseQuantity(requiredCpu)
+	r.requiredMemory, _ = resource.ParseQuantity(requiredMemory)
+	r.limitedCPU, _ = resource.ParseQuantity(limitedCpu)
+	r.limitedMemory, _ = resource.ParseQuantity(limitedMemory)
+	if r.requiredCPU.Cmp(r.limitedCPU) > 0 {
+		r.limitedCPU = r.requiredCPU.DeepCopy()
+	}
+	if r.requiredMemory.Cmp(r.limitedMemory) > 0 {
+		r.limitedMemory = r.requiredMemory.DeepCopy()
+	}
+	return r
+}
+
+func (r *containerResources) add(o containerResources) {
+	r.requiredCPU.Add(o.requiredCPU)
+	r.requiredMemory.Add(o.requiredMemory)
+	r.limitedCPU.Add(o.limitedCPU)
+	r.limitedMemory.Add(o.limitedMemory)
+}
+
+func (r *containerResources) max(o containerResources) {
+	for _, q := range []struct{ dst, src *resource.Quantity }{
+		{&r.requiredCPU, &o.requiredCPU},
+		{&r.requiredMemory, &o.requiredMemory},
+		{&r.limitedCPU, &o.limitedCPU},
+		{&r.limitedMemory, &o.limitedMemory},
+	} {
+		if q.src.Cmp(*q.dst) > 0 {
+			*q.dst = q.src.DeepCopy()
+		}
+	}
+}
+
+func (r containerResources) requirements() corev1.ResourceRequirements {
+	requirements := corev1.ResourceRequirements{}
+	set := func(list *corev1.ResourceList, name corev1.ResourceName, q resource.Quantity) {
+		if q.IsZero() {
+			return
+		}
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[name] = q
+	}
+	set(&requirements.Requests, corev1.ResourceCPU, r.requiredCPU)
+	set(&requirements.Requests, corev1.ResourceMemory, r.requiredMemory)
+	set(&requirements.Limits, corev1.ResourceCPU, r.limitedCPU)
+	set(&requirements.Limits, corev1.ResourceMemory, r.limitedMemory)
+	return requirements
+}
+
+func (c *CreateWithOneDockerContainer) resources() containerResources {
+	limitedCpu, limitedMemory := c.LimitedCpu, c.LimitedMemory
+	if limitedCpu == "" {
+		limitedCpu = c.RequiredCpu
+	}
+	if limitedMemory == "" {
+		limitedMemory = c.RequiredMemory
+	}
+	return newContainerResources(c.RequiredCpu, limitedCpu, c.RequiredMemory, limitedMemory)
+}
+
+// sideContainers are the containers of the app besides the main one, with their names
+// defaulted.
+func (config *CreateWithOneDockerConfig) sideContainers() (containers, initContainers, sidecars []CreateWithOneDockerContainer) {
+	named := func(list []CreateWithOneDockerContainer, kind string) []CreateWithOneDockerContainer {
+		out := make([]CreateWithOneDockerContainer, len(list))
+		for i, c := range list {
+			if c.Name == "" {
+				c.Name = fmt.Sprintf("%s-%s%d", config.Name, kind, i+1)
+			}
+			out[i] = c
+		}
+		return out
+	}
+	return named(config.Containers, ""), named(config.InitContainers, "init-"), named(config.Sidecars, "sidecar-")
+}
+
+func (config *CreateWithOneDockerConfig) mainContainerName() string {
+	if config.Container.Name != "" {
+		return config.Container.Name
+	}
+	return config.Name
+}
+
+// allMounts are the mounts of every container of the app, by host path.
+func (config *CreateWithOneDockerConfig) allMounts() map[string]string {
+	mounts := make(map[string]string)
+	for hostPath, mountPath := range config.Mounts {
+		mounts[hostPath] = mountPath
+	}
+	containers := [][]CreateWithOneDockerContainer{{config.Container}, config.Containers, config.InitContainers, config.Sidecars}
+	for _, list := range containers {
+		for _, c := range list {
+			for hostPath, mountPath := range c.Mounts {
+				mounts[hostPath] = mountPath
+			}
+		}
+	}
+	return mounts
+}
+
+// totalResources are the resources of the pod of the app: the running containers and
+// sidecars together, or an init container with the sidecars if it takes more.
+func (config *CreateWithOneDockerConfig) totalResources(main containerResources) containerResources {
+	containers, initContainers, sidecars := config.sideContainers()
+	var side containerResources
+	for _, c := range sidecars {
+		side.add(c.resources())
+	}
+	total := main
+	total.add(side)
+	for _, c := range containers {
+		total.add(c.resources())
+	}
+	for _, c := range initContainers {
+		init := c.resources()
+		init.add(side)
+		total.max(init)
+	}
+	return total
+}
+
 func (at *AppTemplate) checkMountPath(mounts map[string]string, prefix string) bool {
 
 	for key := range mounts {
@@ -128,12 +274,13 @@ func (at *AppTemplate) WithDockerCfg(config *CreateWithOneDockerConfig) *AppTemp
 		},
 	}
 
-	appcfg.Permission.AppData = at.checkMountPath(config.Mounts, "/app/data/")
-	appcfg.Permission.AppCache = at.checkMountPath(config.Mounts, "/app/cache/")
+	mounts := config.allMounts()
+	appcfg.Permission.AppData = at.checkMountPath(mounts, "/app/data/")
+	appcfg.Permission.AppCache = at.checkMountPath(mounts, "/app/cache/")
 	//  {{ .Values.sharedlib }}
 	appcfg.Permission.UserData = make([]string, 0)
-	if at.checkMountPath(config.Mounts, "/Home/") {
-		for key := range config.Mounts {
+	if at.checkMountPath(mounts, "/Home/") {
+		for key := range mounts {
 			if strings.HasPrefix(key, "/Home/") {
 				appcfg.Permission.UserData = append(appcfg.Permission.UserData, key)
 			}
@@ -235,6 +382,14 @@ func (at *AppTemplate) WithDockerCfg(config *CreateWithOneDockerConfig) *AppTemp
 	if requiredMemory.Cmp(limitedMemory) > 0 {
 		appcfg.Spec.LimitedMemory = appcfg.Spec.RequiredMemory
 	}
+	if len(config.Containers)+len(config.InitContainers)+len(config.Sidecars) > 0 {
+		total := config.totalResources(newContainerResources(appcfg.Spec.RequiredCPU, appcfg.Spec.LimitedCPU,
+			appcfg.Spec.RequiredMemory, appcfg.Spec.LimitedMemory))
+		appcfg.Spec.RequiredCPU = total.requiredCPU.String()
+		appcfg.Spec.RequiredMemory = total.requiredMemory.String()
+		appcfg.Spec.LimitedCPU = total.limitedCPU.String()
+		appcfg.Spec.LimitedMemory = total.limitedMemory.String()
+	}
 	deps := []oachecker.Dependency{
 		{
 			Name:    "olares",
@@ -249,10 +404,14 @@ func (at *AppTemplate) WithDockerCfg(config *CreateWithOneDockerConfig) *AppTemp
 
 func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *AppTemplate {
 	replicas := int32(1)
-	requestCPU, _ := resource.ParseQuantity(at.appCfg.Spec.RequiredCPU)
-	requestMemory, _ := resource.ParseQuantity(at.appCfg.Spec.RequiredMemory)
-	limitedCPU, _ := resource.ParseQuantity(at.appCfg.Spec.LimitedCPU)
-	limitedMemory, _ := resource.ParseQuantity(at.appCfg.Spec.LimitedMemory)
+	limitedCpu, limitedMemory := config.LimitedCpu, config.LimitedMemory
+	if limitedCpu == "" {
+		limitedCpu = config.RequiredCpu
+	}
+	if limitedMemory == "" {
+		limitedMemory = config.RequiredMemory
+	}
+	main := newContainerResources(config.RequiredCpu, limitedCpu, config.RequiredMemory, limitedMemory)
 
 	deployment := appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
@@ -287,18 +446,18 @@ func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							Name:  config.Name,
+							Name:  config.mainContainerName(),
 							Image: config.Container.Image,
 							//Command: []string{config.Container.StartCmd},
 							//Args:    []string{config.Container.StartCmdArgs},
 							Resources: corev1.ResourceRequirements{
 								Requests: map[corev1.ResourceName]resource.Quantity{
-									corev1.ResourceCPU:    requestCPU,
-									corev1.ResourceMemory: requestMemory,
+									corev1.ResourceCPU:    main.requiredCPU,
+									corev1.ResourceMemory: main.requiredMemory,
 								},
 								Limits: map[corev1.ResourceName]resource.Quantity{
-									corev1.ResourceCPU:    limitedCPU,
-									corev1.ResourceMemory: limitedMemory,
+									corev1.ResourceCPU:    main.limitedCPU,
+									corev1.ResourceMemory: main.limitedMemory,
 								},
 							},
 						},
@@ -315,7 +474,7 @@ func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *
 		deployment.Spec.Template.Spec.Containers[0].Args = []string{config.Container.StartCmdArgs}
 	}
 	if config.RequiredGpu && len(config.GpuVendor) > 0 {
-		limitKey := corev1.ResourceName(vendorGpuMap[config.GpuVendor])
+		limitKey := corev1.ResourceName(constants.GpuVendorResources[config.GpuVendor])
 		deployment.Spec.Template.Spec.Containers[0].Resources.Limits[limitKey] = func() resource.Quantity {
 			gpu, _ := resource.ParseQuantity("1")
 			return gpu
@@ -345,6 +504,11 @@ func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *
 	ports = append(ports, corev1.ContainerPort{
 		ContainerPort: int32(config.Container.Port),
 	})
+	for _, port := range config.Container.containerPorts() {
+		if port != config.Container.Port {
+			ports = append(ports, corev1.ContainerPort{ContainerPort: int32(port)})
+		}
+	}
 
 	deployment.Spec.Template.Spec.Containers[0].Ports = ports
 
@@ -362,8 +526,6 @@ func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *
 			Value: "Etc/UTC",
 		},
 	}
-	envMap := make(map[string]int)
-
 	if config.NeedPg {
 		postgresEnv := []corev1.EnvVar{
 			{
@@ -410,42 +572,82 @@ func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *
 		}
 		env = append(env, redisEnv...)
 	}
-	for i, e := range env {
-		envMap[e.Name] = i
-	}
-	if config.Env != nil {
-		for name, value := range config.Env {
-			if idx, exists := envMap[name]; exists {
-				env[idx].Value = value
-			} else {
-				env = append(env, corev1.EnvVar{Name: name, Value: value})
-			}
-		}
-	}
-	deployment.Spec.Template.Spec.Containers[0].Env = env
-
-	volumeMounts := make([]corev1.VolumeMount, 0)
+	// every container gets the env of the middlewares, the env of the config is the main one's
+	baseEnv := append([]corev1.EnvVar{}, env...)
+	deployment.Spec.Template.Spec.Containers[0].Env = mergeEnv(mergeEnv(env, config.Env), config.Container.Env)
 
 	volumes := make([]corev1.Volume, 0)
+	volumeNames := make(map[string]bool)
 	t := corev1.HostPathDirectoryOrCreate
+	volumeMounts := func(mounts map[string]string) []corev1.VolumeMount {
+		volumeMounts := make([]corev1.VolumeMount, 0)
+		for hostPath, mountPath := range mounts {
+			name := formatPathToVolumeName(hostPath)
+			volumeMounts = append(volumeMounts, corev1.VolumeMount{
+				Name:      name,
+				MountPath: mountPath,
+			})
+			if volumeNames[name] {
+				continue
+			}
+			volumeNames[name] = true
+			volumes = append(volumes, corev1.Volume{
+				Name: name,
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Type: &t,
+						Path: replacePath(hostPath, config.Name),
+					},
+				},
+			})
+		}
+		if len(volumeMounts) == 0 {
+			return nil
+		}
+		return volumeMounts
+	}
 
+	mainMounts := make(map[string]string)
 	for hostPath, mountPath := range config.Mounts {
-		volumeMounts = append(volumeMounts, corev1.VolumeMount{
-			Name:      formatPathToVolumeName(hostPath),
-			MountPath: mountPath,
-		})
-		volumes = append(volumes, corev1.Volume{
-			Name: formatPathToVolumeName(hostPath),
-			VolumeSource: corev1.VolumeSource{
-				HostPath: &corev1.HostPathVolumeSource{
-					Type: &t,
-					Path: replacePath(hostPath, config.Name),
-				},
-			},
-		})
+		mainMounts[hostPath] = mountPath
+	}
+	for hostPath, mountPath := range config.Container.Mounts {
+		mainMounts[hostPath] = mountPath
+	}
+	deployment.Spec.Template.Spec.Containers[0].VolumeMounts = volumeMounts(mainMounts)
+
+	sideContainer := func(c CreateWithOneDockerContainer) corev1.Container {
+		container := corev1.Container{
+			Name:         c.Name,
+			Image:        c.Image,
+			Env:          mergeEnv(baseEnv, c.Env),
+			VolumeMounts: volumeMounts(c.Mounts),
+			Resources:    c.resources().requirements(),
+		}
+		if len(c.StartCmd) > 0 {
+			container.Command = ParseCommand(c.StartCmd)
+		}
+		if len(c.StartCmdArgs) > 0 {
+			container.Args = []string{c.StartCmdArgs}
+		}
+		for _, port := range c.containerPorts() {
+			container.Ports = append(container.Ports, corev1.ContainerPort{ContainerPort: int32(port)})
+		}
+		return container
+	}
+	containers, initContainers, sidecars := config.sideContainers()
+	for _, c := range containers {
+		deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers, sideContainer(c))
+	}
+	for _, c := range initContainers {
+		deployment.Spec.Template.Spec.InitContainers = append(deployment.Spec.Template.Spec.InitContainers, sideContainer(c))
 	}
-	if len(volumeMounts) > 0 {
-		deployment.Spec.Template.Spec.Containers[0].VolumeMounts = volumeMounts
+	// sidecars are init containers that are kept running, they are started in order before the others
+	always := corev1.ContainerRestartPolicyAlways
+	for _, c := range sidecars {
+		container := sideContainer(c)
+		container.RestartPolicy = &always
+		deployment.Spec.Template.Spec.InitContainers = append(deployment.Spec.Template.Spec.InitContainers, container)
 	}
 
 	if len(volumes) > 0 {
@@ -455,6 +657,35 @@ func (at *AppTemplate) WithDockerDeployment(config *CreateWithOneDockerConfig) *
 	return at
 }
 
+// mergeEnv returns env with the values of overrides, a variable that is already in env is replaced.
+func mergeEnv(env []corev1.EnvVar, overrides map[string]string) []corev1.EnvVar {
+	merged := append([]corev1.EnvVar{}, env...)
+	envMap := make(map[string]int)
+	for i, e := range merged {
+		envMap[e.Name] = i
+	}
+	for name, value := range overrides {
+		if idx, exists := envMap[name]; exists {
+			merged[idx].Value = value
+		} else {
+			envMap[name] = len(merged)
+			merged = append(merged, corev1.EnvVar{Name: name, Value: value})
+		}
+	}
+	return merged
+}
+
+// containerPorts are the distinct ports a container serves on.
+func (c *CreateWithOneDockerContainer) containerPorts() []int {
+	ports := make([]int, 0, len(c.Ports)+1)
+	for _, port := range append([]int{c.Port}, c.Ports...) {
+		if port > 0 && !funk.ContainsInt(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
 func (at *AppTemplate) WithDockerService(config *CreateWithOneDockerConfig) *AppTemplate {
 	service := corev1.Service{
 		TypeMeta: metav1.TypeMeta{
@@ -483,6 +714,31 @@ func (at *AppTemplate) WithDockerService(config *CreateWithOneDockerConfig) *App
 		Port:       int32(config.Container.Port),
 		TargetPort: intstr.Parse(strconv.Itoa(config.Container.Port)),
 	})
+	// the ports of the other running containers, init containers are done before the service is used,
+	// and the dev and ssh ports are added below
+	served := []int{config.Container.Port}
+	for _, portStr := range strings.Split(config.ExposePorts, ",") {
+		if port, err := strconv.Atoi(portStr); err == nil {
+			served = append(served, port)
+		}
+	}
+	if config.SshEnable {
+		served = append(served, 22)
+	}
+	containers, _, sidecars := config.sideContainers()
+	for _, c := range append(append([]CreateWithOneDockerContainer{config.Container}, containers...), sidecars...) {
+		for _, port := range c.containerPorts() {
+			if funk.ContainsInt(served, port) {
+				continue
+			}
+			served = append(served, port)
+			ports = append(ports, corev1.ServicePort{
+				Name:       strconv.Itoa(port),
+				Port:       int32(port),
+				TargetPort: intstr.Parse(strconv.Itoa(port)),
+			})
+		}
+	}
 
 	for _, portStr := range strings.Split(config.ExposePorts, ",") {
 		port, err := strconv.Atoi(portStr)
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/yaml"
 )
 
@@ -35,3 +37,95 @@ func TestWithDockerAppCfg(t *testing.T) {
 	yml, _ := yaml.JSONToYAML(b)
 	fmt.Println(string(yml))
 }
+
+func TestWithDockerMultiContainer(t *testing.T) {
+	cfg := &CreateWithOneDockerConfig{
+		Name: "api",
+		Container: CreateWithOneDockerContainer{
+			Image: "beclab/api",
+			Port:  8080,
+			Ports: []int{9090},
+		},
+		Containers: []CreateWithOneDockerContainer{{
+			Image:          "beclab/worker",
+			StartCmd:       "worker --queue jobs",
+			Env:            map[string]string{"QUEUE": "jobs"},
+			Mounts:         map[string]string{"/app/data/jobs": "/jobs"},
+			RequiredCpu:    "500m",
+			RequiredMemory: "256Mi",
+		}},
+		InitContainers: []CreateWithOneDockerContainer{{
+			Name:           "migrate",
+			Image:          "beclab/api",
+			RequiredCpu:    "2",
+			RequiredMemory: "64Mi",
+		}},
+		Sidecars: []CreateWithOneDockerContainer{{
+			Image:          "beclab/proxy",
+			Port:           8080,
+			Ports:          []int{15000},
+			RequiredCpu:    "100m",
+			LimitedCpu:     "200m",
+			RequiredMemory: "32Mi",
+		}},
+		RequiredCpu:    "1",
+		RequiredMemory: "128Mi",
+		NeedRedis:      true,
+		Env:            map[string]string{"MODE": "api"},
+		Mounts:         map[string]string{"/app/data/jobs": "/data"},
+	}
+	assert.Empty(t, ValidateStruct(*cfg))
+
+	at := AppTemplate{}
+	at.WithDockerCfg(cfg).WithDockerDeployment(cfg).WithDockerService(cfg)
+
+	// 1 + 500m running beside the 100m sidecar, the 2 cpu migration takes more before them
+	assert.Equal(t, "2100m", at.appCfg.Spec.RequiredCPU)
+	assert.Equal(t, "416Mi", at.appCfg.Spec.RequiredMemory)
+	assert.Equal(t, "2200m", at.appCfg.Spec.LimitedCPU)
+	assert.True(t, at.appCfg.Permission.AppData)
+
+	spec := at.deployment.Spec.Template.Spec
+	assert.Len(t, spec.Containers, 2)
+	assert.Equal(t, "api", spec.Containers[0].Name)
+	assert.Equal(t, []corev1.ContainerPort{{ContainerPort: 8080}, {ContainerPort: 9090}}, spec.Containers[0].Ports)
+	assert.Contains(t, spec.Containers[0].Env, corev1.EnvVar{Name: "MODE", Value: "api"})
+
+	worker := spec.Containers[1]
+	assert.Equal(t, "api-1", worker.Name)
+	assert.Equal(t, []string{"worker", "--queue", "jobs"}, worker.Command)
+	assert.Contains(t, worker.Env, corev1.EnvVar{Name: "QUEUE", Value: "jobs"})
+	assert.Contains(t, worker.Env, corev1.EnvVar{Name: "REDIS_HOST", Value: "{{ .Values.redis.host }}"})
+	assert.NotContains(t, worker.Env, corev1.EnvVar{Name: "MODE", Value: "api"})
+	assert.Equal(t, "/jobs", worker.VolumeMounts[0].MountPath)
+	assert.Equal(t, "500m", worker.Resources.Limits.Cpu().String())
+	assert.Len(t, spec.Volumes, 1)
+
+	assert.Len(t, spec.InitContainers, 2)
+	assert.Equal(t, "migrate", spec.InitContainers[0].Name)
+	assert.Nil(t, spec.InitContainers[0].RestartPolicy)
+	assert.Equal(t, "api-sidecar-1", spec.InitContainers[1].Name)
+	assert.Equal(t, corev1.ContainerRestartPolicyAlways, *spec.InitContainers[1].RestartPolicy)
+
+	var ports []int32
+	for _, p := range at.services[0].Spec.Ports {
+		ports = append(ports, p.Port)
+	}
+	assert.Equal(t, []int32{8080, 9090, 15000}, ports)
+}
+
+func TestValidateContainerNames(t *testing.T) {
+	cfg := CreateWithOneDockerConfig{
+		Name:           "api",
+		Container:      CreateWithOneDockerContainer{Image: "nginx", Port: 80},
+		Containers:     []CreateWithOneDockerContainer{{Name: "api", Image: "nginx"}},
+		InitContainers: []CreateWithOneDockerContainer{{Name: "Init", Image: "nginx"}},
+		RequiredCpu:    "1",
+		RequiredMemory: "1Gi",
+	}
+	var tags []string
+	for _, e := range ValidateStruct(cfg) {
+		tags = append(tags, e.Tag)
+	}
+	assert.ElementsMatch(t, []string{"containerName", "uniqueContainerName"}, tags)
+}
@@ -0,0 +1,267 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beclab/devbox/pkg/constants"
+)
+
+const (
+	gitBranch  = "main"
+	gitRemote  = "origin"
+	helmIgnore = ".helmignore"
+)
+
+var gitRevision = regexp.MustCompile(`^[0-9A-Za-z._/~^]+$`)
+
+// GitCommit is a commit in the git history of an app.
+type GitCommit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+type gitRepo struct {
+	baseCommand
+}
+
+// Git runs git in an app directory, each app is a git repository of its own.
+func Git() *gitRepo {
+	return &gitRepo{baseCommand: *newBaseCommand()}
+}
+
+func (c *gitRepo) WithDir(dir string) *gitRepo {
+	c.baseCommand.withDir(dir)
+	return c
+}
+
+// gitConfig is passed to every git command. The repository of an app is edited by its users, so
+// hooks and the fsmonitor of its config never run, and remotes are not read from the local disk
+// of the server, such as the workspace of another user.
+var gitConfig = []string{
+	"-c", "core.hooksPath=/dev/null",
+	"-c", "core.fsmonitor=false",
+	"-c", "protocol.file.allow=never",
+}
+
+func (c *gitRepo) git(ctx context.Context, args ...string) (string, error) {
+	output, err := c.baseCommand.run(ctx, "git", append(append([]string{}, gitConfig...), args...)...)
+	if err != nil {
+		if out := strings.TrimSpace(output); out != "" {
+			return output, errors.New(out)
+		}
+		return output, err
+	}
+	return output, nil
+}
+
+// Init makes the app directory a git repository, it does nothing if it is one already.
+func (c *gitRepo) Init(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(c.dir, ".git")); err == nil {
+		return nil
+	}
+	_, err := c.git(ctx, "init", "-q", "-b", gitBranch)
+	return err
+}
+
+// studioDirs hold the git history and the studio settings of an app, they are
+// kept out of the packaged chart.
+var studioDirs = []string{".git/", constants.StudioDir + "/"}
+
+// ignoreStudioDirs adds the studio directories missing in .helmignore.
+func ignoreStudioDirs(dir string) error {
+	p := filepath.Join(dir, helmIgnore)
+	data, err := os.ReadFile(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ignored := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		ignored[strings.TrimSuffix(strings.TrimSpace(line), "/")] = true
+	}
+	changed := false
+	for _, d := range studioDirs {
+		if ignored[strings.TrimSuffix(d, "/")] {
+			continue
+		}
+		if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+			data = append(data, '\n')
+		}
+		data = append(data, d+"\n"...)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// Commit records every change of the app, it returns the new commit or an empty
+// hash if there is nothing to commit.
+func (c *gitRepo) Commit(ctx context.Context, author, message string) (string, error) {
+	if err := c.Init(ctx); err != nil {
+		return "", err
+	}
+	if err := ignoreStudioDirs(c.dir); err != nil {
+		return "", err
+	}
+	if _, err := c.git(ctx, "add", "-A"); err != nil {
+		return "", err
+	}
+	status, err := c.git(ctx, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(status) == "" {
+		return "", nil
+	}
+	_, err = c.git(ctx, "-c", "user.name="+author, "-c", "user.email="+author+"@olares",
+		"commit", "-q", "--no-verify", "-m", message)
+	if err != nil {
+		return "", err
+	}
+	hash, err := c.git(ctx, "rev-parse", "HEAD")
+	return strings.TrimSpace(hash), err
+}
+
+func (c *gitRepo) hasCommits(ctx context.Context) bool {
+	if _, err := os.Stat(filepath.Join(c.dir, ".git")); err != nil {
+		return false
+	}
+	_, err := c.git(ctx, "rev-parse", "--verify", "-q", "HEAD")
+	return err == nil
+}
+
+// Log returns the latest commits of the app, or of a file of it if path is not empty.
+func (c *gitRepo) Log(ctx context.Context, path string, limit int) ([]GitCommit, error) {
+	commits := make([]GitCommit, 0)
+	if !c.hasCommits(ctx) {
+		return commits, nil
+	}
+	args := []string{"log", "--format=%H%x1f%an%x1f%at%x1f%s", "-n", strconv.Itoa(limit)}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	output, err := c.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		sec, _ := strconv.ParseInt(fields[2], 10, 64)
+		commits = append(commits, GitCommit{Hash: fields[0], Author: fields[1], Time: time.Unix(sec, 0), Message: fields[3]})
+	}
+	return commits, nil
+}
+
+// Diff returns the unified diff of path between two commits, to empty compares with the working tree.
+func (c *gitRepo) Diff(ctx context.Context, from, to, path string) (string, error) {
+	args := []string{"diff", "--no-color"}
+	for _, rev := range []string{from, to} {
+		if rev == "" {
+			continue
+		}
+		if err := checkRevision(rev); err != nil {
+			return "", err
+		}
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	if path != "" {
+		args = append(args, path)
+	}
+	return c.git(ctx, args...)
+}
+
+// Restore brings path back to its content at commit and commits the change.
+func (c *gitRepo) Restore(ctx context.Context, author, commit, path string) (string, error) {
+	if err := checkRevision(commit); err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", errors.New("path to restore is required")
+	}
+	if _, err := c.git(ctx, "checkout", commit, "--", path); err != nil {
+		return "", err
+	}
+	return c.Commit(ctx, author, fmt.Sprintf("Restore %s to %s", path, shortHash(commit)))
+}
+
+// SetRemote points the remote of the app repository to url.
+func (c *gitRepo) SetRemote(ctx context.Context, url string) error {
+	if url == "" || strings.HasPrefix(url, "-") {
+		return fmt.Errorf("invalid remote url %q", url)
+	}
+	if err := c.Init(ctx); err != nil {
+		return err
+	}
+	if _, err := c.git(ctx, "remote", "get-url", gitRemote); err != nil {
+		_, err = c.git(ctx, "remote", "add", gitRemote, url)
+		return err
+	}
+	_, err := c.git(ctx, "remote", "set-url", gitRemote, url)
+	return err
+}
+
+// Mirror makes the directory a shallow clone of the default branch of url, a clone is reset
+// to the latest commit of the remote.
+func (c *gitRepo) Mirror(ctx context.Context, url string) error {
+	if url == "" || strings.HasPrefix(url, "-") {
+		return fmt.Errorf("invalid remote url %q", url)
+	}
+	if _, err := os.Stat(filepath.Join(c.dir, ".git")); err != nil {
+		if err = os.RemoveAll(c.dir); err != nil {
+			return err
+		}
+		if err = os.MkdirAll(c.dir, 0755); err != nil {
+			return err
+		}
+		_, err = c.git(ctx, "clone", "-q", "--depth", "1", "--", url, ".")
+		return err
+	}
+	if _, err := c.git(ctx, "fetch", "-q", "--depth", "1", "--", url); err != nil {
+		return err
+	}
+	_, err := c.git(ctx, "reset", "-q", "--hard", "FETCH_HEAD")
+	return err
+}
+
+func (c *gitRepo) Push(ctx context.Context) (string, error) {
+	return c.git(ctx, "push", gitRemote, "HEAD:refs/heads/"+gitBranch)
+}
+
+// Pull fast forwards the app to the remote, local changes are committed by the author first.
+func (c *gitRepo) Pull(ctx context.Context, author string) (string, error) {
+	if c.hasCommits(ctx) {
+		if _, err := c.Commit(ctx, author, "Save changes before pull"); err != nil {
+			return "", err
+		}
+	}
+	return c.git(ctx, "pull", "--ff-only", gitRemote, gitBranch)
+}
+
+func checkRevision(rev string) error {
+	if strings.HasPrefix(rev, "-") || !gitRevision.MatchString(rev) {
+		return fmt.Errorf("invalid revision %q", rev)
+	}
+	return nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	app := filepath.Join(dir, "app")
+	values := filepath.Join(app, "values.yaml")
+	assert.NoError(t, os.MkdirAll(app, 0755))
+	assert.NoError(t, os.WriteFile(values, []byte("replicas: 1\n"), 0644))
+
+	repo := Git().WithDir(app)
+	first, err := repo.Commit(ctx, "alice", "Create app")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first)
+	ignore, _ := os.ReadFile(filepath.Join(app, helmIgnore))
+	assert.Contains(t, string(ignore), ".git/")
+	assert.Contains(t, string(ignore), ".studio/")
+
+	hash, err := repo.Commit(ctx, "alice", "Nothing changed")
+	assert.NoError(t, err)
+	assert.Empty(t, hash)
+
+	assert.NoError(t, os.WriteFile(values, []byte("replicas: 2\n"), 0644))
+	diff, err := repo.Diff(ctx, "HEAD", "", "values.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "+replicas: 2")
+	_, err = repo.Commit(ctx, "bob", "Update values.yaml")
+	assert.NoError(t, err)
+
+	commits, err := repo.Log(ctx, "values.yaml", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, "bob", commits[0].Author)
+		assert.Equal(t, "Update values.yaml", commits[0].Message)
+	}
+
+	_, err = repo.Restore(ctx, "alice", first, "values.yaml")
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(values)
+	assert.Equal(t, "replicas: 1\n", string(data))
+	_, err = repo.Restore(ctx, "alice", "--orphan", "values.yaml")
+	assert.Error(t, err)
+
+	// hooks of the repository do not run
+	hooked := filepath.Join(dir, "hooked")
+	hook := filepath.Join(app, ".git", "hooks", "post-commit")
+	assert.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\ntouch "+hooked+"\n"), 0755))
+	assert.NoError(t, os.WriteFile(values, []byte("replicas: 3\n"), 0644))
+	_, err = repo.Commit(ctx, "alice", "Scale up")
+	assert.NoError(t, err)
+	assert.NoFileExists(t, hooked)
+	assert.NoError(t, os.Remove(hook))
+
+	// push to a bare repo and pull it into another workspace, a local path is not a
+	// remote an app may use unless it is allowed
+	remote := filepath.Join(dir, "remote.git")
+	assert.NoError(t, exec.Command("git", "init", "-q", "--bare", remote).Run())
+	assert.NoError(t, repo.SetRemote(ctx, remote))
+	_, err = repo.Push(ctx)
+	assert.Error(t, err)
+	defer func(config []string) { gitConfig = config }(gitConfig)
+	gitConfig = append(append([]string{}, gitConfig...), "-c", "protocol.file.allow=always")
+	_, err = repo.Push(ctx)
+	assert.NoError(t, err)
+
+	other := filepath.Join(dir, "other")
+	assert.NoError(t, os.MkdirAll(other, 0755))
+	clone := Git().WithDir(other)
+	assert.NoError(t, clone.SetRemote(ctx, remote))
+	_, err = clone.Pull(ctx, "bob")
+	assert.NoError(t, err)
+	commits, err = clone.Log(ctx, "", 10)
+	assert.NoError(t, err)
+	if assert.Len(t, commits, 4) {
+		assert.Equal(t, "Scale up", commits[0].Message)
+		assert.True(t, strings.HasPrefix(commits[1].Message, "Restore values.yaml"))
+	}
+}
@@ -2,19 +2,78 @@ package command
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
-	"k8s.io/klog/v2"
+	"github.com/beclab/devbox/pkg/constants"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/utils"
 
 	"github.com/beclab/oachecker"
+	"helm.sh/helm/v3/pkg/lint/rules"
+	"helm.sh/helm/v3/pkg/lint/support"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/klog/v2"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
 )
 
+// LintFinding is a problem lint found in the chart of an app, only findings of
+// error severity fail the lint.
+type LintFinding struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	File     string `json:"file,omitempty"`
+	// Path is the YAML path of the value in File, e.g. spec.supportArch
+	Path    string `json:"path,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// LintResult is the outcome of linting the chart of an app.
+type LintResult struct {
+	Passed   bool          `json:"passed"`
+	Findings []LintFinding `json:"findings"`
+}
+
+// LintError fails a lint with findings of error severity.
+type LintError struct {
+	Result *LintResult
+}
+
+func (e *LintError) Error() string {
+	msgs := make([]string, 0)
+	for _, f := range e.Result.Findings {
+		if f.Severity == SeverityError {
+			msgs = append(msgs, f.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// LintResultOf returns the lint result carried by err, nil if err is not a lint failure.
+func LintResultOf(err error) *LintResult {
+	var lintErr *LintError
+	if errors.As(err, &lintErr) {
+		return lintErr.Result
+	}
+	return nil
+}
+
 type lint struct {
 	checkChart
+	allowlist *SecurityAllowlist
 }
 
 func Lint() *lint {
-	return &lint{*newCheckChart()}
+	return &lint{checkChart: *newCheckChart()}
 }
 
 func (l *lint) WithDir(dir string) *lint {
@@ -22,18 +81,170 @@ func (l *lint) WithDir(dir string) *lint {
 	return l
 }
 
+// WithSecurityAllowlist adds the security checks of the pod specs to the lint, accepting the
+// risky settings of the allowlist. They are left out of a lint that gates a save or an import.
+func (l *lint) WithSecurityAllowlist(allowlist *SecurityAllowlist) *lint {
+	l.allowlist = allowlist
+	return l
+}
+
+// Run lints the chart, it returns a *LintError if a finding of error severity is found.
 func (l *lint) Run(ctx context.Context, owner, chart string) error {
+	result, err := l.Check(ctx, owner, chart)
+	if err != nil {
+		return err
+	}
+	if !result.Passed {
+		return &LintError{Result: result}
+	}
+	return nil
+}
+
+// Check lints the chart and returns every finding, err is only set if the chart could not be linted.
+func (l *lint) Check(ctx context.Context, owner, chart string) (*LintResult, error) {
 	chartPath := filepath.Join(l.baseCommand.dir, owner, chart)
 
-	err := oachecker.Lint(chartPath, oachecker.DefaultLintOptions().SkipSameVersion().WithOwner("owner").WithAdmin("admin"))
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	findings := helmLintFindings(chartPath)
+
+	ch, err := helm.LoadChart(chartPath)
 	if err != nil {
-		klog.Errorf("failed to lint chart path=%s with different owner and admin %v", chartPath, err)
-		return err
+		findings = append(findings, LintFinding{Severity: SeverityError, Rule: "chart-load", Message: err.Error()})
+		return NewLintResult(findings), nil
 	}
-	err = oachecker.Lint(chartPath, oachecker.DefaultLintOptions().SkipSameVersion().WithOwner("admin").WithAdmin("admin"))
+	err = helm.CheckDependencies(ch)
 	if err != nil {
-		klog.Errorf("failed to lint chart path=%s with same owner and admin %v", chartPath, err)
-		return err
+		klog.Errorf("failed to lint chart path=%s, %v", chartPath, err)
+		findings = append(findings, LintFinding{Severity: SeverityError, Rule: "chart-dependencies", File: "Chart.yaml", Path: "dependencies", Message: err.Error()})
 	}
-	return nil
+
+	seen := make(map[string]bool)
+	// lint with different owner and admin, then with the same owner and admin
+	for _, users := range [][2]string{{"owner", "admin"}, {"admin", "admin"}} {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		err = oachecker.Lint(chartPath, oachecker.DefaultLintOptions().SkipSameVersion().WithOwner(users[0]).WithAdmin(users[1]))
+		if err == nil {
+			continue
+		}
+		klog.Errorf("failed to lint chart path=%s with owner=%s and admin=%s %v", chartPath, users[0], users[1], err)
+		for _, e := range flattenErrors(err) {
+			if seen[e.Error()] {
+				continue
+			}
+			seen[e.Error()] = true
+			findings = append(findings, oacheckerFinding(chartPath, e))
+		}
+	}
+	rendered, renderFindings := renderForLint(chart, chartPath)
+	findings = append(findings, renderFindings...)
+	if rendered != nil && l.allowlist != nil {
+		findings = append(findings, SecurityFindings(rendered, l.allowlist)...)
+	}
+	findings = append(findings, customLintFindings(ctx, chartPath, rendered)...)
+	return NewLintResult(findings), nil
+}
+
+// renderForLint renders the chart with the fixture values, the checks of the pod specs
+// are skipped if it fails. A template failing to render is reported as a warning, the
+// templates are linted by oachecker.
+func renderForLint(app, chartPath string) (*helm.RenderResult, []LintFinding) {
+	findings := make([]LintFinding, 0)
+	ch, err := helm.LoadChart(chartPath)
+	if err != nil {
+		return nil, findings
+	}
+	values, err := helm.FixtureValues(chartPath, nil)
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "chart-render", File: constants.ValuesFixtureFileName, Message: err.Error()})
+		return nil, findings
+	}
+	devName := utils.DevName(app)
+	result, err := helm.RenderChart(ch, devName+"-owner", devName, values)
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "chart-render", Message: fmt.Sprintf("chart is not rendered: %v", err)})
+		return nil, findings
+	}
+	for _, e := range result.Errors {
+		findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "chart-render", File: e.Template, Line: e.Line, Message: e.Message})
+	}
+	return result, findings
+}
+
+// NewLintResult returns a result of the findings, it passes if none is an error.
+func NewLintResult(findings []LintFinding) *LintResult {
+	result := &LintResult{Passed: true, Findings: findings}
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			result.Passed = false
+		}
+	}
+	return result
+}
+
+// helmLintFindings runs the helm linters of Chart.yaml and values.yaml, the
+// templates are linted by oachecker.
+func helmLintFindings(chartPath string) []LintFinding {
+	linter := support.Linter{ChartDir: chartPath}
+	rules.Chartfile(&linter)
+	rules.ValuesWithOverrides(&linter, nil)
+
+	findings := make([]LintFinding, 0, len(linter.Messages))
+	for _, m := range linter.Messages {
+		f := LintFinding{Rule: "helm-chartfile", File: m.Path, Message: m.Err.Error()}
+		if m.Path == ValuesFile {
+			f.Rule = "helm-values"
+		}
+		switch m.Severity {
+		case support.ErrorSev:
+			f.Severity = SeverityError
+		case support.WarningSev:
+			f.Severity = SeverityWarning
+		default:
+			f.Severity = SeverityInfo
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// oacheckerFinding reports an error of oachecker against OlaresManifest.yaml, the struct
+// namespace of the field it names is replaced by the yaml path of the field.
+func oacheckerFinding(chartPath string, err error) LintFinding {
+	finding := LintFinding{Severity: SeverityError, Rule: "olares-manifest", File: constants.AppCfgFileName, Message: err.Error()}
+	m := oacheckerFieldRe.FindStringSubmatch(finding.Message)
+	if m == nil {
+		return finding
+	}
+	path, pointer, ok := manifestPath(strings.TrimPrefix(m[1], "."))
+	if !ok {
+		return finding
+	}
+	finding.Path = path
+	finding.Message = strings.ReplaceAll(finding.Message, m[0], path)
+	if data, err := os.ReadFile(filepath.Join(chartPath, constants.AppCfgFileName)); err == nil {
+		finding.Line = manifestLines(data)[pointer]
+	}
+	return finding
+}
+
+// flattenErrors splits joined and aggregated errors, so each becomes a finding.
+func flattenErrors(err error) []error {
+	var errs []error
+	switch e := err.(type) {
+	case utilerrors.Aggregate:
+		errs = e.Errors()
+	case interface{ Unwrap() []error }:
+		errs = e.Unwrap()
+	default:
+		return []error{err}
+	}
+	flat := make([]error, 0, len(errs))
+	for _, e := range errs {
+		flat = append(flat, flattenErrors(e)...)
+	}
+	return flat
 }
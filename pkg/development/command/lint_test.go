@@ -0,0 +1,64 @@
+package command
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	"github.com/stretchr/testify/assert"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestHelmLintFindings(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: not-semver\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ValuesFile), []byte("replicas: 1\n"), 0644))
+
+	result := NewLintResult(helmLintFindings(dir))
+	assert.False(t, result.Passed)
+	severities := map[string]string{}
+	for _, f := range result.Findings {
+		assert.Equal(t, "Chart.yaml", f.File)
+		assert.Equal(t, "helm-chartfile", f.Rule)
+		severities[f.Severity] = f.Message
+	}
+	assert.Contains(t, severities[SeverityError], "version")
+	assert.Contains(t, severities[SeverityInfo], "icon")
+
+	err := error(&LintError{Result: result})
+	assert.Equal(t, result, LintResultOf(errors.Join(errors.New("save failed"), err)))
+	assert.NotContains(t, err.Error(), "icon")
+
+	assert.True(t, NewLintResult([]LintFinding{{Severity: SeverityWarning, Message: "w"}}).Passed)
+}
+
+func TestFlattenErrors(t *testing.T) {
+	a, b, c := errors.New("a"), errors.New("b"), errors.New("c")
+	assert.Equal(t, []error{a, b, c}, flattenErrors(errors.Join(a, utilerrors.NewAggregate([]error{b, c}))))
+	assert.Equal(t, []error{a}, flattenErrors(a))
+}
+
+func TestOacheckerFinding(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, constants.AppCfgFileName), []byte(testManifest), 0644))
+
+	err := errors.New("Key: 'AppConfiguration.Spec.SupportArch' Error:Field validation for 'SupportArch' failed on the 'oneof' tag")
+	f := oacheckerFinding(dir, err)
+	assert.Equal(t, "olares-manifest", f.Rule)
+	assert.Equal(t, constants.AppCfgFileName, f.File)
+	assert.Equal(t, "spec.supportArch", f.Path)
+	assert.Equal(t, 19, f.Line)
+	assert.Equal(t, "Key: 'spec.supportArch' Error:Field validation for 'SupportArch' failed on the 'oneof' tag", f.Message)
+
+	f = oacheckerFinding(dir, errors.New("AppConfiguration.Entrances[1].AuthLevel is invalid"))
+	assert.Equal(t, "entrances[1].authLevel", f.Path)
+	assert.Equal(t, 14, f.Line)
+
+	// an error without a field is still reported against the manifest
+	f = oacheckerFinding(dir, errors.New("chart version mismatch"))
+	assert.Equal(t, constants.AppCfgFileName, f.File)
+	assert.Empty(t, f.Path)
+}
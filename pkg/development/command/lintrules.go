@@ -0,0 +1,336 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/constants"
+	"github.com/beclab/devbox/pkg/development/helm"
+
+	"github.com/beclab/oachecker"
+	"github.com/google/cel-go/cel"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// LintRulesFile holds the lint rules of the team, they run for every app along
+// with the rules of the app in .studio/lint-rules.yaml.
+var LintRulesFile = ""
+
+const (
+	// ruleCostLimit bounds the work one evaluation of a rule does, a rule over its
+	// budget is reported as failing instead of stalling the lint.
+	ruleCostLimit = 1000000
+	// ruleInterruptCheckFrequency is how many comprehension iterations run between
+	// checks of the lint context.
+	ruleInterruptCheckFrequency = 100
+)
+
+const (
+	// RuleScopeManifest checks OlaresManifest.yaml once, object is the manifest.
+	RuleScopeManifest = "manifest"
+	// RuleScopeEntrances checks each entrance of OlaresManifest.yaml.
+	RuleScopeEntrances = "entrances"
+	// RuleScopeResources checks each resource of the rendered chart.
+	RuleScopeResources = "resources"
+	// RuleScopeContainers checks each container and init container of the rendered chart,
+	// resource is the workload of the container.
+	RuleScopeContainers = "containers"
+)
+
+// LintRule is a check of the team, Expr is a CEL expression over object, resource
+// and manifest that is true if the object passes.
+//
+//	rules:
+//	- id: no-latest-tag
+//	  scope: containers
+//	  severity: warning
+//	  expr: '!object.image.endsWith(":latest")'
+//	  message: images must be pinned to a version
+type LintRule struct {
+	ID       string `json:"id"`
+	Scope    string `json:"scope"`
+	Severity string `json:"severity,omitempty"`
+	Expr     string `json:"expr"`
+	Message  string `json:"message"`
+}
+
+type lintRules struct {
+	Rules []LintRule `json:"rules"`
+}
+
+type compiledRule struct {
+	LintRule
+	program cel.Program
+}
+
+// lintTarget is what the rules check, the resources are only decoded if a rule needs them.
+type lintTarget struct {
+	manifest  map[string]interface{}
+	resources []lintResource
+}
+
+type lintResource struct {
+	template string
+	object   map[string]interface{}
+}
+
+// customLintFindings runs the lint rules of the team and the app against the chart in
+// chartPath, the resource rules check the rendered chart if it is not nil.
+func customLintFindings(ctx context.Context, chartPath string, rendered *helm.RenderResult) []LintFinding {
+	files := make([]string, 0, 2)
+	if LintRulesFile != "" {
+		files = append(files, LintRulesFile)
+	}
+	if _, err := os.Stat(filepath.Join(chartPath, constants.LintRulesFileName)); err == nil {
+		files = append(files, filepath.Join(chartPath, constants.LintRulesFileName))
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("resource", cel.DynType),
+		cel.Variable("manifest", cel.DynType),
+	)
+	if err != nil {
+		klog.Errorf("failed to create cel env %v", err)
+		return nil
+	}
+
+	findings := make([]LintFinding, 0)
+	rules := make([]compiledRule, 0)
+	ids := make(map[string]bool)
+	for _, f := range files {
+		name := f
+		if rel, err := filepath.Rel(chartPath, f); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		compiled, errs := loadLintRules(env, f)
+		for _, err := range errs {
+			// a broken rule is reported but does not block the app
+			findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "lint-rules", File: name, Message: err.Error()})
+		}
+		for _, r := range compiled {
+			if ids[r.ID] {
+				findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "lint-rules", File: name, Message: fmt.Sprintf("rule %s is already defined", r.ID)})
+				continue
+			}
+			ids[r.ID] = true
+			rules = append(rules, r)
+		}
+	}
+
+	target, targetFindings := newLintTarget(chartPath, rendered, rules)
+	findings = append(findings, targetFindings...)
+	for _, r := range rules {
+		findings = append(findings, r.check(ctx, target)...)
+	}
+	return findings
+}
+
+func loadLintRules(env *cel.Env, path string) ([]compiledRule, []error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, []error{err}
+	}
+	var file lintRules
+	if err = yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, []error{fmt.Errorf("parse lint rules: %v", err)}
+	}
+
+	rules := make([]compiledRule, 0, len(file.Rules))
+	errs := make([]error, 0)
+	for i, r := range file.Rules {
+		if r.ID == "" {
+			errs = append(errs, fmt.Errorf("rule %d has no id", i))
+			continue
+		}
+		switch r.Scope {
+		case RuleScopeManifest, RuleScopeEntrances, RuleScopeResources, RuleScopeContainers:
+		default:
+			errs = append(errs, fmt.Errorf("rule %s has unknown scope %q", r.ID, r.Scope))
+			continue
+		}
+		switch r.Severity {
+		case "":
+			r.Severity = SeverityError
+		case SeverityError, SeverityWarning, SeverityInfo:
+		default:
+			errs = append(errs, fmt.Errorf("rule %s has unknown severity %q", r.ID, r.Severity))
+			continue
+		}
+		ast, iss := env.Compile(r.Expr)
+		if iss.Err() != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %v", r.ID, iss.Err()))
+			continue
+		}
+		if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+			errs = append(errs, fmt.Errorf("rule %s: expression must be a bool, got %s", r.ID, t))
+			continue
+		}
+		program, err := env.Program(ast, cel.CostLimit(ruleCostLimit), cel.InterruptCheckFrequency(ruleInterruptCheckFrequency))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rule %s: %v", r.ID, err))
+			continue
+		}
+		rules = append(rules, compiledRule{LintRule: r, program: program})
+	}
+	return rules, errs
+}
+
+// newLintTarget reads the manifest of the app and decodes the resources of the rendered chart, if a rule needs them.
+func newLintTarget(chartPath string, rendered *helm.RenderResult, rules []compiledRule) (*lintTarget, []LintFinding) {
+	target := &lintTarget{}
+	findings := make([]LintFinding, 0)
+	decode := false
+	for _, r := range rules {
+		decode = decode || r.Scope == RuleScopeResources || r.Scope == RuleScopeContainers
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, constants.AppCfgFileName))
+	if err == nil {
+		var cfg *oachecker.AppConfiguration
+		cfg, err = oachecker.GetAppConfigurationFromContent(data, oachecker.WithOwner("owner"), oachecker.WithAdmin("admin"))
+		if err == nil {
+			target.manifest, err = toObject(cfg)
+		}
+	}
+	if err != nil {
+		findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "lint-rules", File: constants.AppCfgFileName, Message: fmt.Sprintf("manifest rules are skipped: %v", err)})
+	}
+	if !decode || rendered == nil {
+		return target, findings
+	}
+	for _, t := range rendered.Templates {
+		decoder := yamlutil.NewYAMLOrJSONDecoder(strings.NewReader(t.Manifest), 4096)
+		for {
+			obj := map[string]interface{}{}
+			if err := decoder.Decode(&obj); err != nil {
+				if err != io.EOF {
+					findings = append(findings, LintFinding{Severity: SeverityWarning, Rule: "lint-rules", File: t.Name, Message: fmt.Sprintf("resource rules are skipped: %v", err)})
+				}
+				break
+			}
+			if len(obj) > 0 {
+				target.resources = append(target.resources, lintResource{template: t.Name, object: obj})
+			}
+		}
+	}
+	return target, findings
+}
+
+// check evaluates the rule on each object of its scope, an evaluation stops once ctx is done.
+func (r *compiledRule) check(ctx context.Context, target *lintTarget) []LintFinding {
+	findings := make([]LintFinding, 0)
+	eval := func(file, path, subject string, object, resource interface{}) {
+		out, _, err := r.program.ContextEval(ctx, map[string]interface{}{
+			"object":   object,
+			"resource": resource,
+			"manifest": target.manifest,
+		})
+		msg := r.Message
+		if msg == "" {
+			msg = fmt.Sprintf("rule %s failed", r.ID)
+		}
+		if subject != "" {
+			msg = fmt.Sprintf("%s: %s", subject, msg)
+		}
+		if err != nil {
+			msg = fmt.Sprintf("%s (%v)", msg, err)
+		} else if pass, ok := out.Value().(bool); !ok {
+			msg = fmt.Sprintf("%s (expression is not a bool)", msg)
+		} else if pass {
+			return
+		}
+		findings = append(findings, LintFinding{Severity: r.Severity, Rule: r.ID, File: file, Path: path, Message: msg})
+	}
+
+	switch r.Scope {
+	case RuleScopeManifest:
+		if target.manifest != nil {
+			eval(constants.AppCfgFileName, "", "", target.manifest, nil)
+		}
+	case RuleScopeEntrances:
+		entrances, _ := target.manifest["entrances"].([]interface{})
+		for i, e := range entrances {
+			name, _ := e.(map[string]interface{})["name"].(string)
+			eval(constants.AppCfgFileName, fmt.Sprintf("entrances[%d]", i), "entrance "+name, e, nil)
+		}
+	case RuleScopeResources:
+		for _, res := range target.resources {
+			eval(res.template, "", resourceName(res.object), res.object, nil)
+		}
+	case RuleScopeContainers:
+		for _, res := range target.resources {
+			for _, c := range podContainers(res.object) {
+				name, _ := c.object["name"].(string)
+				eval(res.template, c.path, fmt.Sprintf("%s container %s", resourceName(res.object), name), c.object, res.object)
+			}
+		}
+	}
+	return findings
+}
+
+type podContainer struct {
+	path   string
+	object map[string]interface{}
+}
+
+// podContainers returns the containers of a pod or of the pod template of a workload.
+func podContainers(obj map[string]interface{}) []podContainer {
+	specPath := map[string][]string{
+		"Pod":     {"spec"},
+		"CronJob": {"spec", "jobTemplate", "spec", "template", "spec"},
+	}
+	fields, ok := specPath[fmt.Sprint(obj["kind"])]
+	if !ok {
+		fields = []string{"spec", "template", "spec"}
+	}
+	var spec interface{} = obj
+	for _, f := range fields {
+		m, ok := spec.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		spec = m[f]
+	}
+	podSpec, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	containers := make([]podContainer, 0)
+	for _, kind := range []string{"initContainers", "containers"} {
+		list, _ := podSpec[kind].([]interface{})
+		for i, c := range list {
+			if m, ok := c.(map[string]interface{}); ok {
+				containers = append(containers, podContainer{path: fmt.Sprintf("%s.%s[%d]", strings.Join(fields, "."), kind, i), object: m})
+			}
+		}
+	}
+	return containers
+}
+
+func resourceName(obj map[string]interface{}) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v %v", obj["kind"], metadata["name"])
+}
+
+// toObject converts v to the plain maps and slices CEL works with.
+func toObject(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	err = json.Unmarshal(data, &obj)
+	return obj, err
+}
@@ -0,0 +1,178 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	"github.com/google/cel-go/cel"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: docker.io/beclab/init:v1
+        resources:
+          limits:
+            memory: 64Mi
+      containers:
+      - name: web
+        image: nginx:latest
+`
+
+func TestCustomLintFindings(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, constants.StudioDir), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "templates", "deployment.yaml"), []byte(testDeployment), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, constants.AppCfgFileName), []byte("olaresManifest.version: '0.8.0'\n"), 0644))
+
+	team := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(team, []byte(`rules:
+- id: registry-prefix
+  scope: containers
+  expr: object.image.startsWith("docker.io/beclab/")
+  message: images must come from docker.io/beclab
+- id: resource-limits
+  scope: containers
+  severity: warning
+  expr: has(object.resources) && has(object.resources.limits)
+  message: containers must set resource limits
+`), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, constants.LintRulesFileName), []byte(`rules:
+- id: no-latest-tag
+  scope: containers
+  severity: info
+  expr: '!object.image.endsWith(":latest")'
+  message: images must be pinned to a version
+- id: registry-prefix
+  scope: resources
+  expr: "true"
+- id: not-bool
+  scope: resources
+  expr: size(object)
+`), 0644))
+
+	LintRulesFile = team
+	defer func() { LintRulesFile = "" }()
+	rendered, renderFindings := renderForLint("app", dir)
+	assert.Empty(t, renderFindings)
+	findings := customLintFindings(context.Background(), dir, rendered)
+
+	byRule := map[string][]LintFinding{}
+	for _, f := range findings {
+		byRule[f.Rule] = append(byRule[f.Rule], f)
+	}
+	if assert.Len(t, byRule["registry-prefix"], 1) {
+		f := byRule["registry-prefix"][0]
+		assert.Equal(t, SeverityError, f.Severity)
+		assert.Equal(t, "templates/deployment.yaml", f.File)
+		assert.Equal(t, "spec.template.spec.containers[0]", f.Path)
+		assert.Equal(t, "Deployment web container web: images must come from docker.io/beclab", f.Message)
+	}
+	if assert.Len(t, byRule["resource-limits"], 1) {
+		assert.Equal(t, SeverityWarning, byRule["resource-limits"][0].Severity)
+	}
+	if assert.Len(t, byRule["no-latest-tag"], 1) {
+		assert.Equal(t, SeverityInfo, byRule["no-latest-tag"][0].Severity)
+	}
+	// the duplicated id and the expression that is not a bool are reported against the app rules
+	if assert.Len(t, byRule["lint-rules"], 2) {
+		for _, f := range byRule["lint-rules"] {
+			assert.Equal(t, SeverityWarning, f.Severity)
+			assert.Equal(t, constants.LintRulesFileName, f.File)
+		}
+	}
+}
+
+func TestLintRuleManifestScopes(t *testing.T) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType), cel.Variable("resource", cel.DynType), cel.Variable("manifest", cel.DynType))
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`rules:
+- id: entrance-icon
+  scope: entrances
+  expr: has(object.icon) && object.icon != ""
+  message: entrances must have an icon
+- id: has-title
+  scope: manifest
+  expr: manifest.metadata.title != ""
+`), 0644))
+	rules, errs := loadLintRules(env, path)
+	assert.Empty(t, errs)
+	assert.Len(t, rules, 2)
+
+	target := &lintTarget{manifest: map[string]interface{}{
+		"metadata": map[string]interface{}{"title": ""},
+		"entrances": []interface{}{
+			map[string]interface{}{"name": "web", "icon": "https://example.com/icon.png"},
+			map[string]interface{}{"name": "admin"},
+		},
+	}}
+	findings := rules[0].check(context.Background(), target)
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, "entrances[1]", findings[0].Path)
+		assert.Equal(t, "entrance admin: entrances must have an icon", findings[0].Message)
+	}
+	findings = rules[1].check(context.Background(), target)
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, constants.AppCfgFileName, findings[0].File)
+		assert.Equal(t, "rule has-title failed", findings[0].Message)
+	}
+}
+
+func TestLintRuleCostLimit(t *testing.T) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType), cel.Variable("resource", cel.DynType), cel.Variable("manifest", cel.DynType))
+	assert.NoError(t, err)
+	// seven nested loops over ten items are ten million iterations
+	expr := "true"
+	for i := 0; i < 7; i++ {
+		expr = fmt.Sprintf("[0, 1, 2, 3, 4, 5, 6, 7, 8, 9].all(x%d, %s)", i, expr)
+	}
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("rules:\n- id: expensive\n  scope: manifest\n  expr: %q\n", expr)), 0644))
+	rules, errs := loadLintRules(env, path)
+	assert.Empty(t, errs)
+	if !assert.Len(t, rules, 1) {
+		return
+	}
+
+	target := &lintTarget{manifest: map[string]interface{}{}}
+	findings := rules[0].check(context.Background(), target)
+	if assert.Len(t, findings, 1) {
+		assert.Contains(t, findings[0].Message, "cost limit exceeded")
+	}
+
+	// a cheap loop stops too once the lint is canceled
+	items := make([]string, 1000)
+	for i := range items {
+		items[i] = strconv.Itoa(i)
+	}
+	assert.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf("rules:\n- id: long\n  scope: manifest\n  expr: %q\n", "["+strings.Join(items, ", ")+"].all(x, x >= 0)")), 0644))
+	rules, errs = loadLintRules(env, path)
+	assert.Empty(t, errs)
+	if !assert.Len(t, rules, 1) {
+		return
+	}
+	assert.Empty(t, rules[0].check(context.Background(), target))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	findings = rules[0].check(ctx, target)
+	if assert.Len(t, findings, 1) {
+		assert.Contains(t, findings[0].Message, "interrupted")
+	}
+}
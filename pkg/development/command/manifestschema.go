@@ -0,0 +1,442 @@
+package command
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/beclab/devbox/pkg/constants"
+	"github.com/beclab/devbox/pkg/development/helm"
+
+	"github.com/beclab/oachecker"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"gopkg.in/yaml.v3"
+)
+
+const manifestSchemaURL = "https://olares.com/schemas/olares-manifest.json"
+
+// manifestSchemaEnums are the values a field accepts, keyed by the type and yaml name of the field.
+var manifestSchemaEnums = map[string][]string{
+	"Entrance.authLevel":  {"public", "private", "internal"},
+	"Entrance.openMethod": {"default", "iframe", "window"},
+	"AppSpec.supportArch": {"amd64", "arm64"},
+}
+
+var manifestSchemaRequired = map[string][]string{
+	"AppConfiguration": {"olaresManifest.version", "olaresManifest.type", "metadata"},
+	"AppMetaData":      {"name", "version"},
+	"Entrance":         {"name", "host", "port"},
+}
+
+var (
+	manifestSchemaOnce      sync.Once
+	manifestSchema          []byte
+	manifestSchemaValidator *jsonschema.Schema
+	manifestSchemaErr       error
+)
+
+// ManifestSchema returns the JSON Schema of OlaresManifest.yaml, generated from oachecker.AppConfiguration.
+func ManifestSchema() ([]byte, error) {
+	loadManifestSchema()
+	return manifestSchema, manifestSchemaErr
+}
+
+func loadManifestSchema() {
+	manifestSchemaOnce.Do(func() {
+		g := &schemaGenerator{defs: map[string]interface{}{}}
+		root := g.typeSchema(reflect.TypeOf(oachecker.AppConfiguration{}))
+		root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		root["$id"] = manifestSchemaURL
+		root["title"] = constants.AppCfgFileName
+		root["$defs"] = g.defs
+		manifestSchema, manifestSchemaErr = json.MarshalIndent(root, "", "  ")
+		if manifestSchemaErr != nil {
+			return
+		}
+
+		doc, err := jsonschema.UnmarshalJSON(strings.NewReader(string(manifestSchema)))
+		if err != nil {
+			manifestSchemaErr = err
+			return
+		}
+		c := jsonschema.NewCompiler()
+		if err = c.AddResource(manifestSchemaURL, doc); err != nil {
+			manifestSchemaErr = err
+			return
+		}
+		manifestSchemaValidator, manifestSchemaErr = c.Compile(manifestSchemaURL)
+	})
+}
+
+type schemaGenerator struct {
+	defs map[string]interface{}
+}
+
+var (
+	yamlUnmarshaler = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// a type decoding itself may accept anything
+	p := reflect.PointerTo(t)
+	if p.Implements(yamlUnmarshaler) || p.Implements(jsonUnmarshaler) || p.Implements(textUnmarshaler) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			// set first, so a recursive type refers to itself
+			g.defs[t.Name()] = map[string]interface{}{}
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, f := range manifestFields(t) {
+		s := g.typeSchema(f.Type)
+		if enum, ok := manifestSchemaEnums[t.Name()+"."+f.name]; ok {
+			if items, ok := s["items"].(map[string]interface{}); ok {
+				items["enum"] = enum
+			} else {
+				s["enum"] = enum
+			}
+		}
+		if d := f.Tag.Get("description"); d != "" {
+			s["description"] = d
+		}
+		properties[f.name] = s
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	required := make([]string, 0)
+	for _, name := range manifestSchemaRequired[t.Name()] {
+		if _, ok := properties[name]; ok {
+			required = append(required, name)
+		}
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+type manifestField struct {
+	reflect.StructField
+	name string
+}
+
+// manifestFields returns the fields of the struct by the name yaml decodes them from.
+func manifestFields(t reflect.Type) []manifestField {
+	fields := make([]manifestField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("yaml")
+		if !ok {
+			tag = f.Tag.Get("json")
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && (strings.Contains(opts, "inline") || (f.Anonymous && name == "")) {
+			fields = append(fields, manifestFields(ft)...)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, manifestField{StructField: f, name: name})
+	}
+	return fields
+}
+
+// oacheckerFieldRe matches the struct namespace oachecker reports a field by, e.g.
+// AppConfiguration.Entrances[0].AuthLevel.
+var oacheckerFieldRe = regexp.MustCompile(`\bAppConfiguration((?:\.[A-Za-z_]\w*(?:\[\d+\])?)+)`)
+
+// manifestPath maps the struct namespace of a field below oachecker.AppConfiguration, e.g.
+// Spec.SupportArch, to the path of the field in OlaresManifest.yaml and its JSON pointer,
+// ok is false if a field of the namespace is unknown.
+func manifestPath(namespace string) (path, pointer string, ok bool) {
+	t := reflect.TypeOf(oachecker.AppConfiguration{})
+	segments := strings.Split(namespace, ".")
+	paths := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		name, index, _ := strings.Cut(seg, "[")
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return "", "", false
+		}
+		var field *manifestField
+		for _, f := range manifestFields(t) {
+			if f.Name == name {
+				field = &f
+				break
+			}
+		}
+		if field == nil {
+			return "", "", false
+		}
+		p := field.name
+		pointer += "/" + field.name
+		t = field.Type
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if index != "" {
+			p += "[" + index
+			pointer += "/" + strings.TrimSuffix(index, "]")
+			if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+				t = t.Elem()
+			}
+		}
+		paths = append(paths, p)
+	}
+	return strings.Join(paths, "."), pointer, true
+}
+
+// manifestLines returns the line of each value of the manifest by its JSON pointer, it
+// is empty if the manifest is not yaml before it is rendered.
+func manifestLines(data []byte) map[string]int {
+	lines := map[string]int{}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err == nil {
+		manifestValue(&doc, reflect.TypeOf(oachecker.AppConfiguration{}), "", lines)
+	}
+	return lines
+}
+
+var yamlErrorLineRe = regexp.MustCompile(`line (\d+)`)
+
+// ValidateManifest renders data as OlaresManifest.yaml of the chart in chartPath and
+// checks it against the schema, the result has a finding for each invalid field. The line
+// of a finding is the one of the field in data, not in the rendered manifest.
+func ValidateManifest(chartPath string, data []byte) (*LintResult, error) {
+	loadManifestSchema()
+	if manifestSchemaErr != nil {
+		return nil, manifestSchemaErr
+	}
+	ch, err := helm.LoadChart(chartPath)
+	if err != nil {
+		return nil, err
+	}
+	values, err := helm.FixtureValues(chartPath, map[string]interface{}{"admin": "admin"})
+	if err != nil {
+		return nil, err
+	}
+
+	finding := func(path string, line int, msg string) LintFinding {
+		return LintFinding{Severity: SeverityError, Rule: "manifest-schema", File: constants.AppCfgFileName, Path: path, Line: line, Message: msg}
+	}
+	rendered, err := helm.RenderFile(ch, filepath.Base(constants.AppCfgFileName), data, values)
+	if err != nil {
+		return NewLintResult([]LintFinding{finding("", 0, err.Error())}), nil
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal([]byte(rendered), &doc); err != nil {
+		line := 0
+		if m := yamlErrorLineRe.FindStringSubmatch(err.Error()); m != nil {
+			line, _ = strconv.Atoi(m[1])
+		}
+		return NewLintResult([]LintFinding{finding("", sourceLine(data, rendered, line), err.Error())}), nil
+	}
+
+	// a field is found in data by its pointer if data is yaml before it is rendered, a
+	// field a template writes is found by the line it is rendered at
+	srcLines := manifestLines(data)
+	lines := map[string]int{}
+	instance := manifestValue(&doc, reflect.TypeOf(oachecker.AppConfiguration{}), "", lines)
+	err = manifestSchemaValidator.Validate(instance)
+	if err == nil {
+		return NewLintResult([]LintFinding{}), nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, err
+	}
+
+	p := message.NewPrinter(language.English)
+	findings := make([]LintFinding, 0)
+	for _, e := range leafErrors(verr) {
+		path := make([]string, 0, len(e.InstanceLocation))
+		for _, l := range e.InstanceLocation {
+			if _, err := strconv.Atoi(l); err == nil && len(path) > 0 {
+				path[len(path)-1] += "[" + l + "]"
+				continue
+			}
+			path = append(path, l)
+		}
+		loc := ""
+		if len(e.InstanceLocation) > 0 {
+			loc = "/" + strings.Join(e.InstanceLocation, "/")
+		}
+		line, ok := srcLines[loc]
+		if !ok {
+			line = sourceLine(data, rendered, lines[loc])
+		}
+		findings = append(findings, finding(strings.Join(path, "."), line, e.ErrorKind.LocalizedString(p)))
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return NewLintResult(findings), nil
+}
+
+// sourceLine maps a line of the rendered manifest to the line of data it is rendered from,
+// 0 if it is not found. The lines are matched in order, a line matches the same text or,
+// if a template wrote its value, the same key; the lines of template actions match none.
+func sourceLine(data []byte, rendered string, line int) int {
+	if line <= 0 {
+		return 0
+	}
+	src := strings.Split(string(data), "\n")
+	out := strings.Split(rendered, "\n")
+	next := 0
+	for i := 0; i < line && i < len(out); i++ {
+		text := strings.TrimRight(out[i], " \t\r")
+		if text == "" && i < line-1 {
+			// a blank line would match any blank line of data
+			continue
+		}
+		found := -1
+		for k := next; k < len(src) && found < 0; k++ {
+			s := strings.TrimRight(src[k], " \t\r")
+			if s == text || (yamlKey(s) != "" && yamlKey(s) == yamlKey(text)) {
+				found = k
+			}
+		}
+		if found < 0 {
+			if i == line-1 {
+				return 0
+			}
+			continue
+		}
+		if i == line-1 {
+			return found + 1
+		}
+		next = found + 1
+	}
+	return 0
+}
+
+// yamlKey returns the indented key of a yaml line up to the colon, empty if the line has no key.
+func yamlKey(line string) string {
+	key, _, ok := strings.Cut(line, ":")
+	if !ok || strings.Contains(key, "{{") || strings.TrimLeft(key, " -") == "" {
+		return ""
+	}
+	return key + ":"
+}
+
+func leafErrors(e *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(e.Causes) == 0 {
+		return []*jsonschema.ValidationError{e}
+	}
+	errs := make([]*jsonschema.ValidationError, 0)
+	for _, c := range e.Causes {
+		errs = append(errs, leafErrors(c)...)
+	}
+	return errs
+}
+
+// manifestValue converts the yaml node to the value validated against the schema, a
+// scalar is kept as a string if it is decoded into a string field, as yaml does. The
+// line of each value is recorded by its JSON pointer.
+func manifestValue(n *yaml.Node, t reflect.Type, loc string, lines map[string]int) interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	lines[loc] = n.Line
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return manifestValue(n.Content[0], t, loc, lines)
+	case yaml.MappingNode:
+		var fields map[string]reflect.Type
+		if t != nil && t.Kind() == reflect.Struct {
+			fields = map[string]reflect.Type{}
+			for _, f := range manifestFields(t) {
+				fields[f.name] = f.Type
+			}
+		}
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			var ft reflect.Type
+			if fields != nil {
+				ft = fields[key]
+			} else if t != nil && t.Kind() == reflect.Map {
+				ft = t.Elem()
+			}
+			m[key] = manifestValue(n.Content[i+1], ft, loc+"/"+key, lines)
+		}
+		return m
+	case yaml.SequenceNode:
+		var et reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			et = t.Elem()
+		}
+		list := make([]interface{}, 0, len(n.Content))
+		for i, c := range n.Content {
+			list = append(list, manifestValue(c, et, fmt.Sprintf("%s/%d", loc, i), lines))
+		}
+		return list
+	}
+
+	if t != nil && t.Kind() == reflect.String && n.Tag != "!!null" {
+		return n.Value
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return n.Value
+	}
+	return v
+}
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testManifest = `olaresManifest.version: '0.8.0'
+olaresManifest.type: app
+metadata:
+  name: {{ include "app.name" . }}
+  version: 0.0.1
+  title: {{ .Values.bfl.username }}
+entrances:
+- name: web
+  host: web
+  port: 8080
+  authLevel: private
+- name: admin
+  host: admin
+  authLevel: secret
+  openMethod: window
+spec:
+  requiredCpu: 1
+  supportArch:
+  - amd64
+  - riscv
+`
+
+func TestManifestSchema(t *testing.T) {
+	data, err := ManifestSchema()
+	assert.NoError(t, err)
+	var schema struct {
+		Defs map[string]struct {
+			Properties map[string]struct {
+				Enum  []string `json:"enum"`
+				Items struct {
+					Enum []string `json:"enum"`
+				} `json:"items"`
+			} `json:"properties"`
+			Required []string `json:"required"`
+		} `json:"$defs"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, manifestSchemaEnums["Entrance.authLevel"], schema.Defs["Entrance"].Properties["authLevel"].Enum)
+	assert.Equal(t, manifestSchemaEnums["Entrance.openMethod"], schema.Defs["Entrance"].Properties["openMethod"].Enum)
+	assert.Equal(t, manifestSchemaEnums["AppSpec.supportArch"], schema.Defs["AppSpec"].Properties["supportArch"].Items.Enum)
+	assert.Equal(t, []string{"name", "host", "port"}, schema.Defs["Entrance"].Required)
+}
+
+func TestValidateManifest(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.0.1\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "templates", "_helpers.tpl"), []byte(`{{- define "app.name" -}}app{{- end -}}`), 0644))
+
+	result, err := ValidateManifest(dir, []byte(testManifest))
+	assert.NoError(t, err)
+	assert.False(t, result.Passed)
+
+	byPath := map[string]LintFinding{}
+	for _, f := range result.Findings {
+		assert.Equal(t, "manifest-schema", f.Rule)
+		assert.Equal(t, constants.AppCfgFileName, f.File)
+		byPath[f.Path] = f
+	}
+	assert.Len(t, byPath, 3)
+	assert.Contains(t, byPath["entrances[1]"].Message, "port")
+	assert.Equal(t, 12, byPath["entrances[1]"].Line)
+	assert.Contains(t, byPath["entrances[1].authLevel"].Message, "private")
+	assert.Equal(t, 14, byPath["entrances[1].authLevel"].Line)
+	assert.Equal(t, 20, byPath["spec.supportArch[1]"].Line)
+
+	result, err = ValidateManifest(dir, []byte("olaresManifest.version: {{ .Values.missing.field }}\n"))
+	assert.NoError(t, err)
+	assert.False(t, result.Passed)
+	assert.Equal(t, "", result.Findings[0].Path)
+}
+
+func TestValidateManifestSourceLines(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.0.1\n"), 0644))
+
+	// the conditional is not rendered, the lines below it move up in the rendered manifest
+	manifest := `olaresManifest.version: '0.8.0'
+olaresManifest.type: app
+metadata:
+  name: app
+  version: 0.0.1
+{{- if eq .Values.bfl.username "nobody" }}
+  title: Nobody
+  description: |
+    an app of nobody
+    with two lines
+{{- end }}
+entrances:
+- name: web
+  host: web
+  port: 8080
+  authLevel: {{ .Values.bfl.username }}
+`
+	result, err := ValidateManifest(dir, []byte(manifest))
+	assert.NoError(t, err)
+	if assert.Len(t, result.Findings, 1) {
+		assert.Equal(t, "entrances[0].authLevel", result.Findings[0].Path)
+		assert.Equal(t, 16, result.Findings[0].Line)
+	}
+
+	// the template writes more lines than it takes, a manifest that is yaml before it
+	// is rendered is looked up by the path of the field
+	manifest = `olaresManifest.version: '0.8.0'
+olaresManifest.type: app
+metadata:
+  name: app
+  version: 0.0.1
+  description: '{{ list "line one" "line two" | toYaml | nindent 4 }}'
+entrances:
+- name: web
+  host: web
+  port: 8080
+  authLevel: secret
+`
+	result, err = ValidateManifest(dir, []byte(manifest))
+	assert.NoError(t, err)
+	if assert.Len(t, result.Findings, 1) {
+		assert.Equal(t, "entrances[0].authLevel", result.Findings[0].Path)
+		assert.Equal(t, 11, result.Findings[0].Line)
+	}
+}
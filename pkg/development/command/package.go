@@ -87,6 +87,14 @@ func (c *packageChart) compress(src string, buf io.Writer) error {
 			if e != nil {
 				return e
 			}
+			// the git history and the studio settings are not part of the chart
+			if fi.IsDir() && file != src {
+				for _, dir := range studioDirs {
+					if fi.Name() == strings.TrimSuffix(dir, "/") {
+						return filepath.SkipDir
+					}
+				}
+			}
 			// generate tar header
 			header, err := tar.FileInfoHeader(fi, file)
 			if err != nil {
@@ -0,0 +1,48 @@
+package command
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageSkipsStudioDirs(t *testing.T) {
+	dir := t.TempDir()
+	app := filepath.Join(dir, "alice", "demo")
+	for _, f := range []string{"Chart.yaml", "templates/deployment.yaml", ".git/config", constants.StudioDir + "/lint-rules.yaml"} {
+		p := filepath.Join(app, f)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, os.WriteFile(p, []byte("x"), 0644))
+	}
+
+	var buf bytes.Buffer
+	c := &packageChart{baseDir: dir}
+	assert.NoError(t, c.compress(app, &buf))
+
+	zr, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, h.Name)
+	}
+	assert.Contains(t, names, "demo/Chart.yaml")
+	assert.Contains(t, names, "demo/templates/deployment.yaml")
+	for _, name := range names {
+		assert.NotContains(t, name, ".git")
+		assert.NotContains(t, name, constants.StudioDir)
+	}
+}
@@ -0,0 +1,98 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/utils"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// ValuesFile is the values file of a chart, a values profile named dev is kept in values.dev.yaml.
+const ValuesFile = "values.yaml"
+
+var profileNameRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ValuesProfileFile returns the file name of a values profile.
+func ValuesProfileFile(profile string) string {
+	return "values." + profile + ".yaml"
+}
+
+// ValuesProfiles returns the names of the values profiles of the app.
+func ValuesProfiles(owner, app string) ([]string, error) {
+	entries, err := os.ReadDir(utils.GetAppPath(owner, app))
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]string, 0)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), "values.") || !strings.HasSuffix(e.Name(), ".yaml") {
+			continue
+		}
+		profile := strings.TrimSuffix(strings.TrimPrefix(e.Name(), "values."), ".yaml")
+		if profileNameRe.MatchString(profile) {
+			profiles = append(profiles, profile)
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
+
+// CheckValuesProfile returns an error if the app has no values profile named profile.
+func CheckValuesProfile(owner, app, profile string) error {
+	if !profileNameRe.MatchString(profile) {
+		return fmt.Errorf("invalid values profile name %q", profile)
+	}
+	_, err := os.Stat(filepath.Join(utils.GetAppPath(owner, app), ValuesProfileFile(profile)))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("values profile %s of app %s not found", profile, app)
+	}
+	return err
+}
+
+// ValuesProfile returns the values of a values profile of the app.
+func ValuesProfile(owner, app, profile string) (map[string]interface{}, error) {
+	err := CheckValuesProfile(owner, app, profile)
+	if err != nil {
+		return nil, err
+	}
+	return readValues(filepath.Join(utils.GetAppPath(owner, app), ValuesProfileFile(profile)))
+}
+
+// mergeValuesProfile merges a values profile into values.yaml of the chart in dir,
+// the values of the profile take precedence.
+func mergeValuesProfile(dir, profile string) error {
+	base, err := readValues(filepath.Join(dir, ValuesFile))
+	if err != nil {
+		return err
+	}
+	values, err := readValues(filepath.Join(dir, ValuesProfileFile(profile)))
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(chartutil.CoalesceTables(values, base))
+	if err != nil {
+		return err
+	}
+	klog.Infof("merge values profile %s into chart path=%s", profile, dir)
+	return os.WriteFile(filepath.Join(dir, ValuesFile), data, 0644)
+}
+
+func readValues(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values, err := chartutil.ReadValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", filepath.Base(path), err)
+	}
+	return values, nil
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+func TestMergeValuesProfile(t *testing.T) {
+	dir := t.TempDir()
+	base := "replicas: 1\nimage:\n  repository: nginx\n  tag: \"1.25\"\nfeatures:\n  debug: false\n"
+	profile := "replicas: 3\nimage:\n  tag: \"1.27\"\nfeatures:\n  debug: true\n  trace: true\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ValuesFile), []byte(base), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ValuesProfileFile("debug")), []byte(profile), 0644))
+
+	assert.NoError(t, mergeValuesProfile(dir, "debug"))
+
+	data, err := os.ReadFile(filepath.Join(dir, ValuesFile))
+	assert.NoError(t, err)
+	values := map[string]interface{}{}
+	assert.NoError(t, yaml.Unmarshal(data, &values))
+	assert.Equal(t, map[string]interface{}{
+		"replicas": float64(3),
+		"image":    map[string]interface{}{"repository": "nginx", "tag": "1.27"},
+		"features": map[string]interface{}{"debug": true, "trace": true},
+	}, values)
+
+	assert.Error(t, mergeValuesProfile(dir, "missing"))
+}
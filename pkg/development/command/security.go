@@ -0,0 +1,269 @@
+package command
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/development/helm"
+
+	"github.com/thoas/go-funk"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	SecurityPrivileged     = "privileged"
+	SecurityHostPath       = "host-path"
+	SecurityHostNetwork    = "host-network"
+	SecurityRunAsRoot      = "run-as-root"
+	SecurityResourceLimits = "resource-limits"
+	SecurityCapabilities   = "capabilities"
+)
+
+// dangerousCapabilities give a container about as much as privileged does.
+var dangerousCapabilities = map[corev1.Capability]bool{
+	"ALL": true, "SYS_ADMIN": true, "NET_ADMIN": true, "SYS_PTRACE": true, "SYS_MODULE": true,
+}
+
+// SecurityAllowlist accepts risky pod specs of an app. It is kept with the app record
+// rather than in the workspace, only the owner of the app changes it.
+//
+//	allow:
+//	- check: host-path
+//	  workload: Deployment/web
+//	  reason: reads the docker socket
+type SecurityAllowlist struct {
+	Allow []SecurityAllowance `json:"allow"`
+}
+
+// SecurityAllowance accepts the findings of a check, in a workload and container if they are set.
+type SecurityAllowance struct {
+	Check     string `json:"check"`
+	Workload  string `json:"workload,omitempty"`
+	Container string `json:"container,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+var securityChecks = []string{
+	SecurityPrivileged, SecurityHostPath, SecurityHostNetwork, SecurityRunAsRoot, SecurityResourceLimits, SecurityCapabilities,
+}
+
+// ParseSecurityAllowlist parses the allowlist stored with an app, it is empty if data is.
+func ParseSecurityAllowlist(data string) (*SecurityAllowlist, error) {
+	allowlist := &SecurityAllowlist{}
+	if err := yaml.UnmarshalStrict([]byte(data), allowlist); err != nil {
+		return nil, fmt.Errorf("parse security allowlist: %v", err)
+	}
+	return allowlist, allowlist.Validate()
+}
+
+// Validate checks that every allowance names a known check.
+func (a *SecurityAllowlist) Validate() error {
+	for i, allow := range a.Allow {
+		if !funk.ContainsString(securityChecks, allow.Check) {
+			return fmt.Errorf("allow[%d]: unknown check %q, must be one of %s", i, allow.Check, strings.Join(securityChecks, ", "))
+		}
+	}
+	return nil
+}
+
+// String returns the yaml the allowlist is stored as.
+func (a *SecurityAllowlist) String() string {
+	if len(a.Allow) == 0 {
+		return ""
+	}
+	data, err := yaml.Marshal(a)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (a *SecurityAllowlist) allowed(check, workload, container string) (SecurityAllowance, bool) {
+	for _, allow := range a.Allow {
+		if allow.Check == check && (allow.Workload == "" || allow.Workload == workload) &&
+			(allow.Container == "" || allow.Container == container) {
+			return allow, true
+		}
+	}
+	return SecurityAllowance{}, false
+}
+
+// SecurityFindings checks the pod specs of the rendered chart for privileged containers,
+// host paths, the host network, running as root, missing limits and added capabilities.
+// Host paths under the userspace of the values are not reported. A finding the allowlist
+// accepts is kept with info severity.
+func SecurityFindings(result *helm.RenderResult, allowlist *SecurityAllowlist) []LintFinding {
+	findings := make([]LintFinding, 0)
+	userspace := userspaceRoots(result.Values)
+	for _, t := range result.Templates {
+		objs, err := helm.DecodeManifest(t.Manifest)
+		if err != nil {
+			continue
+		}
+		for _, pod := range podSpecs(objs) {
+			pod.userspace = userspace
+			for _, f := range pod.findings() {
+				f.Rule = "security-" + f.check
+				f.File = t.Name
+				if allow, ok := allowlist.allowed(f.check, pod.workload, f.container); ok {
+					f.Severity = SeverityInfo
+					f.Message += ", allowed"
+					if allow.Reason != "" {
+						f.Message += ": " + allow.Reason
+					}
+				}
+				findings = append(findings, f.LintFinding)
+			}
+		}
+	}
+	return findings
+}
+
+type podSpecRef struct {
+	workload  string
+	path      string
+	spec      *corev1.PodSpec
+	userspace []string
+}
+
+type securityFinding struct {
+	LintFinding
+	check     string
+	container string
+}
+
+func podSpecs(objs []runtime.Object) []podSpecRef {
+	pods := make([]podSpecRef, 0)
+	for _, o := range objs {
+		switch obj := o.(type) {
+		case *appsv1.Deployment:
+			pods = append(pods, podSpecRef{workload: "Deployment/" + obj.Name, path: "spec.template.spec", spec: &obj.Spec.Template.Spec})
+		case *appsv1.StatefulSet:
+			pods = append(pods, podSpecRef{workload: "StatefulSet/" + obj.Name, path: "spec.template.spec", spec: &obj.Spec.Template.Spec})
+		case *appsv1.DaemonSet:
+			pods = append(pods, podSpecRef{workload: "DaemonSet/" + obj.Name, path: "spec.template.spec", spec: &obj.Spec.Template.Spec})
+		case *appsv1.ReplicaSet:
+			pods = append(pods, podSpecRef{workload: "ReplicaSet/" + obj.Name, path: "spec.template.spec", spec: &obj.Spec.Template.Spec})
+		case *batchv1.Job:
+			pods = append(pods, podSpecRef{workload: "Job/" + obj.Name, path: "spec.template.spec", spec: &obj.Spec.Template.Spec})
+		case *batchv1.CronJob:
+			pods = append(pods, podSpecRef{workload: "CronJob/" + obj.Name, path: "spec.jobTemplate.spec.template.spec", spec: &obj.Spec.JobTemplate.Spec.Template.Spec})
+		case *corev1.Pod:
+			pods = append(pods, podSpecRef{workload: "Pod/" + obj.Name, path: "spec", spec: &obj.Spec})
+		}
+	}
+	return pods
+}
+
+func (p *podSpecRef) findings() []securityFinding {
+	findings := make([]securityFinding, 0)
+	add := func(check, severity, container, path, msg string) {
+		findings = append(findings, securityFinding{
+			LintFinding: LintFinding{Severity: severity, Path: path, Message: p.workload + ": " + msg},
+			check:       check,
+			container:   container,
+		})
+	}
+
+	if p.spec.HostNetwork {
+		add(SecurityHostNetwork, SeverityError, "", p.path+".hostNetwork", "uses the host network")
+	}
+	for i, v := range p.spec.Volumes {
+		if v.HostPath != nil && !p.inUserspace(v.HostPath.Path) {
+			add(SecurityHostPath, SeverityError, "", fmt.Sprintf("%s.volumes[%d].hostPath", p.path, i),
+				fmt.Sprintf("mounts host path %s in volume %s", v.HostPath.Path, v.Name))
+		}
+	}
+
+	containers := func(kind string, list []corev1.Container) {
+		for i := range list {
+			c := &list[i]
+			path := fmt.Sprintf("%s.%s[%d]", p.path, kind, i)
+			name := "container " + c.Name
+			sc := c.SecurityContext
+			if sc != nil && sc.Privileged != nil && *sc.Privileged {
+				add(SecurityPrivileged, SeverityError, c.Name, path+".securityContext.privileged", name+" is privileged")
+			}
+			if sc != nil && sc.Capabilities != nil && len(sc.Capabilities.Add) > 0 {
+				severity := SeverityWarning
+				caps := make([]string, 0, len(sc.Capabilities.Add))
+				for _, c := range sc.Capabilities.Add {
+					if dangerousCapabilities[corev1.Capability(strings.ToUpper(strings.TrimPrefix(string(c), "CAP_")))] {
+						severity = SeverityError
+					}
+					caps = append(caps, string(c))
+				}
+				add(SecurityCapabilities, severity, c.Name, path+".securityContext.capabilities.add",
+					fmt.Sprintf("%s adds capabilities %s", name, strings.Join(caps, ", ")))
+			}
+			if user, nonRoot := p.runAsUser(sc); !nonRoot && (user == nil || *user == 0) {
+				msg := name + " may run as root, set runAsNonRoot or a runAsUser other than 0"
+				if user != nil {
+					msg = name + " runs as root"
+				}
+				add(SecurityRunAsRoot, SeverityWarning, c.Name, path+".securityContext", msg)
+			}
+			missing := make([]string, 0, 2)
+			for _, r := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				if _, ok := c.Resources.Limits[r]; !ok {
+					missing = append(missing, string(r))
+				}
+			}
+			if len(missing) > 0 {
+				add(SecurityResourceLimits, SeverityWarning, c.Name, path+".resources.limits",
+					fmt.Sprintf("%s has no %s limit", name, strings.Join(missing, " and ")))
+			}
+		}
+	}
+	containers("initContainers", p.spec.InitContainers)
+	containers("containers", p.spec.Containers)
+	return findings
+}
+
+// userspaceRoots are the directories of the data, the cache and the files of the user
+// app-service passes to the chart, an app mounts host paths under them.
+func userspaceRoots(values map[string]interface{}) []string {
+	userspace, _ := values["userspace"].(map[string]interface{})
+	roots := make([]string, 0, 3)
+	for _, key := range []string{"appData", "appCache", "userData"} {
+		if root, ok := userspace[key].(string); ok && strings.Trim(root, "/") != "" {
+			roots = append(roots, path.Clean(root))
+		}
+	}
+	return roots
+}
+
+func (p *podSpecRef) inUserspace(hostPath string) bool {
+	hostPath = path.Clean(hostPath)
+	for _, root := range p.userspace {
+		if hostPath == root || strings.HasPrefix(hostPath, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// runAsUser returns the user the container runs as and whether it must not run as root,
+// the security context of the container overrides the one of the pod.
+func (p *podSpecRef) runAsUser(sc *corev1.SecurityContext) (*int64, bool) {
+	var user *int64
+	nonRoot := false
+	if psc := p.spec.SecurityContext; psc != nil {
+		user = psc.RunAsUser
+		nonRoot = psc.RunAsNonRoot != nil && *psc.RunAsNonRoot
+	}
+	if sc != nil {
+		if sc.RunAsUser != nil {
+			user = sc.RunAsUser
+		}
+		if sc.RunAsNonRoot != nil {
+			nonRoot = *sc.RunAsNonRoot
+		}
+	}
+	return user, nonRoot && (user == nil || *user != 0)
+}
@@ -0,0 +1,193 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/development/helm"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const riskyDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  selector:
+    matchLabels:
+      app: web
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      hostNetwork: true
+      securityContext:
+        runAsUser: 1000
+      volumes:
+      - name: docker
+        hostPath:
+          path: /var/run/docker.sock
+      containers:
+      - name: web
+        image: nginx
+        securityContext:
+          privileged: true
+          capabilities:
+            add: ["NET_BIND_SERVICE"]
+        resources:
+          limits:
+            cpu: 100m
+      - name: admin
+        image: busybox
+        securityContext:
+          runAsUser: 0
+          capabilities:
+            add: ["SYS_ADMIN"]
+        resources:
+          limits:
+            cpu: 100m
+            memory: 64Mi
+`
+
+func TestSecurityFindings(t *testing.T) {
+	result := &helm.RenderResult{Templates: []helm.RenderedTemplate{{Name: "templates/deployment.yaml", Manifest: riskyDeployment}}}
+	findings := SecurityFindings(result, &SecurityAllowlist{})
+
+	byPath := map[string]LintFinding{}
+	for _, f := range findings {
+		assert.Equal(t, "templates/deployment.yaml", f.File)
+		byPath[f.Path] = f
+	}
+	assert.Len(t, findings, 7)
+	assert.Equal(t, LintFinding{Severity: SeverityError, Rule: "security-host-network", File: "templates/deployment.yaml",
+		Path: "spec.template.spec.hostNetwork", Message: "Deployment/web: uses the host network"}, byPath["spec.template.spec.hostNetwork"])
+	assert.Equal(t, "Deployment/web: mounts host path /var/run/docker.sock in volume docker", byPath["spec.template.spec.volumes[0].hostPath"].Message)
+	assert.Equal(t, SeverityError, byPath["spec.template.spec.containers[0].securityContext.privileged"].Severity)
+	assert.Equal(t, SeverityWarning, byPath["spec.template.spec.containers[0].securityContext.capabilities.add"].Severity)
+	assert.Equal(t, "Deployment/web: container web has no memory limit", byPath["spec.template.spec.containers[0].resources.limits"].Message)
+	assert.Equal(t, SeverityError, byPath["spec.template.spec.containers[1].securityContext.capabilities.add"].Severity)
+	assert.Equal(t, "Deployment/web: container admin runs as root", byPath["spec.template.spec.containers[1].securityContext"].Message)
+	assert.False(t, NewLintResult(findings).Passed)
+
+	allowlist, err := ParseSecurityAllowlist(`allow:
+- check: host-network
+- check: host-path
+  workload: Deployment/web
+  reason: reads the docker socket
+- check: privileged
+  container: web
+- check: capabilities
+  container: admin
+`)
+	assert.NoError(t, err)
+	findings = SecurityFindings(result, allowlist)
+	assert.True(t, NewLintResult(findings).Passed)
+	for _, f := range findings {
+		if f.Rule == "security-host-path" {
+			assert.Equal(t, SeverityInfo, f.Severity)
+			assert.Equal(t, "Deployment/web: mounts host path /var/run/docker.sock in volume docker, allowed: reads the docker socket", f.Message)
+		}
+	}
+
+	stored, err := ParseSecurityAllowlist(allowlist.String())
+	assert.NoError(t, err)
+	assert.Equal(t, allowlist, stored)
+
+	allowlist, err = ParseSecurityAllowlist("")
+	assert.NoError(t, err)
+	assert.Empty(t, allowlist.Allow)
+	assert.Empty(t, allowlist.String())
+
+	_, err = ParseSecurityAllowlist("allow:\n- check: host-pid\n")
+	assert.Error(t, err)
+}
+
+func TestSecurityFindingsUserspace(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  securityContext:
+    runAsNonRoot: true
+  volumes:
+  - name: data
+    hostPath:
+      path: /olares/userdata/appdata/web/db
+  - name: escape
+    hostPath:
+      path: /olares/userdata/appdata/../../etc
+  - name: home
+    hostPath:
+      path: /olares/userdata/Home
+  containers:
+  - name: web
+    image: nginx
+    resources:
+      limits:
+        cpu: 100m
+        memory: 64Mi
+`
+	values := map[string]interface{}{"userspace": map[string]interface{}{
+		"appData":  "/olares/userdata/appdata/",
+		"userData": "/olares/userdata/Home",
+	}}
+	result := &helm.RenderResult{Templates: []helm.RenderedTemplate{{Name: "templates/pod.yaml", Manifest: manifest}}, Values: values}
+	findings := SecurityFindings(result, &SecurityAllowlist{})
+	if assert.Len(t, findings, 1) {
+		assert.Equal(t, "spec.volumes[1].hostPath", findings[0].Path)
+	}
+}
+
+func TestSecurityOfGeneratedChart(t *testing.T) {
+	cfg := &CreateWithOneDockerConfig{
+		Name:           "web",
+		Container:      CreateWithOneDockerContainer{Image: "nginx", Port: 80},
+		RequiredCpu:    "100m",
+		RequiredMemory: "128Mi",
+		Mounts:         map[string]string{"/app/data/db": "/db", "/app/cache/tmp": "/tmp", "/Home/Documents": "/docs"},
+	}
+	dir := t.TempDir()
+	at := AppTemplate{}
+	at.WithDockerCfg(cfg).WithDockerDeployment(cfg).WithDockerService(cfg).WithDockerChartMetadata(cfg).WithDockerOwner(cfg)
+	assert.NoError(t, at.WriteDockerFile(cfg, filepath.Join(dir, "alice", cfg.Name)))
+
+	result, err := Lint().WithDir(dir).WithSecurityAllowlist(&SecurityAllowlist{}).Check(context.Background(), "alice", cfg.Name)
+	assert.NoError(t, err)
+	for _, f := range result.Findings {
+		if strings.HasPrefix(f.Rule, "security-") {
+			assert.NotEqual(t, SeverityError, f.Severity, f.Message)
+		}
+	}
+}
+
+func TestLintSecurityOnlyWithAllowlist(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "alice", "web")
+	assert.NoError(t, os.MkdirAll(filepath.Join(chart, "templates"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("apiVersion: v2\nname: web\nversion: 0.1.0\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "templates", "deployment.yaml"), []byte(riskyDeployment), 0644))
+
+	security := func(result *LintResult) int {
+		n := 0
+		for _, f := range result.Findings {
+			if strings.HasPrefix(f.Rule, "security-") {
+				n++
+			}
+		}
+		return n
+	}
+	// a lint gating a save or an import does not check the pod specs
+	result, err := Lint().WithDir(dir).Check(context.Background(), "alice", "web")
+	assert.NoError(t, err)
+	assert.Zero(t, security(result))
+
+	result, err = Lint().WithDir(dir).WithSecurityAllowlist(&SecurityAllowlist{}).Check(context.Background(), "alice", "web")
+	assert.NoError(t, err)
+	assert.NotZero(t, security(result))
+}
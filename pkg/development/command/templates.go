@@ -0,0 +1,290 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	TemplateSourceBuiltin = "builtin"
+	TemplateSourceDir     = "dir"
+	TemplateSourceGit     = "git"
+
+	templateFile     = "template.yaml"
+	templateChartDir = "chart"
+)
+
+//go:embed all:templates
+var builtinTemplates embed.FS
+
+var (
+	// TemplateDir holds the templates of the team, each in a directory of its name.
+	TemplateDir = ""
+	// TemplateRepo is a git repository of templates laid out as TemplateDir.
+	TemplateRepo = ""
+
+	// templateRepoDir is where TemplateRepo is cloned, it is fetched again after templateRepoTTL.
+	templateRepoDir     = filepath.Join(os.TempDir(), "devbox-templates")
+	templateRepoTTL     = 5 * time.Minute
+	templateRepoMu      sync.Mutex
+	templateRepoFetched time.Time
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Template scaffolds the chart of a new app. The files in its chart directory are Go
+// templates with [[ and ]] as delimiters, so the helm templates in them are kept, and
+// they are executed with TemplateData.
+type Template struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source"`
+	// Parameters is the JSON Schema of TemplateData.Params.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+
+	fsys fs.FS
+}
+
+// TemplateData is what the chart files of a template are executed with.
+type TemplateData struct {
+	Name   string
+	Title  string
+	Owner  string
+	Params map[string]interface{}
+}
+
+// Templates returns the built in templates and the ones of TemplateDir and TemplateRepo,
+// a template replaces one of the same name from a source before it.
+func Templates(ctx context.Context) ([]*Template, error) {
+	sources := []struct {
+		name string
+		fsys fs.FS
+	}{{TemplateSourceBuiltin, mustSub(builtinTemplates, "templates")}}
+	if TemplateDir != "" {
+		sources = append(sources, struct {
+			name string
+			fsys fs.FS
+		}{TemplateSourceDir, os.DirFS(TemplateDir)})
+	}
+	if TemplateRepo != "" {
+		if err := syncTemplateRepo(ctx); err != nil {
+			klog.Errorf("failed to fetch template repo %s, err=%v", TemplateRepo, err)
+		}
+		if _, err := os.Stat(templateRepoDir); err == nil {
+			sources = append(sources, struct {
+				name string
+				fsys fs.FS
+			}{TemplateSourceGit, os.DirFS(templateRepoDir)})
+		}
+	}
+
+	byName := make(map[string]*Template)
+	for _, s := range sources {
+		templates, err := loadTemplates(s.fsys, s.name)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range templates {
+			byName[t.Name] = t
+		}
+	}
+	list := make([]*Template, 0, len(byName))
+	for _, t := range byName {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// GetTemplate returns the template of the name, ErrTemplateNotFound if there is none.
+func GetTemplate(ctx context.Context, name string) (*Template, error) {
+	templates, err := Templates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// loadTemplates reads a template from each directory of fsys with a template.yaml,
+// a template that can not be read is skipped.
+func loadTemplates(fsys fs.FS, source string) ([]*Template, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]*Template, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(e.Name(), templateFile))
+		if err != nil {
+			continue
+		}
+		t := &Template{Name: e.Name(), Source: source, fsys: mustSub(fsys, e.Name())}
+		if err = yaml.Unmarshal(data, t); err != nil {
+			klog.Warningf("skip %s template %s, err=%v", source, e.Name(), err)
+			continue
+		}
+		t.Name, t.Source = e.Name(), source
+		if t.Title == "" {
+			t.Title = t.Name
+		}
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+func syncTemplateRepo(ctx context.Context) error {
+	templateRepoMu.Lock()
+	defer templateRepoMu.Unlock()
+	if time.Since(templateRepoFetched) < templateRepoTTL {
+		return nil
+	}
+	err := Git().WithDir(templateRepoDir).Mirror(ctx, TemplateRepo)
+	if err != nil {
+		return err
+	}
+	templateRepoFetched = time.Now()
+	return nil
+}
+
+// Params validates params against the parameters of the template, the default of a
+// parameter that is not set is filled in.
+func (t *Template) Params(params map[string]interface{}) (map[string]interface{}, error) {
+	filled := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		filled[k] = v
+	}
+	if t.Parameters == nil {
+		return filled, nil
+	}
+	properties, _ := t.Parameters["properties"].(map[string]interface{})
+	for name, p := range properties {
+		pm, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if d, ok := pm["default"]; ok {
+			if _, set := filled[name]; !set {
+				filled[name] = d
+			}
+		}
+	}
+
+	// the schema and the params are validated as JSON, as they are sent
+	schemaJSON, err := json.Marshal(t.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+	if err != nil {
+		return nil, err
+	}
+	c := jsonschema.NewCompiler()
+	url := "template:///" + t.Name + "/parameters.json"
+	if err = c.AddResource(url, doc); err != nil {
+		return nil, err
+	}
+	schema, err := c.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters of template %s: %v", t.Name, err)
+	}
+	paramsJSON, err := json.Marshal(filled)
+	if err != nil {
+		return nil, err
+	}
+	value, err := jsonschema.UnmarshalJSON(bytes.NewReader(paramsJSON))
+	if err != nil {
+		return nil, err
+	}
+	if err = schema.Validate(value); err != nil {
+		return nil, fmt.Errorf("invalid params: %v", err)
+	}
+	return filled, nil
+}
+
+// templateFuncs are the sprig functions without the ones reading the environment of
+// devbox, as helm leaves them out, a template from a repo must not read its secrets.
+func templateFuncs() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	delete(funcs, "env")
+	delete(funcs, "expandenv")
+	return funcs
+}
+
+// Instantiate writes the chart of the template into path, which must not exist.
+func (t *Template) Instantiate(path string, data TemplateData) (err error) {
+	if existDir(path) {
+		return os.ErrExist
+	}
+	data.Params, err = t.Params(data.Params)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(path)
+		}
+	}()
+
+	return fs.WalkDir(t.fsys, templateChartDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, templateChartDir), "/")
+		dest := filepath.Join(path, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+		// a symlink in a template from a repo could read a file of devbox outside of it
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s of template %s is not a regular file", rel, t.Name)
+		}
+		content, err := fs.ReadFile(t.fsys, name)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New(rel).Delims("[[", "]]").Funcs(templateFuncs()).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("parse %s of template %s: %v", rel, t.Name, err)
+		}
+		var out bytes.Buffer
+		if err = tmpl.Execute(&out, data); err != nil {
+			return fmt.Errorf("execute %s of template %s: %v", rel, t.Name, err)
+		}
+		return os.WriteFile(dest, out.Bytes(), 0644)
+	})
+}
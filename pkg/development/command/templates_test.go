@@ -0,0 +1,120 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinTemplates(t *testing.T) {
+	templates, err := Templates(context.Background())
+	assert.NoError(t, err)
+	var names []string
+	for _, tmpl := range templates {
+		assert.Equal(t, TemplateSourceBuiltin, tmpl.Source)
+		names = append(names, tmpl.Name)
+	}
+	assert.Contains(t, names, "hello-world")
+
+	_, err = GetTemplate(context.Background(), "nonexistent")
+	assert.True(t, errors.Is(err, ErrTemplateNotFound))
+}
+
+func TestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "hello-world", templateChartDir)
+	assert.NoError(t, os.MkdirAll(chart, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "hello-world", templateFile), []byte("title: Team hello\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: [[ .Name ]]\n"), 0644))
+	// a directory without template.yaml is not a template
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "docs"), 0755))
+
+	TemplateDir = dir
+	defer func() { TemplateDir = "" }()
+
+	tmpl, err := GetTemplate(context.Background(), "hello-world")
+	assert.NoError(t, err)
+	assert.Equal(t, TemplateSourceDir, tmpl.Source)
+	assert.Equal(t, "Team hello", tmpl.Title)
+
+	_, err = GetTemplate(context.Background(), "docs")
+	assert.True(t, errors.Is(err, ErrTemplateNotFound))
+}
+
+func TestTemplateInstantiate(t *testing.T) {
+	tmpl, err := GetTemplate(context.Background(), "hello-world")
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "demo")
+	err = tmpl.Instantiate(path, TemplateData{Name: "demo", Title: "Demo", Params: map[string]interface{}{"port": 8080}})
+	assert.NoError(t, err)
+
+	chart, err := os.ReadFile(filepath.Join(path, "Chart.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(chart), "name: demo")
+	deployment, err := os.ReadFile(filepath.Join(path, "templates", "deployment.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(deployment), "containerPort: 8080")
+	assert.Contains(t, string(deployment), "image: beclab/studio-app:1.0.0")
+	assert.Contains(t, string(deployment), "namespace: {{ .Release.Namespace }}")
+
+	assert.ErrorIs(t, tmpl.Instantiate(path, TemplateData{Name: "demo"}), os.ErrExist)
+}
+
+func TestTemplateInvalidParams(t *testing.T) {
+	tmpl, err := GetTemplate(context.Background(), "hello-world")
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "demo")
+	err = tmpl.Instantiate(path, TemplateData{Name: "demo", Params: map[string]interface{}{"port": 0}})
+	assert.Error(t, err)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTemplateNoEnv(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "leak", templateChartDir)
+	assert.NoError(t, os.MkdirAll(chart, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "leak", templateFile), []byte("title: Leak\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: [[ env \"HOME\" ]]\n"), 0644))
+
+	TemplateDir = dir
+	defer func() { TemplateDir = "" }()
+
+	tmpl, err := GetTemplate(context.Background(), "leak")
+	assert.NoError(t, err)
+	err = tmpl.Instantiate(filepath.Join(t.TempDir(), "demo"), TemplateData{Name: "demo"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `function "env" not defined`)
+	}
+}
+
+func TestTemplateSymlinkAndBoolProperty(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "link", templateChartDir)
+	assert.NoError(t, os.MkdirAll(chart, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "link", templateFile), []byte("title: Link\nparameters:\n  properties:\n    foo: true\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: [[ .Name ]]\n"), 0644))
+	assert.NoError(t, os.Symlink("/etc/passwd", filepath.Join(chart, "values.yaml")))
+
+	TemplateDir = dir
+	defer func() { TemplateDir = "" }()
+
+	tmpl, err := GetTemplate(context.Background(), "link")
+	assert.NoError(t, err)
+	_, err = tmpl.Params(nil)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "demo")
+	err = tmpl.Instantiate(path, TemplateData{Name: "demo"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "values.yaml of template link is not a regular file")
+	}
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -3,10 +3,8 @@ package command
 import (
 	"context"
 	"errors"
-	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/beclab/devbox/pkg/constants"
 	"github.com/beclab/devbox/pkg/development/helm"
@@ -17,10 +15,13 @@ import (
 
 type updateRepo struct {
 	baseCommand
+	beforePush func()
+	bump       VersionBump
+	profile    string
 }
 
 func UpdateRepo() *updateRepo {
-	return &updateRepo{*newBaseCommand()}
+	return &updateRepo{baseCommand: *newBaseCommand()}
 }
 
 func (c *updateRepo) WithDir(dir string) *updateRepo {
@@ -28,6 +29,24 @@ func (c *updateRepo) WithDir(dir string) *updateRepo {
 	return c
 }
 
+// WithBeforePush sets a hook called once the chart version is bumped, right before pushing it to the repo.
+func (c *updateRepo) WithBeforePush(fn func()) *updateRepo {
+	c.beforePush = fn
+	return c
+}
+
+// WithBump sets how the chart version is bumped, a patch release by default.
+func (c *updateRepo) WithBump(bump VersionBump) *updateRepo {
+	c.bump = bump
+	return c
+}
+
+// WithProfile sets the values profile merged into values.yaml of the pushed chart.
+func (c *updateRepo) WithProfile(profile string) *updateRepo {
+	c.profile = profile
+	return c
+}
+
 func (c *updateRepo) Run(ctx context.Context, owner, app string, notExist bool) (string, error) {
 	if app == "" {
 		return "", errors.New("repo path must be specified")
@@ -47,16 +66,14 @@ func (c *updateRepo) Run(ctx context.Context, owner, app string, notExist bool)
 		klog.Errorf("failed to get app=%s chart version %v", app, err)
 		return "", err
 	}
-	newVersion := version.IncPatch()
 	uploadChartVersion := version.String()
 	if !notExist {
-		uploadChartVersion = newVersion.String()
-		klog.Infof("uploadChartVersion to %s", uploadChartVersion)
-		err = helm.UpgradeChartVersion(chart, app, realPath, &newVersion)
+		newVersion, err := bumpChartVersion(chart, owner, app, realPath, c.bump)
 		if err != nil {
-			klog.Errorf("failed to upgrade chart version,app=%s,version=%s,err=%v", app, uploadChartVersion, err)
 			return "", err
 		}
+		uploadChartVersion = newVersion.String()
+		klog.Infof("uploadChartVersion to %s", uploadChartVersion)
 	}
 
 	backupAndRestoreFile := func(orig, bak string) (func(), error) {
@@ -104,14 +121,6 @@ func (c *updateRepo) Run(ctx context.Context, owner, app string, notExist bool)
 		return "", err
 	}
 
-	if !notExist {
-		err = helm.UpdateAppCfgVersion(owner, realPath, &newVersion)
-		if err != nil {
-			klog.Errorf("failed to update OlaresManifest.yaml metadata.version %v", err)
-			return "", err
-		}
-	}
-
 	appcfg := filepath.Join(realPath, constants.AppCfgFileName)
 	appcfgBak := filepath.Join(realPath, "OlaresManifest.yaml.bak")
 	appcfgDeferFunc, err := backupAndRestoreFile(appcfg, appcfgBak)
@@ -121,48 +130,51 @@ func (c *updateRepo) Run(ctx context.Context, owner, app string, notExist bool)
 	}
 	defer appcfgDeferFunc()
 
+	if c.profile != "" {
+		values := filepath.Join(realPath, ValuesFile)
+		if _, err = os.Stat(values); os.IsNotExist(err) {
+			err = os.WriteFile(values, nil, 0644)
+			if err != nil {
+				return "", err
+			}
+			defer os.Remove(values)
+		}
+		valuesDeferFunc, err := backupAndRestoreFile(values, filepath.Join(realPath, "values.yaml.bak"))
+		if err != nil {
+			klog.Errorf("failed to get values defer func %v", err)
+			return "", err
+		}
+		defer valuesDeferFunc()
+
+		err = mergeValuesProfile(realPath, c.profile)
+		if err != nil {
+			klog.Errorf("failed to merge values profile %s of app=%s, err=%v", c.profile, app, err)
+			return "", err
+		}
+	}
+
 	err = helm.UpdateAppCfgName(owner, app, realPath)
 	if err != nil {
 		klog.Errorf("failed to update app cfg name app=%s,path=%s,err=%v", app, realPath, err)
 		return "", err
 	}
 
-	output, err := c.baseCommand.run(ctx, "helm", "cm-push", "-f", fmt.Sprintf("--context-path=%s", owner), owner+"/"+app, "http://localhost:8888", "--debug")
+	if c.beforePush != nil {
+		c.beforePush()
+	}
+
+	_, err = PushChart(ctx, owner, realPath)
 	if err != nil {
-		if len(output) > 0 {
-			return "", errors.New(output)
-		}
+		klog.Errorf("failed to push chart app=%s to repo, err=%v", app, err)
 		return "", err
 	}
-	result := strings.Split(output, "\n")
-	if len(result) > 0 && result[len(result)-2] == "Done." {
-		if !notExist {
-			err = deleteOldTgz(owner, app+"-dev", newVersion.String())
-			if err != nil {
-				klog.Errorf("failed to delete chart repo old tgz %v", err)
-			}
+	if !notExist {
+		err = pruneChartVersions(owner, utils.DevName(app), uploadChartVersion, ChartRetention)
+		if err != nil {
+			klog.Errorf("failed to delete chart repo old tgz %v", err)
 		}
-
 	}
 	klog.Infof("update repo app %s, newVersion: %s", app, uploadChartVersion)
 	return uploadChartVersion, nil
 
 }
-
-func deleteOldTgz(owner, name, notDeleteVersion string) error {
-	chartVersions, err := getChartVersions(owner, name)
-	if err != nil {
-		return err
-	}
-	errs := make([]error, 0, len(chartVersions)-1)
-	for _, cv := range chartVersions {
-		if cv.Version == notDeleteVersion {
-			continue
-		}
-		err = deleteChartVersion(owner, name, cv.Version)
-		if err != nil {
-			errs = append(errs, err)
-		}
-	}
-	return AggregateErrs(errs)
-}
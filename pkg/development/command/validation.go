@@ -7,6 +7,7 @@ import (
 	refdocker "github.com/containerd/containerd/reference/docker"
 	jvalidator "github.com/go-playground/validator/v10"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 type ErrorResponse struct {
@@ -87,6 +88,30 @@ func validateImage(fl jvalidator.FieldLevel) bool {
 	return true
 }
 
+func validateContainerName(fl jvalidator.FieldLevel) bool {
+	value := fl.Field().String()
+	// containerName is optional field
+	if value == "" {
+		return true
+	}
+	return len(validation.IsDNS1123Label(value)) == 0
+}
+
+// validateContainers checks that the containers of an app have distinct names.
+func validateContainers(sl jvalidator.StructLevel) {
+	config := sl.Current().Interface().(CreateWithOneDockerConfig)
+	names := map[string]bool{config.mainContainerName(): true}
+	containers, initContainers, sidecars := config.sideContainers()
+	for _, list := range [][]CreateWithOneDockerContainer{containers, initContainers, sidecars} {
+		for _, c := range list {
+			if names[c.Name] {
+				sl.ReportError(c.Name, "Containers", "Containers", "uniqueContainerName", "")
+			}
+			names[c.Name] = true
+		}
+	}
+}
+
 func validateQuantity(value string) bool {
 	_, err := resource.ParseQuantity(value)
 	if err != nil {
@@ -106,6 +131,8 @@ func init() {
 	validate.RegisterValidation("devEnv", validateImage)
 
 	validate.RegisterValidation("gpuVendor", validateGpuVendor)
+	validate.RegisterValidation("containerName", validateContainerName)
+	validate.RegisterStructValidation(validateContainers, CreateWithOneDockerConfig{})
 }
 
 func ValidateStruct(data interface{}) []ErrorResponse {
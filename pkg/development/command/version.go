@@ -0,0 +1,151 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/appcfg"
+	"github.com/beclab/devbox/pkg/development/helm"
+	"github.com/beclab/devbox/pkg/utils"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"k8s.io/klog/v2"
+)
+
+const (
+	BumpPatch      = "patch"
+	BumpMinor      = "minor"
+	BumpMajor      = "major"
+	BumpPrerelease = "prerelease"
+
+	defaultPrereleaseLabel = "rc"
+
+	// MaxChartVersionLength is the size of dev_apps.chart_version.
+	MaxChartVersionLength = 20
+)
+
+// VersionBump tells how the chart version of a build is derived from the current one.
+type VersionBump struct {
+	// Kind is one of patch, minor, major or prerelease, patch if empty.
+	Kind string `json:"bump,omitempty"`
+	// Label of a prerelease, rc if empty.
+	Label string `json:"label,omitempty"`
+	// Version is an explicit version, it overrides Kind.
+	Version string `json:"version,omitempty"`
+	// Changelog is written into spec.upgradeDescription of OlaresManifest.yaml.
+	Changelog string `json:"changelog,omitempty"`
+}
+
+// IsZero reports whether b leaves the version and the changelog alone.
+func (b VersionBump) IsZero() bool {
+	return b == VersionBump{}
+}
+
+// Next returns the version following current, it is greater than current and fits
+// dev_apps.chart_version.
+func (b VersionBump) Next(current *semver.Version) (*semver.Version, error) {
+	next, err := b.next(current)
+	if err != nil {
+		return nil, err
+	}
+	if !next.GreaterThan(current) {
+		return nil, fmt.Errorf("version %s must be greater than the current version %s", next, current)
+	}
+	if len(next.String()) > MaxChartVersionLength {
+		return nil, fmt.Errorf("version %s is longer than %d characters, use a shorter prerelease label", next, MaxChartVersionLength)
+	}
+	return next, nil
+}
+
+func (b VersionBump) next(current *semver.Version) (*semver.Version, error) {
+	if b.Version != "" {
+		v, err := semver.StrictNewVersion(strings.TrimPrefix(b.Version, "v"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %v", b.Version, err)
+		}
+		return v, nil
+	}
+
+	var next semver.Version
+	switch b.Kind {
+	case "", BumpPatch:
+		next = current.IncPatch()
+	case BumpMinor:
+		next = current.IncMinor()
+	case BumpMajor:
+		next = current.IncMajor()
+	case BumpPrerelease:
+		return nextPrerelease(current, b.Label)
+	default:
+		return nil, fmt.Errorf("unknown version bump %q, must be one of patch, minor, major, prerelease", b.Kind)
+	}
+	return &next, nil
+}
+
+// nextPrerelease counts up a prerelease of the same label, 1.2.4-rc.0 follows 1.2.3
+// and 1.2.4-rc.1 follows 1.2.4-rc.0. Another label starts at 0 and may sort before the
+// current one, Next rejects that.
+func nextPrerelease(current *semver.Version, label string) (*semver.Version, error) {
+	if label == "" {
+		label = defaultPrereleaseLabel
+	}
+	base, pre := *current, label+".0"
+	if current.Prerelease() == "" {
+		base = current.IncPatch()
+	} else if n, ok := strings.CutPrefix(current.Prerelease(), label+"."); ok {
+		if i, err := strconv.Atoi(n); err == nil {
+			pre = fmt.Sprintf("%s.%d", label, i+1)
+		}
+	}
+	next, err := base.SetPrerelease(pre)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prerelease label %q: %v", label, err)
+	}
+	return &next, nil
+}
+
+// BumpChartVersion sets the next version of the app in Chart.yaml and OlaresManifest.yaml, and returns it.
+func BumpChartVersion(owner, app string, bump VersionBump) (string, error) {
+	path := utils.GetAppPath(owner, app)
+	chart, err := helm.LoadChart(path)
+	if err != nil {
+		return "", err
+	}
+	version, err := bumpChartVersion(chart, owner, app, path, bump)
+	if err != nil {
+		return "", err
+	}
+	return version.String(), nil
+}
+
+func bumpChartVersion(chart *chart.Chart, owner, app, path string, bump VersionBump) (*semver.Version, error) {
+	version, err := helm.GetChartVersion(chart)
+	if err != nil {
+		klog.Errorf("failed to get app=%s chart version %v", app, err)
+		return nil, err
+	}
+	next, err := bump.Next(version)
+	if err != nil {
+		return nil, err
+	}
+	err = helm.UpgradeChartVersion(chart, app, path, next)
+	if err != nil {
+		klog.Errorf("failed to upgrade chart version,app=%s,version=%s,err=%v", app, next, err)
+		return nil, err
+	}
+	err = helm.UpdateAppCfgVersion(owner, path, next)
+	if err != nil {
+		klog.Errorf("failed to update OlaresManifest.yaml metadata.version %v", err)
+		return nil, err
+	}
+	if bump.Changelog != "" {
+		err = appcfg.UpdateSpecField(path, "upgradeDescription", bump.Changelog)
+		if err != nil {
+			klog.Errorf("failed to update OlaresManifest.yaml spec.upgradeDescription %v", err)
+			return nil, err
+		}
+	}
+	return next, nil
+}
@@ -0,0 +1,44 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionBumpNext(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		bump    VersionBump
+		want    string
+		wantErr bool
+	}{
+		{name: "default", current: "1.2.3", bump: VersionBump{}, want: "1.2.4"},
+		{name: "patch", current: "1.2.3", bump: VersionBump{Kind: BumpPatch}, want: "1.2.4"},
+		{name: "minor", current: "1.2.3", bump: VersionBump{Kind: BumpMinor}, want: "1.3.0"},
+		{name: "major", current: "1.2.3", bump: VersionBump{Kind: BumpMajor}, want: "2.0.0"},
+		{name: "first prerelease", current: "1.2.3", bump: VersionBump{Kind: BumpPrerelease}, want: "1.2.4-rc.0"},
+		{name: "next prerelease", current: "1.2.4-rc.0", bump: VersionBump{Kind: BumpPrerelease}, want: "1.2.4-rc.1"},
+		{name: "prerelease label", current: "1.2.4-alpha.3", bump: VersionBump{Kind: BumpPrerelease, Label: "beta"}, want: "1.2.4-beta.0"},
+		{name: "prerelease label backwards", current: "1.2.4-rc.3", bump: VersionBump{Kind: BumpPrerelease, Label: "beta"}, wantErr: true},
+		{name: "prerelease label too long", current: "1.2.3", bump: VersionBump{Kind: BumpPrerelease, Label: "nightlybuilds"}, wantErr: true},
+		{name: "release prerelease", current: "1.2.4-rc.1", bump: VersionBump{Kind: BumpPatch}, want: "1.2.4"},
+		{name: "explicit", current: "1.2.3", bump: VersionBump{Version: "v2.0.0"}, want: "2.0.0"},
+		{name: "explicit not greater", current: "1.2.3", bump: VersionBump{Version: "1.2.3"}, wantErr: true},
+		{name: "explicit invalid", current: "1.2.3", bump: VersionBump{Version: "1.2"}, wantErr: true},
+		{name: "unknown kind", current: "1.2.3", bump: VersionBump{Kind: "micro"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := tt.bump.Next(semver.MustParse(tt.current))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, next.String())
+		})
+	}
+}
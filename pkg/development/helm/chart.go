@@ -155,6 +155,16 @@ func UpgradeChartVersion(chart *chart.Chart, name, path string, version *semver.
 
 // DryRun try to render the helm chart, and return the rendered manifest or error
 func DryRun(ctx context.Context, kubeConfig *rest.Config, namespace, app, path string, vals map[string]interface{}) (string, error) {
+	chart, err := LoadChart(path)
+	if err != nil {
+		klog.Error("load chart error, ", err, ", ", path)
+		return "", err
+	}
+	return DryRunChart(ctx, kubeConfig, namespace, app, chart, vals)
+}
+
+// DryRunChart renders a loaded helm chart, and return the rendered manifest or error
+func DryRunChart(ctx context.Context, kubeConfig *rest.Config, namespace, app string, chart *chart.Chart, vals map[string]interface{}) (string, error) {
 	settings := cli.New()
 	settings.KubeAPIServer = kubeConfig.Host
 	settings.KubeToken = kubeConfig.BearerToken
@@ -172,12 +182,6 @@ func DryRun(ctx context.Context, kubeConfig *rest.Config, namespace, app, path s
 	install.Namespace = namespace
 	install.ReleaseName = app
 
-	chart, err := LoadChart(path)
-	if err != nil {
-		klog.Error("load chart error, ", err, ", ", path)
-		return "", err
-	}
-
 	r, err := install.RunWithContext(ctx, chart, vals)
 	if err != nil {
 		klog.Error("install chart dry run error, ", err)
@@ -204,6 +208,21 @@ func GetRelease(kubeConfig *rest.Config, namespace, app string) error {
 	return err
 }
 
+// GetDeployedRelease returns the latest release of the app, with the values it was installed with.
+func GetDeployedRelease(kubeConfig *rest.Config, namespace, app string) (*release.Release, error) {
+	settings := cli.New()
+	settings.KubeAPIServer = kubeConfig.Host
+	settings.KubeToken = kubeConfig.BearerToken
+	settings.KubeInsecureSkipTLSVerify = true
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(settings.RESTClientGetter(), namespace, os.Getenv("HELM_DRIVER"), log.Printf); err != nil {
+		klog.Error("init helm action config error, ", err)
+		return nil, err
+	}
+	return action.NewGet(actionConfig).Run(app)
+}
+
 func Uninstall(ctx context.Context, kubeConfig *rest.Config, namespace, app string) error {
 	settings := cli.New()
 	settings.KubeAPIServer = kubeConfig.Host
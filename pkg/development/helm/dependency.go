@@ -0,0 +1,170 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+const (
+	DependencyOK           = "ok"
+	DependencyMissing      = "missing"
+	DependencyWrongVersion = "wrong version"
+)
+
+// DependencyStatus is a dependency declared in Chart.yaml and the chart vendored for it in charts/.
+type DependencyStatus struct {
+	Name       string `json:"name"`
+	Alias      string `json:"alias,omitempty"`
+	Version    string `json:"version"`
+	Repository string `json:"repository"`
+	// Vendored is the version of the chart in charts/, empty if it is missing.
+	Vendored string `json:"vendored,omitempty"`
+	Status   string `json:"status"`
+}
+
+// Dependencies returns the status of the dependencies declared by the chart.
+func Dependencies(ch *chart.Chart) []DependencyStatus {
+	deps := make([]DependencyStatus, 0, len(ch.Metadata.Dependencies))
+	for _, d := range ch.Metadata.Dependencies {
+		s := DependencyStatus{
+			Name:       d.Name,
+			Alias:      d.Alias,
+			Version:    d.Version,
+			Repository: d.Repository,
+			Status:     DependencyMissing,
+		}
+		for _, sub := range ch.Dependencies() {
+			if sub.Name() != d.Name {
+				continue
+			}
+			s.Vendored = sub.Metadata.Version
+			s.Status = DependencyWrongVersion
+			if versionMatches(d.Version, sub.Metadata.Version) {
+				s.Status = DependencyOK
+				break
+			}
+		}
+		deps = append(deps, s)
+	}
+	return deps
+}
+
+// CheckDependencies returns an error naming the dependencies of the chart that are
+// missing in charts/ or vendored in a version Chart.yaml does not accept.
+func CheckDependencies(ch *chart.Chart) error {
+	var missing []string
+	for _, d := range Dependencies(ch) {
+		switch d.Status {
+		case DependencyMissing:
+			missing = append(missing, d.Name)
+		case DependencyWrongVersion:
+			missing = append(missing, fmt.Sprintf("%s (%s does not match %s)", d.Name, d.Vendored, d.Version))
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("dependencies declared in Chart.yaml are missing in charts/: %s, update the dependencies of the chart", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// UpdateDependencies resolves the dependencies of the chart in path against their
+// repos, vendors them into charts/ and writes Chart.lock. A file:// dependency
+// must be inside root.
+func UpdateDependencies(path, root string, out io.Writer) error {
+	m, err := dependencyManager(path, root, out)
+	if err != nil {
+		return err
+	}
+	return m.Update()
+}
+
+// BuildDependencies vendors the dependencies locked in Chart.lock into charts/,
+// they are resolved as by UpdateDependencies if there is no lock file.
+func BuildDependencies(path, root string, out io.Writer) error {
+	m, err := dependencyManager(path, root, out)
+	if err != nil {
+		return err
+	}
+	return m.Build()
+}
+
+// EnsureDependencies rebuilds charts/ from Chart.lock if a dependency is missing there.
+func EnsureDependencies(path, root string) error {
+	ch, err := LoadChart(path)
+	if err != nil {
+		return err
+	}
+	if ch.Lock == nil || CheckDependencies(ch) == nil {
+		return nil
+	}
+	return BuildDependencies(path, root, io.Discard)
+}
+
+// dependencyManager fetches dependencies from the repos configured for helm, or
+// directly from the repo url, oci registry or file:// path in Chart.yaml.
+func dependencyManager(path, root string, out io.Writer) (*downloader.Manager, error) {
+	ch, err := LoadChart(path)
+	if err != nil {
+		return nil, err
+	}
+	err = checkLocalDependencies(ch, path, root)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := cli.New()
+	registryClient, err := registry.NewClient(registry.ClientOptCredentialsFile(settings.RegistryConfig))
+	if err != nil {
+		return nil, err
+	}
+	return &downloader.Manager{
+		Out:              out,
+		ChartPath:        path,
+		Getters:          getter.All(settings),
+		RegistryClient:   registryClient,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}, nil
+}
+
+func versionMatches(constraint, version string) bool {
+	if constraint == "" {
+		return true
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
+
+// checkLocalDependencies rejects file:// dependencies of the chart in path outside root.
+func checkLocalDependencies(ch *chart.Chart, path, root string) error {
+	for _, d := range ch.Metadata.Dependencies {
+		local, ok := strings.CutPrefix(d.Repository, "file://")
+		if !ok {
+			continue
+		}
+		if !filepath.IsAbs(local) {
+			local = filepath.Join(path, local)
+		}
+		rel, err := filepath.Rel(root, filepath.Clean(local))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("dependency %s repository %s is outside of %s", d.Name, d.Repository, root)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package helm
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeChart(t *testing.T, dir, chartYaml string) {
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYaml), 0644))
+}
+
+func TestDependencies(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(root, "repositories.yaml"))
+	t.Setenv("HELM_REPOSITORY_CACHE", filepath.Join(root, "cache"))
+	writeChart(t, filepath.Join(root, "redis"), "apiVersion: v2\nname: redis\nversion: 1.2.0\n")
+	app := filepath.Join(root, "app")
+	writeChart(t, app, "apiVersion: v2\nname: app\nversion: 0.0.1\ndependencies:\n- name: redis\n  version: ~1.2.0\n  repository: file://../redis\n")
+
+	ch, err := LoadChart(app)
+	assert.NoError(t, err)
+	assert.Equal(t, DependencyMissing, Dependencies(ch)[0].Status)
+	assert.ErrorContains(t, CheckDependencies(ch), "redis")
+
+	assert.NoError(t, UpdateDependencies(app, root, io.Discard))
+	assert.FileExists(t, filepath.Join(app, "Chart.lock"))
+	assert.FileExists(t, filepath.Join(app, "charts", "redis-1.2.0.tgz"))
+
+	ch, err = LoadChart(app)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckDependencies(ch))
+	assert.Equal(t, "1.2.0", Dependencies(ch)[0].Vendored)
+
+	assert.NoError(t, os.RemoveAll(filepath.Join(app, "charts")))
+	assert.NoError(t, EnsureDependencies(app, root))
+	assert.FileExists(t, filepath.Join(app, "charts", "redis-1.2.0.tgz"))
+
+	assert.ErrorContains(t, UpdateDependencies(app, app, io.Discard), "outside")
+}
@@ -0,0 +1,141 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	yml "sigs.k8s.io/yaml"
+)
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// ObjectDiff is the change of one object between two manifests.
+type ObjectDiff struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Change    string `json:"change"`
+	Diff      string `json:"diff"`
+}
+
+// ManifestDiff is the object by object difference of two rendered manifests.
+type ManifestDiff struct {
+	Added   []ObjectDiff `json:"added"`
+	Removed []ObjectDiff `json:"removed"`
+	Changed []ObjectDiff `json:"changed"`
+}
+
+type manifestObject struct {
+	kind      string
+	namespace string
+	name      string
+	yaml      string
+}
+
+func (o *manifestObject) key() string {
+	return o.kind + "/" + o.namespace + "/" + o.name
+}
+
+// DiffManifests compares the objects of the from manifest with the ones of to,
+// objects are matched by kind, namespace and name.
+func DiffManifests(from, to string) (*ManifestDiff, error) {
+	fromObjs, err := manifestObjects(from)
+	if err != nil {
+		return nil, err
+	}
+	toObjs, err := manifestObjects(to)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ManifestDiff{Added: []ObjectDiff{}, Removed: []ObjectDiff{}, Changed: []ObjectDiff{}}
+	for _, k := range sortedKeys(toObjs) {
+		o := toObjs[k]
+		old, ok := fromObjs[k]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, objectDiff(o, DiffAdded, "", o.yaml))
+		case old.yaml != o.yaml:
+			diff.Changed = append(diff.Changed, objectDiff(o, DiffChanged, old.yaml, o.yaml))
+		}
+	}
+	for _, k := range sortedKeys(fromObjs) {
+		if _, ok := toObjs[k]; !ok {
+			o := fromObjs[k]
+			diff.Removed = append(diff.Removed, objectDiff(o, DiffRemoved, o.yaml, ""))
+		}
+	}
+	return diff, nil
+}
+
+func objectDiff(o *manifestObject, change, from, to string) ObjectDiff {
+	name := fmt.Sprintf("%s/%s", o.kind, o.name)
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: "a/" + name,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+	if err != nil {
+		text = err.Error()
+	}
+	return ObjectDiff{Kind: o.kind, Namespace: o.namespace, Name: o.name, Change: change, Diff: text}
+}
+
+func manifestObjects(manifest string) (map[string]*manifestObject, error) {
+	resources, err := DecodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	objs := make(map[string]*manifestObject, len(resources))
+	for _, r := range resources {
+		o, err := newManifestObject(r)
+		if err != nil {
+			return nil, err
+		}
+		objs[o.key()] = o
+	}
+	return objs, nil
+}
+
+func newManifestObject(obj runtime.Object) (*manifestObject, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	// fields set by the typed decoding only, they are never part of a chart
+	delete(content, "status")
+	if m, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(m, "creationTimestamp")
+	}
+	data, err := yml.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" {
+		kind, _ = content["kind"].(string)
+	}
+	return &manifestObject{kind: kind, namespace: accessor.GetNamespace(), name: accessor.GetName(), yaml: string(data)}, nil
+}
+
+func sortedKeys(objs map[string]*manifestObject) []string {
+	keys := make([]string, 0, len(objs))
+	for k := range objs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
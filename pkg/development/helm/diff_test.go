@@ -0,0 +1,76 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffManifests(t *testing.T) {
+	from := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: app-dev-alice
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: old
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: same
+data:
+  key: value
+`
+	to := `
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: app-dev-alice
+spec:
+  ports:
+  - port: 8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: same
+data:
+  key: value
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: new
+`
+	diff, err := DiffManifests(from, to)
+	assert.NoError(t, err)
+	if assert.Len(t, diff.Added, 1) {
+		assert.Equal(t, "Secret", diff.Added[0].Kind)
+		assert.Equal(t, "new", diff.Added[0].Name)
+	}
+	if assert.Len(t, diff.Removed, 1) {
+		assert.Equal(t, "old", diff.Removed[0].Name)
+		assert.Contains(t, diff.Removed[0].Diff, "-  key: value")
+	}
+	if assert.Len(t, diff.Changed, 1) {
+		assert.Equal(t, "Service", diff.Changed[0].Kind)
+		assert.Equal(t, "app-dev-alice", diff.Changed[0].Namespace)
+		assert.Contains(t, diff.Changed[0].Diff, "-  - port: 80\n")
+		assert.Contains(t, diff.Changed[0].Diff, "+  - port: 8080\n")
+	}
+
+	diff, err = DiffManifests("", to)
+	assert.NoError(t, err)
+	assert.Len(t, diff.Added, 3)
+}
@@ -0,0 +1,39 @@
+package helm
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+//go:embed values.fixture.yaml
+var defaultFixture []byte
+
+// FixtureValues returns the values mocking what app-service passes to the chart in
+// path. The default fixture is overlaid with values, then with the fixture override
+// of the app in .studio/values.fixture.yaml.
+func FixtureValues(path string, values map[string]interface{}) (map[string]interface{}, error) {
+	fixture, err := chartutil.ReadValues(defaultFixture)
+	if err != nil {
+		return nil, err
+	}
+	fixture = chartutil.CoalesceTables(values, fixture)
+
+	data, err := os.ReadFile(filepath.Join(path, constants.ValuesFixtureFileName))
+	if os.IsNotExist(err) {
+		return fixture, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	override, err := chartutil.ReadValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %v", constants.ValuesFixtureFileName, err)
+	}
+	return chartutil.CoalesceTables(override, fixture), nil
+}
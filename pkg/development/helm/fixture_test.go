@@ -0,0 +1,31 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/constants"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixtureValues(t *testing.T) {
+	dir := t.TempDir()
+	values, err := FixtureValues(dir, map[string]interface{}{"domain": map[string]interface{}{"web": "dryrun"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"username": "bfl-username"}, values["bfl"])
+	assert.Equal(t, map[string]interface{}{"web": "dryrun"}, values["domain"])
+
+	override := "bfl:\n  username: alice\nGPU:\n  Type: amd\nzinc: null\nfeature:\n  enabled: true\n"
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, constants.StudioDir), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, constants.ValuesFixtureFileName), []byte(override), 0644))
+
+	values, err = FixtureValues(dir, map[string]interface{}{"GPU": map[string]interface{}{"Cuda": "12.4"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"username": "alice"}, values["bfl"])
+	assert.Equal(t, map[string]interface{}{"Type": "amd", "Cuda": "12.4"}, values["GPU"])
+	assert.Equal(t, map[string]interface{}{"enabled": true}, values["feature"])
+	assert.NotContains(t, values, "zinc")
+	assert.Contains(t, values, "postgres")
+}
@@ -0,0 +1,135 @@
+package helm
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+)
+
+// RenderedTemplate is the output of a template of the chart, Name is relative to the chart dir.
+type RenderedTemplate struct {
+	Name     string `json:"name"`
+	Manifest string `json:"manifest"`
+}
+
+// RenderError is a template the helm engine failed to render.
+type RenderError struct {
+	Template string `json:"template,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+type RenderResult struct {
+	Templates []RenderedTemplate `json:"templates"`
+	Errors    []RenderError      `json:"errors"`
+	// Values are the values the chart is rendered with.
+	Values map[string]interface{} `json:"-"`
+}
+
+// Manifest joins the rendered manifests as helm puts them in a release, NOTES.txt is left out.
+func (r *RenderResult) Manifest() string {
+	var b strings.Builder
+	for _, t := range r.Templates {
+		if strings.HasSuffix(t.Name, "NOTES.txt") {
+			continue
+		}
+		b.WriteString("---\n# Source: " + t.Name + "\n" + t.Manifest + "\n")
+	}
+	return b.String()
+}
+
+// matches "template: app/templates/a.yaml:3:12: ..." and "error at (app/templates/a.yaml:3:12): ..."
+var renderErrorRe = regexp.MustCompile(`(?:template: |\()([^\s:()]+):(\d+)(?::(\d+))?`)
+
+// RenderChart renders the chart with the helm engine as an install of release into
+// namespace would, without a cluster. A template failing to render is reported in
+// the errors of the result and the other templates are still rendered.
+func RenderChart(ch *chart.Chart, namespace, release string, vals map[string]interface{}) (*RenderResult, error) {
+	if err := chartutil.ProcessDependencies(ch, vals); err != nil {
+		return nil, err
+	}
+	options := chartutil.ReleaseOptions{Name: release, Namespace: namespace, Revision: 1, IsInstall: true}
+	values, err := chartutil.ToRenderValues(ch, vals, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RenderResult{Templates: []RenderedTemplate{}, Errors: []RenderError{}, Values: vals}
+	prefix := ch.Name() + "/"
+	for {
+		out, err := engine.Render(ch, values)
+		if err == nil {
+			for name, manifest := range out {
+				if strings.TrimSpace(manifest) == "" {
+					continue
+				}
+				result.Templates = append(result.Templates, RenderedTemplate{Name: strings.TrimPrefix(name, prefix), Manifest: manifest})
+			}
+			sort.Slice(result.Templates, func(i, j int) bool { return result.Templates[i].Name < result.Templates[j].Name })
+			return result, nil
+		}
+
+		renderErr := RenderError{Message: err.Error()}
+		m := renderErrorRe.FindStringSubmatch(err.Error())
+		// the engine stops at the first failing template, it is left out to render the others
+		if m == nil || !removeTemplate(ch, "", m[1]) {
+			result.Errors = append(result.Errors, renderErr)
+			return result, nil
+		}
+		renderErr.Template = strings.TrimPrefix(m[1], prefix)
+		renderErr.Line, _ = strconv.Atoi(m[2])
+		renderErr.Column, _ = strconv.Atoi(m[3])
+		result.Errors = append(result.Errors, renderErr)
+	}
+}
+
+// removeTemplate removes the template of the full engine name from the chart or its subcharts.
+func removeTemplate(ch *chart.Chart, parent, name string) bool {
+	path := ch.Name()
+	if parent != "" {
+		path = parent + "/charts/" + ch.Name()
+	}
+	for i, t := range ch.Templates {
+		if path+"/"+t.Name == name {
+			ch.Templates = append(ch.Templates[:i:i], ch.Templates[i+1:]...)
+			return true
+		}
+	}
+	for _, sub := range ch.Dependencies() {
+		if removeTemplate(sub, path, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderFile renders data as a template of the chart, as app-service renders
+// OlaresManifest.yaml. Only the partials of the chart are loaded along with it.
+func RenderFile(ch *chart.Chart, name string, data []byte, vals map[string]interface{}) (string, error) {
+	c := *ch
+	c.Templates = []*chart.File{{Name: "templates/" + name, Data: data}}
+	for _, t := range ch.Templates {
+		if strings.HasPrefix(path.Base(t.Name), "_") {
+			c.Templates = append(c.Templates, t)
+		}
+	}
+	c.SetDependencies()
+
+	options := chartutil.ReleaseOptions{Name: ch.Name(), Revision: 1, IsInstall: true}
+	values, err := chartutil.ToRenderValues(&c, vals, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return "", err
+	}
+	out, err := engine.Render(&c, values)
+	if err != nil {
+		return "", err
+	}
+	return out[c.Name()+"/templates/"+name], nil
+}
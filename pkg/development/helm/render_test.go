@@ -0,0 +1,46 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderChart(t *testing.T) {
+	dir := t.TempDir()
+	writeChart(t, dir, "apiVersion: v2\nname: app\nversion: 0.0.1\n")
+	templates := map[string]string{
+		"cm.yaml":       "kind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n  namespace: {{ .Release.Namespace }}\ndata:\n  user: {{ .Values.bfl.username }}\n",
+		"broken.yaml":   "kind: Secret\n\n{{ required \"password is required\" .Values.password }}\n",
+		"unclosed.yaml": "kind: Service\n{{ if .Values.svc }}\n",
+		"empty.yaml":    "{{- if false }}kind: Pod{{ end }}",
+	}
+	for name, content := range templates {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "templates", name), []byte(content), 0644))
+	}
+	ch, err := LoadChart(dir)
+	assert.NoError(t, err)
+
+	result, err := RenderChart(ch, "app-dev-alice", "app-dev", map[string]interface{}{
+		"bfl": map[string]interface{}{"username": "alice"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, result.Templates, 1) {
+		assert.Equal(t, "templates/cm.yaml", result.Templates[0].Name)
+		assert.Contains(t, result.Templates[0].Manifest, "name: app-dev\n  namespace: app-dev-alice")
+		assert.Contains(t, result.Templates[0].Manifest, "user: alice")
+	}
+	assert.Contains(t, result.Manifest(), "# Source: templates/cm.yaml")
+
+	errs := map[string]RenderError{}
+	for _, e := range result.Errors {
+		errs[e.Template] = e
+	}
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, 3, errs["templates/broken.yaml"].Line)
+		assert.Contains(t, errs["templates/broken.yaml"].Message, "password is required")
+		assert.Contains(t, errs, "templates/unclosed.yaml")
+	}
+}
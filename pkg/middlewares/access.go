@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+// roles a user can have on a dev app, each role includes the ones below it
+const (
+	RoleOwner    = "owner"
+	RoleDeployer = "deployer"
+	RoleEditor   = "editor"
+	RoleViewer   = "viewer"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleEditor:   2,
+	RoleDeployer: 3,
+	RoleOwner:    4,
+}
+
+// IsCollaboratorRole reports whether role can be granted to a collaborator.
+func IsCollaboratorRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor || role == RoleDeployer
+}
+
+// HasRole reports whether role grants the permissions of want.
+func HasRole(role, want string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[want]
+}
+
+// AppRoleResolver returns the role username has on the app of owner, or an
+// empty role if the user has no access to it.
+type AppRoleResolver func(owner, app, username string) (string, error)
+
+// AppName extracts the name of the dev app a request is about.
+type AppName func(c *fiber.Ctx) string
+
+func AppParam(key string) AppName {
+	return func(c *fiber.Ctx) string {
+		return c.Params(key)
+	}
+}
+
+func AppQuery(key string) AppName {
+	return func(c *fiber.Ctx) string {
+		return c.Query(key)
+	}
+}
+
+func AppForm(key string) AppName {
+	return func(c *fiber.Ctx) string {
+		return c.FormValue(key)
+	}
+}
+
+func AppBody(key string) AppName {
+	return func(c *fiber.Ctx) string {
+		body := make(map[string]interface{})
+		if err := c.BodyParser(&body); err != nil {
+			return ""
+		}
+		name, _ := body[key].(string)
+		return name
+	}
+}
+
+// AppPath takes the app name from the first element of a files path.
+func AppPath(key string) AppName {
+	return func(c *fiber.Ctx) string {
+		p := strings.TrimPrefix(filepath.Clean("/"+c.Params(key)), "/")
+		return strings.SplitN(p, "/", 2)[0]
+	}
+}
+
+// AppAccess resolves the owner of the app a request is about, it must run after TokenAuth.
+// A request without the owner query acts on the caller's own app, otherwise the
+// caller must have at least the want role on the owner's app. The owner and the
+// role are stored in the "owner" and "role" locals, the app name in "app".
+func AppAccess(resolve AppRoleResolver, want string, appName AppName) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		username := c.Locals("username").(string)
+		app := appName(c)
+		c.Locals("app", app)
+		owner := c.Query("owner")
+		if owner == "" || owner == username {
+			c.Locals("owner", username)
+			c.Locals("role", RoleOwner)
+			return c.Next()
+		}
+
+		if app == "" {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"code":    http.StatusBadRequest,
+				"message": "app name is required to access an app of another user",
+			})
+		}
+		role, err := resolve(owner, app, username)
+		if err != nil {
+			klog.Errorf("failed to resolve role of user %s on app %s/%s, err=%v", username, owner, app, err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"code":    http.StatusInternalServerError,
+				"message": err.Error(),
+			})
+		}
+		if !HasRole(role, want) {
+			klog.Warningf("user %s with role %q is not allowed to %s %s of %s", username, role, c.Method(), c.Path(), owner)
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"code":    http.StatusForbidden,
+				"message": "Permission denied",
+			})
+		}
+		c.Locals("owner", owner)
+		c.Locals("role", role)
+		return c.Next()
+	}
+}
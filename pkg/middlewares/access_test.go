@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppAccess(t *testing.T) {
+	roles := map[string]string{"alice/app": RoleEditor}
+	resolve := func(owner, app, username string) (string, error) {
+		if username != "bob" {
+			return "", nil
+		}
+		return roles[owner+"/"+app], nil
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("username", c.Get("X-User"))
+		return c.Next()
+	})
+	handler := func(c *fiber.Ctx) error {
+		return c.SendString(c.Locals("owner").(string) + " " + c.Locals("role").(string))
+	}
+	app.Get("/apps/:name", AppAccess(resolve, RoleViewer, AppParam("name")), handler)
+	app.Post("/apps/:name/install", AppAccess(resolve, RoleDeployer, AppParam("name")), handler)
+	app.Put("/files/*", AppAccess(resolve, RoleEditor, AppPath("*1")), handler)
+
+	for _, c := range []struct {
+		method, path, user string
+		code               int
+		body               string
+	}{
+		{"GET", "/apps/app", "bob", 200, "bob owner"},
+		{"GET", "/apps/app?owner=alice", "bob", 200, "alice editor"},
+		{"GET", "/apps/app?owner=alice", "carol", 403, ""},
+		{"GET", "/apps/other?owner=alice", "bob", 403, ""},
+		{"POST", "/apps/app/install?owner=alice", "bob", 403, ""},
+		{"PUT", "/files/app/OlaresManifest.yaml?owner=alice", "bob", 200, "alice editor"},
+		{"PUT", "/files/app/../other/values.yaml?owner=alice", "bob", 403, ""},
+		{"PUT", "/files/?owner=alice", "bob", 400, ""},
+	} {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("X-User", c.user)
+		resp, err := app.Test(req)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, c.code, resp.StatusCode, c.method+" "+c.path)
+		if c.body != "" {
+			buf := make([]byte, 64)
+			n, _ := resp.Body.Read(buf)
+			assert.Equal(t, c.body, string(buf[:n]))
+		}
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	assert.True(t, HasRole(RoleOwner, RoleDeployer))
+	assert.True(t, HasRole(RoleDeployer, RoleEditor))
+	assert.True(t, HasRole(RoleEditor, RoleEditor))
+	assert.False(t, HasRole(RoleViewer, RoleEditor))
+	assert.False(t, HasRole("", RoleViewer))
+}
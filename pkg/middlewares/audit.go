@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/gofiber/fiber/v2"
+	"k8s.io/klog/v2"
+)
+
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeCanceled  = "canceled"
+)
+
+const (
+	auditActionKey = "audit_action"
+	auditParamsKey = "audit_params"
+)
+
+// SetAudit names the action of the request and the parameters to record in the audit log.
+func SetAudit(c *fiber.Ctx, action string, params map[string]interface{}) {
+	c.Locals(auditActionKey, action)
+	c.Locals(auditParamsKey, params)
+}
+
+// Audit records every mutating request in the audit log after it is handled, it must run after TokenAuth.
+// Handlers reply with http 200 and the status in the code field of the body, so the outcome is taken from there.
+func Audit(write func(entry *model.AuditLog) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+		err := c.Next()
+
+		username, _ := c.Locals("username").(string)
+		entry := &model.AuditLog{
+			Actor:   username,
+			Owner:   username,
+			Method:  c.Method(),
+			Path:    c.Path(),
+			Action:  c.Method() + " " + c.Route().Path,
+			Outcome: OutcomeSucceeded,
+		}
+		if owner, ok := c.Locals("owner").(string); ok && owner != "" {
+			entry.Owner = owner
+		}
+		if app, ok := c.Locals("app").(string); ok {
+			entry.AppName = app
+		}
+		if action, ok := c.Locals(auditActionKey).(string); ok && action != "" {
+			entry.Action = action
+		}
+		if params, ok := c.Locals(auditParamsKey).(map[string]interface{}); ok {
+			entry.Params = params
+		} else {
+			entry.Params = requestParams(c)
+		}
+
+		if err != nil {
+			entry.Outcome, entry.Message = OutcomeFailed, err.Error()
+		} else if code, msg := responseCode(c); code >= http.StatusBadRequest {
+			entry.Outcome, entry.Message = OutcomeFailed, msg
+		}
+		if e := write(entry); e != nil {
+			klog.Errorf("failed to write audit log of %s %s by %s, err=%v", entry.Method, entry.Path, entry.Actor, e)
+		}
+		return err
+	}
+}
+
+func requestParams(c *fiber.Ctx) map[string]interface{} {
+	params := make(map[string]interface{})
+	for k, v := range c.AllParams() {
+		params[k] = v
+	}
+	c.Context().QueryArgs().VisitAll(func(k, v []byte) {
+		params[string(k)] = string(v)
+	})
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+func responseCode(c *fiber.Ctx) (int, string) {
+	code := c.Response().StatusCode()
+	if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return code, ""
+	}
+	var body struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+		return code, ""
+	}
+	if code < http.StatusBadRequest && body.Code != 0 {
+		code = body.Code
+	}
+	return code, body.Message
+}
@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	var entries []*model.AuditLog
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("username", "bob")
+		return c.Next()
+	})
+	app.Use(Audit(func(entry *model.AuditLog) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	resolve := func(owner, app, username string) (string, error) {
+		return RoleDeployer, nil
+	}
+	app.Get("/apps/:name", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"code": http.StatusOK})
+	})
+	app.Post("/apps/:name/install", AppAccess(resolve, RoleDeployer, AppParam("name")), func(c *fiber.Ctx) error {
+		SetAudit(c, "install.start", map[string]interface{}{"jobId": "1"})
+		return c.JSON(fiber.Map{"code": http.StatusOK})
+	})
+	app.Delete("/apps/:name", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"code": http.StatusBadRequest, "message": "app is running"})
+	})
+
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/apps/app"},
+		{"POST", "/apps/app/install?owner=alice"},
+		{"DELETE", "/apps/app"},
+	} {
+		_, err := app.Test(httptest.NewRequest(r.method, r.path, nil))
+		assert.NoError(t, err)
+	}
+
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	install := entries[0]
+	assert.Equal(t, "bob", install.Actor)
+	assert.Equal(t, "alice", install.Owner)
+	assert.Equal(t, "app", install.AppName)
+	assert.Equal(t, "install.start", install.Action)
+	assert.Equal(t, "1", install.Params["jobId"])
+	assert.Equal(t, OutcomeSucceeded, install.Outcome)
+
+	del := entries[1]
+	assert.Equal(t, "bob", del.Owner)
+	assert.Equal(t, "DELETE /apps/:name", del.Action)
+	assert.Equal(t, "app", del.Params["name"])
+	assert.Equal(t, OutcomeFailed, del.Outcome)
+	assert.Equal(t, "app is running", del.Message)
+}
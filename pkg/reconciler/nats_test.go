@@ -0,0 +1,52 @@
+package reconciler
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/beclab/devbox/pkg/store/db"
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileOnMarketMessage(t *testing.T) {
+	srv := natstest.RunRandClientPortServer()
+	defer srv.Shutdown()
+	t.Setenv("NATS_HOST", "127.0.0.1")
+	t.Setenv("NATS_PORT", strconv.Itoa(srv.Addr().(*net.TCPAddr).Port))
+
+	stores := db.NewMemoryStores()
+	assert.NoError(t, stores.Apps.Create(&model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice", State: StateInstalling}))
+	update := func(owner, name, state, reason string) error {
+		_, err := stores.Apps.Update(owner, name, map[string]interface{}{"state": state, "reason": reason})
+		return err
+	}
+
+	status := &fakeStatus{states: map[string]string{"app-dev": "running"}}
+	r := New(status, update).WithInterval(time.Hour)
+	r.Track("alice", "app", StateInstalling)
+
+	nc, err := ConnectNats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, nc)
+
+	// publish until the subscription of Run is in place
+	assert.Eventually(t, func() bool {
+		err := nc.Publish("os.market.alice", []byte(`{"user":"alice","notify_type":"market_system_point","point":"new_app_ready"}`))
+		if err != nil {
+			return false
+		}
+		app, err := stores.Apps.Get("alice", "app")
+		return err == nil && app.State == StateRunning
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,205 @@
+package reconciler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"k8s.io/klog/v2"
+)
+
+const (
+	StateInstalling = "installing"
+	StateRunning    = "running"
+	StateFailed     = "failed"
+	StateSuspended  = "suspended"
+	StateUndeploy   = "undeploy"
+)
+
+const marketSubject = "os.market.*"
+
+// StatusGetter returns the state of an app in app-service, it needs no token of the owner
+// so the apps are still reconciled after devbox restarts.
+type StatusGetter interface {
+	GetAppManagerState(ctx context.Context, owner, devAppName string) (string, error)
+}
+
+// StateUpdater persists the derived state of a dev app.
+type StateUpdater func(owner, name, state, reason string) error
+
+type marketUpdate struct {
+	User       string            `json:"user"`
+	NotifyType string            `json:"notify_type"`
+	Point      string            `json:"point"`
+	Extensions map[string]string `json:"extensions,omitempty"`
+}
+
+type trackedApp struct {
+	owner string
+	name  string
+	state string
+}
+
+// Reconciler keeps DevApp.State in line with app-service, it polls the tracked apps
+// and reconciles an owner's apps right away when the market notifies about them.
+type Reconciler struct {
+	status   StatusGetter
+	update   StateUpdater
+	interval time.Duration
+
+	mu     sync.Mutex
+	apps   map[string]*trackedApp
+	notify chan string
+}
+
+func New(status StatusGetter, update StateUpdater) *Reconciler {
+	return &Reconciler{
+		status:   status,
+		update:   update,
+		interval: 30 * time.Second,
+		apps:     make(map[string]*trackedApp),
+		notify:   make(chan string, 64),
+	}
+}
+
+func (r *Reconciler) WithInterval(interval time.Duration) *Reconciler {
+	r.interval = interval
+	return r
+}
+
+// Track starts reconciling the app, state is the DevApp state it is known to be in.
+func (r *Reconciler) Track(owner, name, state string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apps[owner+"/"+name] = &trackedApp{owner: owner, name: name, state: state}
+}
+
+func (r *Reconciler) Untrack(owner, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.apps, owner+"/"+name)
+}
+
+// Run reconciles until ctx is done, nc may be nil to only poll app-service.
+func (r *Reconciler) Run(ctx context.Context, nc *nats.Conn) {
+	if nc != nil {
+		sub, err := nc.Subscribe(marketSubject, r.handleMsg)
+		if err != nil {
+			klog.Errorf("failed to subscribe subject: %s, err=%v", marketSubject, err)
+		} else {
+			defer sub.Unsubscribe()
+		}
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Reconcile(ctx, "")
+		case owner := <-r.notify:
+			r.Reconcile(ctx, owner)
+		}
+	}
+}
+
+func (r *Reconciler) handleMsg(msg *nats.Msg) {
+	var update marketUpdate
+	if err := json.Unmarshal(msg.Data, &update); err != nil {
+		klog.Errorf("failed to unmarshal market update %v", err)
+		return
+	}
+	owner := update.User
+	if owner == "" {
+		owner = strings.TrimPrefix(msg.Subject, "os.market.")
+	}
+	klog.V(4).Infof("market update for %s: %#v", owner, update)
+
+	select {
+	case r.notify <- owner:
+	default:
+		// a reconcile is already pending, the next tick picks the owner up anyway
+	}
+}
+
+// Reconcile updates the state of the tracked apps of owner, or of all of them if owner is empty.
+func (r *Reconciler) Reconcile(ctx context.Context, owner string) {
+	r.mu.Lock()
+	apps := make([]*trackedApp, 0, len(r.apps))
+	for _, a := range r.apps {
+		if owner == "" || a.owner == owner {
+			apps = append(apps, a)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, a := range apps {
+		raw, err := r.status.GetAppManagerState(ctx, a.owner, fmt.Sprintf("%s-dev", a.name))
+		if err != nil {
+			klog.Errorf("failed to get app=%s state of owner=%s, err=%v", a.name, a.owner, err)
+			continue
+		}
+		state, ok := DeriveState(raw)
+		if !ok {
+			continue
+		}
+		r.updateState(a, state, raw)
+	}
+}
+
+// updateState writes state of a tracked app, the lock is held during the write so an app
+// untracked or tracked again for a new deploy meanwhile is not overwritten with a stale state.
+func (r *Reconciler) updateState(a *trackedApp, state, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := a.owner + "/" + a.name
+	if r.apps[key] != a || a.state == state {
+		return
+	}
+	err := r.update(a.owner, a.name, state, reason)
+	if err != nil {
+		klog.Errorf("failed to update app=%s state to %s, err=%v", a.name, state, err)
+		return
+	}
+	klog.Infof("app=%s of owner=%s is %s (%s)", a.name, a.owner, state, reason)
+
+	a.state = state
+	if state == StateUndeploy {
+		delete(r.apps, key)
+	}
+}
+
+// DeriveState maps an app-service state to a DevApp state, ok is false for states it does not know.
+func DeriveState(state string) (string, bool) {
+	switch {
+	case state == "running":
+		return StateRunning, true
+	case state == "suspended", state == "suspending", state == "stopped", state == "stopping":
+		return StateSuspended, true
+	case state == "uninstalled", state == "uninstalling", strings.HasSuffix(state, "Canceled"):
+		return StateUndeploy, true
+	case strings.HasSuffix(state, "Failed"):
+		return StateFailed, true
+	case state == "pending", state == "downloading", state == "installing", state == "initializing",
+		state == "upgrading", state == "resuming", strings.HasSuffix(state, "Canceling"):
+		return StateInstalling, true
+	}
+	return "", false
+}
+
+func ConnectNats() (*nats.Conn, error) {
+	natsURL := fmt.Sprintf("nats://%s:%s", os.Getenv("NATS_HOST"), os.Getenv("NATS_PORT"))
+	nc, err := nats.Connect(natsURL, nats.UserInfo(os.Getenv("NATS_USERNAME"), os.Getenv("NATS_PASSWORD")))
+	if err != nil {
+		klog.Errorf("failed to connect to nats: %s, err=%v", natsURL, err)
+		return nil, err
+	}
+	return nc, nil
+}
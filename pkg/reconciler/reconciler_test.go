@@ -0,0 +1,136 @@
+package reconciler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStatus struct {
+	mu     sync.Mutex
+	states map[string]string
+}
+
+func (f *fakeStatus) set(devAppName, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.states[devAppName] = state
+}
+
+func (f *fakeStatus) GetAppManagerState(ctx context.Context, owner, devAppName string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.states[devAppName], nil
+}
+
+type recorder struct {
+	mu      sync.Mutex
+	updates []string
+}
+
+func (r *recorder) update(owner, name, state, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, owner+"/"+name+":"+state)
+	return nil
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.updates...)
+}
+
+func TestReconcile(t *testing.T) {
+	status := &fakeStatus{states: map[string]string{"app-dev": "installing"}}
+	rec := &recorder{}
+	r := New(status, rec.update)
+	r.Track("alice", "app", StateInstalling)
+
+	// the state the app is tracked in is not written again
+	r.Reconcile(context.TODO(), "")
+	r.Reconcile(context.TODO(), "")
+	status.set("app-dev", "installFailed")
+	r.Reconcile(context.TODO(), "bob")
+	r.Reconcile(context.TODO(), "alice")
+	status.set("app-dev", "uninstalled")
+	r.Reconcile(context.TODO(), "")
+	status.set("app-dev", "running")
+	r.Reconcile(context.TODO(), "")
+
+	assert.Equal(t, []string{"alice/app:failed", "alice/app:undeploy"}, rec.list())
+}
+
+// untrackingStatus untracks the app while its state is fetched, as a redeploy does.
+type untrackingStatus struct {
+	r     *Reconciler
+	track bool
+}
+
+func (u *untrackingStatus) GetAppManagerState(ctx context.Context, owner, devAppName string) (string, error) {
+	u.r.Untrack(owner, "app")
+	if u.track {
+		u.r.Track(owner, "app", StateInstalling)
+	}
+	return "uninstalled", nil
+}
+
+func TestReconcileSkipsUntrackedApp(t *testing.T) {
+	for _, track := range []bool{false, true} {
+		rec := &recorder{}
+		status := &untrackingStatus{track: track}
+		r := New(status, rec.update)
+		status.r = r
+		r.Track("alice", "app", StateRunning)
+
+		r.Reconcile(context.TODO(), "")
+		assert.Empty(t, rec.list())
+	}
+}
+
+func TestMarketUpdateTriggersReconcile(t *testing.T) {
+	status := &fakeStatus{states: map[string]string{"app-dev": "running"}}
+	rec := &recorder{}
+	r := New(status, rec.update).WithInterval(time.Hour)
+	r.Track("alice", "app", StateInstalling)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, nil)
+
+	r.handleMsg(&nats.Msg{
+		Subject: "os.market.alice",
+		Data:    []byte(`{"user":"alice","notify_type":"market_system_point","point":"new_app_ready"}`),
+	})
+
+	assert.Eventually(t, func() bool {
+		return len(rec.list()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "alice/app:running", rec.list()[0])
+}
+
+func TestDeriveState(t *testing.T) {
+	cases := map[string]string{
+		"pending":             StateInstalling,
+		"downloading":         StateInstalling,
+		"installingCanceling": StateInstalling,
+		"running":             StateRunning,
+		"stopped":             StateSuspended,
+		"suspended":           StateSuspended,
+		"installFailed":       StateFailed,
+		"downloadFailed":      StateFailed,
+		"installingCanceled":  StateUndeploy,
+		"uninstalled":         StateUndeploy,
+	}
+	for raw, want := range cases {
+		got, ok := DeriveState(raw)
+		assert.True(t, ok, raw)
+		assert.Equal(t, want, got, raw)
+	}
+	_, ok := DeriveState("unknown")
+	assert.False(t, ok)
+}
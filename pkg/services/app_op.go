@@ -13,10 +13,18 @@ import (
 	"net/http/httputil"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/beclab/devbox/pkg/appcfg"
 	"github.com/beclab/devbox/pkg/utils"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 const (
@@ -25,6 +33,7 @@ const (
 	canDeployApiPath = "/app-service/v1/apps/%s/can-deploy"
 	appStatusApiPath = "/app-service/v1/apps/%s/status"
 	uninstallApiPath = "/app-service/v1/apps/%s/uninstall"
+	cancelApiPath    = "/app-service/v1/apps/%s/cancel"
 )
 
 type Response struct {
@@ -46,9 +55,16 @@ type AppOp interface {
 	IsAllowedDeploy(ctx context.Context, owner, devAppName, token string) (bool, error)
 	Uninstall(ctx context.Context, owner, devAppName, token string) (map[string]interface{}, error)
 	CheckIfAppIsUninstalled(owner, devAppName, token string) (bool, error)
+	GetAppState(ctx context.Context, owner, devAppName, token string) (string, error)
+	GetAppManagerState(ctx context.Context, owner, devAppName string) (string, error)
+	Cancel(ctx context.Context, owner, devAppName, token string) error
 }
 
-type appOp struct{}
+type appOp struct {
+	once   sync.Once
+	client dynamic.Interface
+	err    error
+}
 
 func NewAppOp() AppOp {
 	return &appOp{}
@@ -166,50 +182,117 @@ func (a *appOp) Uninstall(ctx context.Context, owner, devAppName, token string)
 }
 
 func (a *appOp) CheckIfAppIsUninstalled(owner, devAppName, token string) (bool, error) {
+	state, err := a.GetAppState(context.TODO(), owner, devAppName, token)
+	if err != nil {
+		return false, err
+	}
+	if state == "uninstalled" || state == "installFailed" ||
+		state == "pendingCanceled" || state == "downloadingCanceled" ||
+		state == "installingCanceled" || state == "downloadFailed" ||
+		state == "pendingCancelFailed" || state == "downloadingCancelFailed" ||
+		state == "installingCancelFailed" {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// GetAppState returns the state of app in app-service, an app unknown to app-service is uninstalled.
+func (a *appOp) GetAppState(ctx context.Context, owner, devAppName, token string) (string, error) {
 	url := fmt.Sprintf("%s%s", appServiceHost, fmt.Sprintf(appStatusApiPath, devAppName))
 	data := make(map[string]interface{})
 
 	client := resty.New()
-	resp, err := client.R().
+	resp, err := client.R().SetContext(ctx).
 		SetHeader(restful.HEADER_ContentType, restful.MIME_JSON).
 		SetHeader(constants.XAuthorization, token).
 		SetHeader(constants.XBflUser, owner).
 		Get(url)
 	if err != nil {
 		klog.Errorf("failed to send request to get app status %s, err=%v", devAppName, err)
-		return false, err
+		return "", err
 	}
 	klog.Infof("request app %s status resp.StatusCode: %d", devAppName, resp.StatusCode())
 	if resp.StatusCode() == http.StatusNotFound {
-		return true, nil
+		return "uninstalled", nil
 	}
 	if resp.StatusCode() != http.StatusOK {
-		return false, errors.New(string(resp.Body()))
+		return "", errors.New(string(resp.Body()))
 	}
 	klog.Info("resp.Body: ", string(resp.Body()))
 	err = json.Unmarshal(resp.Body(), &data)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 	appStatus, ok := data["status"]
 	if !ok {
-		return false, fmt.Errorf("status filed not found")
+		return "", fmt.Errorf("status filed not found")
 	}
 	statusMap, ok := appStatus.(map[string]interface{})
 	if !ok {
-		return false, fmt.Errorf("status is not a map")
+		return "", fmt.Errorf("status is not a map")
 	}
 	state, ok := statusMap["state"].(string)
 	if !ok {
-		return false, fmt.Errorf("state is not a string")
+		return "", fmt.Errorf("state is not a string")
 	}
-	if state == "uninstalled" || state == "installFailed" ||
-		state == "pendingCanceled" || state == "downloadingCanceled" ||
-		state == "installingCanceled" || state == "downloadFailed" ||
-		state == "pendingCancelFailed" || state == "downloadingCancelFailed" ||
-		state == "installingCancelFailed" {
-		return true, nil
+	return state, nil
+}
+
+func (a *appOp) Cancel(ctx context.Context, owner, devAppName, token string) error {
+	url := fmt.Sprintf("%s%s", appServiceHost, fmt.Sprintf(cancelApiPath, devAppName))
+	client := resty.New().SetTimeout(5 * time.Second)
+	resp, err := client.R().SetContext(ctx).
+		SetHeader(restful.HEADER_ContentType, restful.MIME_JSON).
+		SetHeader(constants.XAuthorization, token).
+		SetHeader(constants.XBflUser, owner).
+		Post(url)
+	if err != nil {
+		klog.Errorf("failed to send request to cancel app %s, err=%v", devAppName, err)
+		return err
+	}
+	klog.Infof("request cancel app %s resp.StatusCode: %d", devAppName, resp.StatusCode())
+	if resp.StatusCode() != http.StatusOK {
+		return errors.New(string(resp.Body()))
 	}
+	return nil
+}
 
-	return false, nil
+var applicationManagerGVR = schema.GroupVersionResource{
+	Group:    "app.bytetrade.io",
+	Version:  "v1alpha1",
+	Resource: "applicationmanagers",
+}
+
+// GetAppManagerState returns the state of the ApplicationManager of app, it is read with the
+// service account of devbox instead of a token of the owner. An app without one is uninstalled.
+func (a *appOp) GetAppManagerState(ctx context.Context, owner, devAppName string) (string, error) {
+	a.once.Do(func() {
+		config, err := ctrl.GetConfig()
+		if err != nil {
+			a.err = err
+			return
+		}
+		a.client, a.err = dynamic.NewForConfig(config)
+	})
+	if a.err != nil {
+		return "", a.err
+	}
+	name := fmt.Sprintf("%s-%s-%s", devAppName, owner, devAppName)
+	am, err := a.client.Resource(applicationManagerGVR).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "uninstalled", nil
+	}
+	if err != nil {
+		klog.Errorf("failed to get app manager name=%s, err=%v", name, err)
+		return "", err
+	}
+	state, _, err := unstructured.NestedString(am.Object, "status", "state")
+	if err != nil {
+		return "", err
+	}
+	if state == "" {
+		return "", fmt.Errorf("app manager %s has no state", name)
+	}
+	return state, nil
 }
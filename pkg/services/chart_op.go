@@ -36,6 +36,7 @@ type ChartOp interface {
 	Upload(ctx context.Context, owner, devAppName, token, version string) error
 	Delete(ctx context.Context, owner, devAppName, token, version string) error
 	CheckVersion(ctx context.Context, owner, devAppName, version string) (bool, error)
+	Versions(ctx context.Context, owner, devAppName string) ([]string, error)
 }
 
 type chartOp struct {
@@ -91,29 +92,37 @@ func (c *chartOp) Upload(ctx context.Context, owner, devAppName, token, version
 }
 
 func (c *chartOp) CheckVersion(ctx context.Context, owner, devAppName, version string) (bool, error) {
+	versions, err := c.Versions(ctx, owner, devAppName)
+	if err != nil {
+		return false, err
+	}
+	return funk.Contains(versions, version), nil
+}
+
+// Versions returns the chart versions of the app in the market, it is empty if the market has none.
+func (c *chartOp) Versions(ctx context.Context, owner, devAppName string) ([]string, error) {
 	url := fmt.Sprintf("%s%s", chartRepoHost, fmt.Sprintf(versionsApiPath, devAppName))
 	client := resty.New()
-	resp, err := client.R().
+	resp, err := client.R().SetContext(ctx).
 		SetHeader("X-Market-Source", chartSourceStudio).
 		SetHeader("X-Market-User", owner).
 		Get(url)
 	if err != nil {
-		klog.Errorf("check chart %s version failed %v", devAppName, err)
-		return false, err
+		klog.Errorf("get chart %s versions failed %v", devAppName, err)
+		return nil, err
 	}
 	if resp.StatusCode() == http.StatusNotFound {
-		return false, nil
+		return nil, nil
 	}
 	if resp.StatusCode() != http.StatusOK {
 		klog.Errorf("/api/v1/charts/%s/versions status code not = 200, err=%v", string(resp.Body()))
-		return false, errors.New(string(resp.Body()))
+		return nil, errors.New(string(resp.Body()))
 	}
 	var ret ChartVersions
 	err = json.Unmarshal(resp.Body(), &ret)
 	if err != nil {
 		klog.Errorf("unmarshal data to chartVersion failed %v", err)
-		return false, err
+		return nil, err
 	}
-	t := funk.Contains(ret.Data.Versions, version)
-	return t, nil
+	return ret.Data.Versions, nil
 }
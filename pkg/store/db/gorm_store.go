@@ -0,0 +1,273 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"gorm.io/gorm"
+)
+
+type devAppStore struct {
+	db *gorm.DB
+}
+
+func (s *devAppStore) List(owner string) ([]*model.DevApp, error) {
+	list := make([]*model.DevApp, 0)
+	err := s.db.Where("owner = ?", owner).Order("update_time desc").Find(&list).Error
+	return list, err
+}
+
+func (s *devAppStore) Get(owner, name string) (*model.DevApp, error) {
+	var app model.DevApp
+	err := s.db.Where("owner = ?", owner).Where("app_name = ?", name).First(&app).Error
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (s *devAppStore) GetByTitle(owner, title string) (*model.DevApp, error) {
+	var app model.DevApp
+	err := s.db.Where("owner = ?", owner).Where("title = ?", title).First(&app).Error
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (s *devAppStore) ListShared(username string) ([]*model.DevApp, error) {
+	list := make([]*model.DevApp, 0)
+	err := s.db.Where("id in (?)", s.db.Model(&model.DevAppCollaborator{}).Select("app_id").Where("username = ?", username)).
+		Where("owner <> ?", username).
+		Order("update_time desc").Find(&list).Error
+	return list, err
+}
+
+func (s *devAppStore) ListInStates(states ...string) ([]*model.DevApp, error) {
+	list := make([]*model.DevApp, 0)
+	err := s.db.Where("state in ?", states).Order("id").Find(&list).Error
+	return list, err
+}
+
+func (s *devAppStore) Create(app *model.DevApp) error {
+	return s.db.Create(app).Error
+}
+
+func (s *devAppStore) Update(owner, name string, updates map[string]interface{}) (*model.DevApp, error) {
+	app, err := s.Get(owner, name)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Model(app).Updates(updates).Error
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (s *devAppStore) Delete(id uint) error {
+	return s.db.Where("id = ?", id).Delete(&model.DevApp{}).Error
+}
+
+func (s *devAppStore) DeleteByName(owner, name string) error {
+	return s.db.Where("owner = ?", owner).Where("app_name = ?", name).Delete(&model.DevApp{}).Error
+}
+
+type devContainerStore struct {
+	db *gorm.DB
+}
+
+func (s *devContainerStore) Get(id uint) (*model.DevContainers, error) {
+	var c model.DevContainers
+	err := s.db.Where("id = ?", id).First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *devContainerStore) GetByName(owner, name string) (*model.DevContainers, error) {
+	var c model.DevContainers
+	err := s.db.Where("owner = ?", owner).Where("name = ?", name).First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *devContainerStore) Create(c *model.DevContainers) error {
+	return s.db.Create(c).Error
+}
+
+func (s *devContainerStore) Rename(owner, name, newName string) error {
+	return s.db.Model(&model.DevContainers{}).Where("owner = ?", owner).Where("name = ?", name).Update("name", newName).Error
+}
+
+func (s *devContainerStore) DeleteByName(owner, name string) error {
+	return s.db.Where("owner = ?", owner).Where("name = ?", name).Delete(&model.DevContainers{}).Error
+}
+
+func (s *devContainerStore) ListAppContainers(appID uint) ([]*model.DevAppContainers, error) {
+	list := make([]*model.DevAppContainers, 0)
+	err := s.db.Where("app_id = ?", appID).Find(&list).Error
+	return list, err
+}
+
+func (s *devContainerStore) GetAppContainer(appID uint, containerName string) (*model.DevAppContainers, error) {
+	var c model.DevAppContainers
+	err := s.db.Where("app_id = ?", appID).Where("container_name = ?", containerName).First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *devContainerStore) GetBinding(containerID uint) (*model.DevAppContainers, error) {
+	var c model.DevAppContainers
+	err := s.db.Where("container_id = ?", containerID).First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *devContainerStore) CreateAppContainer(c *model.DevAppContainers) error {
+	return s.db.Create(c).Error
+}
+
+func (s *devContainerStore) DeleteAppContainer(c *model.DevAppContainers) error {
+	return s.db.Where("container_id = ?", c.ContainerID).
+		Where("pod_selector = ?", c.PodSelector).
+		Where("container_name = ?", c.ContainerName).
+		Where("app_id = ?", c.AppID).
+		Delete(&model.DevAppContainers{}).Error
+}
+
+func (s *devContainerStore) DeleteAppContainers(appID uint) error {
+	return s.db.Where("app_id = ?", appID).Delete(&model.DevAppContainers{}).Error
+}
+
+func (s *devContainerStore) ListContainerInfo(owner, appName string) ([]*model.DevContainerInfo, error) {
+	list := make([]*model.DevContainerInfo, 0)
+	err := s.db.Table("dev_apps a").
+		Select("dc.id, dc.dev_env, dc.name, dc.create_time, dc.update_time, ac.pod_selector, ac.app_id, ac.container_name, ac.image, a.app_name").
+		Joins("join dev_app_containers ac on a.id = ac.app_id").
+		Joins("join dev_containers dc on ac.container_id = dc.id").
+		Where("a.owner = ?", owner).
+		Where("a.app_name = ?", appName).
+		Scan(&list).Error
+	return list, err
+}
+
+type devAppJobStore struct {
+	db *gorm.DB
+}
+
+func (s *devAppJobStore) Create(job *model.DevAppJob) error {
+	return s.db.Create(job).Error
+}
+
+func (s *devAppJobStore) Save(job *model.DevAppJob) error {
+	return s.db.Save(job).Error
+}
+
+func (s *devAppJobStore) Get(owner, jobID string) (*model.DevAppJob, error) {
+	var job model.DevAppJob
+	err := s.db.Where("owner = ?", owner).Where("job_id = ?", jobID).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *devAppJobStore) List(owner, appName string, limit int) ([]*model.DevAppJob, error) {
+	list := make([]*model.DevAppJob, 0)
+	err := s.db.Where("owner = ?", owner).Where("app_name = ?", appName).
+		Order("id desc").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+func (s *devAppJobStore) UpdateStates(from []string, state, reason string) error {
+	return s.db.Model(&model.DevAppJob{}).
+		Where("state IN ?", from).
+		Updates(map[string]interface{}{
+			"state":       state,
+			"reason":      reason,
+			"update_time": time.Now(),
+		}).Error
+}
+
+type devAppCollaboratorStore struct {
+	db *gorm.DB
+}
+
+func (s *devAppCollaboratorStore) List(appID uint) ([]*model.DevAppCollaborator, error) {
+	list := make([]*model.DevAppCollaborator, 0)
+	err := s.db.Where("app_id = ?", appID).Order("username").Find(&list).Error
+	return list, err
+}
+
+func (s *devAppCollaboratorStore) Get(appID uint, username string) (*model.DevAppCollaborator, error) {
+	var c model.DevAppCollaborator
+	err := s.db.Where("app_id = ?", appID).Where("username = ?", username).First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s *devAppCollaboratorStore) Save(c *model.DevAppCollaborator) error {
+	exists, err := s.Get(c.AppID, c.Username)
+	if errors.Is(err, ErrNotFound) {
+		return s.db.Create(c).Error
+	}
+	if err != nil {
+		return err
+	}
+	c.ID = exists.ID
+	c.CreateTime = exists.CreateTime
+	c.UpdateTime = time.Now()
+	return s.db.Save(c).Error
+}
+
+func (s *devAppCollaboratorStore) Delete(appID uint, username string) error {
+	return s.db.Where("app_id = ?", appID).Where("username = ?", username).Delete(&model.DevAppCollaborator{}).Error
+}
+
+func (s *devAppCollaboratorStore) DeleteAll(appID uint) error {
+	return s.db.Where("app_id = ?", appID).Delete(&model.DevAppCollaborator{}).Error
+}
+
+type auditStore struct {
+	db *gorm.DB
+}
+
+func (s *auditStore) Append(entry *model.AuditLog) error {
+	entry.ID = 0
+	if entry.CreateTime.IsZero() {
+		entry.CreateTime = time.Now()
+	}
+	return s.db.Create(entry).Error
+}
+
+func (s *auditStore) List(q AuditQuery) ([]*model.AuditLog, int64, error) {
+	tx := s.db.Model(&model.AuditLog{}).Where("owner = ? or actor = ?", q.Username, q.Username)
+	if q.AppName != "" {
+		tx = tx.Where("app_name = ?", q.AppName)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	// a new session so that count and find do not share the statement
+	tx = tx.Session(&gorm.Session{})
+	var total int64
+	err := tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	list := make([]*model.AuditLog, 0)
+	err = tx.Order("id desc").Offset(q.Offset).Limit(q.Limit).Find(&list).Error
+	return list, total, err
+}
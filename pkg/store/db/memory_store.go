@@ -0,0 +1,576 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+)
+
+// memoryDB keeps the records of the in-memory stores, it is meant for tests and local runs.
+type memoryDB struct {
+	mu            sync.Mutex
+	nextID        uint
+	apps          map[uint]*model.DevApp
+	containers    map[uint]*model.DevContainers
+	appContainers map[uint]*model.DevAppContainers
+	jobs          map[uint]*model.DevAppJob
+	collaborators map[uint]*model.DevAppCollaborator
+	audit         []*model.AuditLog
+}
+
+func NewMemoryStores() *Stores {
+	m := &memoryDB{
+		apps:          make(map[uint]*model.DevApp),
+		containers:    make(map[uint]*model.DevContainers),
+		appContainers: make(map[uint]*model.DevAppContainers),
+		jobs:          make(map[uint]*model.DevAppJob),
+		collaborators: make(map[uint]*model.DevAppCollaborator),
+	}
+	return &Stores{
+		Apps:          &memoryAppStore{m},
+		Containers:    &memoryContainerStore{m},
+		Jobs:          &memoryJobStore{m},
+		Collaborators: &memoryCollaboratorStore{m},
+		Audit:         &memoryAuditStore{m},
+	}
+}
+
+func (m *memoryDB) id() uint {
+	m.nextID++
+	return m.nextID
+}
+
+func setTimes(createTime, updateTime *time.Time) {
+	now := time.Now()
+	if createTime.IsZero() {
+		*createTime = now
+	}
+	if updateTime.IsZero() {
+		*updateTime = now
+	}
+}
+
+// setColumns applies gorm style column updates to the struct v points to.
+func setColumns(v interface{}, updates map[string]interface{}) error {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for col, val := range updates {
+		found := false
+		for i := 0; i < rt.NumField(); i++ {
+			if columnName(rt.Field(i)) != col {
+				continue
+			}
+			f := rv.Field(i)
+			nv := reflect.ValueOf(val)
+			if !nv.Type().AssignableTo(f.Type()) {
+				if !nv.Type().ConvertibleTo(f.Type()) {
+					return fmt.Errorf("can not set column %s to %v", col, val)
+				}
+				nv = nv.Convert(f.Type())
+			}
+			f.Set(nv)
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("unknown column %s", col)
+		}
+	}
+	return nil
+}
+
+func columnName(f reflect.StructField) string {
+	for _, part := range strings.Split(f.Tag.Get("gorm"), ";") {
+		if strings.HasPrefix(part, "column:") {
+			return strings.TrimPrefix(part, "column:")
+		}
+	}
+	return ""
+}
+
+type memoryAppStore struct {
+	m *memoryDB
+}
+
+func (s *memoryAppStore) find(match func(a *model.DevApp) bool) *model.DevApp {
+	ids := make([]uint, 0, len(s.m.apps))
+	for id := range s.m.apps {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if match(s.m.apps[id]) {
+			return s.m.apps[id]
+		}
+	}
+	return nil
+}
+
+func (s *memoryAppStore) List(owner string) ([]*model.DevApp, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.DevApp, 0)
+	for _, a := range s.m.apps {
+		if a.Owner == owner {
+			cp := *a
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdateTime.After(list[j].UpdateTime) })
+	return list, nil
+}
+
+func (s *memoryAppStore) first(match func(a *model.DevApp) bool) (*model.DevApp, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	a := s.find(match)
+	if a == nil {
+		return nil, ErrNotFound
+	}
+	cp := *a
+	return &cp, nil
+}
+
+func (s *memoryAppStore) Get(owner, name string) (*model.DevApp, error) {
+	return s.first(func(a *model.DevApp) bool { return a.Owner == owner && a.AppName == name })
+}
+
+func (s *memoryAppStore) GetByTitle(owner, title string) (*model.DevApp, error) {
+	return s.first(func(a *model.DevApp) bool { return a.Owner == owner && a.Title == title })
+}
+
+func (s *memoryAppStore) ListShared(username string) ([]*model.DevApp, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.DevApp, 0)
+	for _, c := range s.m.collaborators {
+		a, ok := s.m.apps[c.AppID]
+		if !ok || c.Username != username || a.Owner == username {
+			continue
+		}
+		cp := *a
+		list = append(list, &cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].UpdateTime.After(list[j].UpdateTime) })
+	return list, nil
+}
+
+func (s *memoryAppStore) ListInStates(states ...string) ([]*model.DevApp, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.DevApp, 0)
+	for _, a := range s.m.apps {
+		for _, state := range states {
+			if a.State == state {
+				cp := *a
+				list = append(list, &cp)
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *memoryAppStore) Create(app *model.DevApp) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if s.find(func(a *model.DevApp) bool { return a.Owner == app.Owner && a.AppName == app.AppName }) != nil {
+		return ErrDuplicated
+	}
+	app.ID = s.m.id()
+	setTimes(&app.CreateTime, &app.UpdateTime)
+	cp := *app
+	s.m.apps[app.ID] = &cp
+	return nil
+}
+
+func (s *memoryAppStore) Update(owner, name string, updates map[string]interface{}) (*model.DevApp, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	a := s.find(func(a *model.DevApp) bool { return a.Owner == owner && a.AppName == name })
+	if a == nil {
+		return nil, ErrNotFound
+	}
+	cp := *a
+	if err := setColumns(&cp, updates); err != nil {
+		return nil, err
+	}
+	if cp.Owner != a.Owner || cp.AppName != a.AppName {
+		if s.find(func(o *model.DevApp) bool { return o.Owner == cp.Owner && o.AppName == cp.AppName }) != nil {
+			return nil, ErrDuplicated
+		}
+	}
+	*a = cp
+	return &cp, nil
+}
+
+func (s *memoryAppStore) Delete(id uint) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	delete(s.m.apps, id)
+	return nil
+}
+
+func (s *memoryAppStore) DeleteByName(owner, name string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for id, a := range s.m.apps {
+		if a.Owner == owner && a.AppName == name {
+			delete(s.m.apps, id)
+		}
+	}
+	return nil
+}
+
+type memoryContainerStore struct {
+	m *memoryDB
+}
+
+func (s *memoryContainerStore) Get(id uint) (*model.DevContainers, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c, ok := s.m.containers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (s *memoryContainerStore) GetByName(owner, name string) (*model.DevContainers, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, c := range s.m.containers {
+		if c.Owner == owner && c.Name == name {
+			cp := *c
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryContainerStore) Create(c *model.DevContainers) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c.ID = s.m.id()
+	setTimes(&c.CreateTime, &c.UpdateTime)
+	cp := *c
+	s.m.containers[c.ID] = &cp
+	return nil
+}
+
+func (s *memoryContainerStore) Rename(owner, name, newName string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, c := range s.m.containers {
+		if c.Owner == owner && c.Name == name {
+			c.Name = newName
+		}
+	}
+	return nil
+}
+
+func (s *memoryContainerStore) DeleteByName(owner, name string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for id, c := range s.m.containers {
+		if c.Owner == owner && c.Name == name {
+			delete(s.m.containers, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryContainerStore) appContainers(match func(c *model.DevAppContainers) bool) []*model.DevAppContainers {
+	list := make([]*model.DevAppContainers, 0)
+	for _, c := range s.m.appContainers {
+		if match(c) {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *memoryContainerStore) ListAppContainers(appID uint) ([]*model.DevAppContainers, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	return s.appContainers(func(c *model.DevAppContainers) bool { return c.AppID == appID }), nil
+}
+
+func (s *memoryContainerStore) GetAppContainer(appID uint, containerName string) (*model.DevAppContainers, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := s.appContainers(func(c *model.DevAppContainers) bool {
+		return c.AppID == appID && c.ContainerName == containerName
+	})
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return list[0], nil
+}
+
+func (s *memoryContainerStore) GetBinding(containerID uint) (*model.DevAppContainers, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := s.appContainers(func(c *model.DevAppContainers) bool { return c.ContainerID == containerID })
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return list[0], nil
+}
+
+func (s *memoryContainerStore) CreateAppContainer(c *model.DevAppContainers) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c.ID = s.m.id()
+	setTimes(&c.CreateTime, &c.UpdateTime)
+	cp := *c
+	s.m.appContainers[c.ID] = &cp
+	return nil
+}
+
+func (s *memoryContainerStore) DeleteAppContainer(c *model.DevAppContainers) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for id, ac := range s.m.appContainers {
+		if ac.ContainerID == c.ContainerID && ac.PodSelector == c.PodSelector &&
+			ac.ContainerName == c.ContainerName && ac.AppID == c.AppID {
+			delete(s.m.appContainers, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryContainerStore) DeleteAppContainers(appID uint) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for id, ac := range s.m.appContainers {
+		if ac.AppID == appID {
+			delete(s.m.appContainers, id)
+		}
+	}
+	return nil
+}
+
+func (s *memoryContainerStore) ListContainerInfo(owner, appName string) ([]*model.DevContainerInfo, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.DevContainerInfo, 0)
+	for _, a := range s.m.apps {
+		if a.Owner != owner || a.AppName != appName {
+			continue
+		}
+		for _, ac := range s.appContainers(func(c *model.DevAppContainers) bool { return c.AppID == a.ID }) {
+			dc, ok := s.m.containers[ac.ContainerID]
+			if !ok {
+				continue
+			}
+			appID := int(ac.AppID)
+			name := a.AppName
+			list = append(list, &model.DevContainerInfo{
+				DevContainers: *dc,
+				PodSelector:   &ac.PodSelector,
+				AppID:         &appID,
+				ContainerName: &ac.ContainerName,
+				Image:         &ac.Image,
+				AppName:       &name,
+			})
+		}
+	}
+	return list, nil
+}
+
+type memoryJobStore struct {
+	m *memoryDB
+}
+
+func copyJob(job *model.DevAppJob) *model.DevAppJob {
+	cp := *job
+	cp.Steps = append([]model.DevJobStep(nil), job.Steps...)
+	return &cp
+}
+
+func (s *memoryJobStore) Create(job *model.DevAppJob) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	job.ID = s.m.id()
+	setTimes(&job.CreateTime, &job.UpdateTime)
+	s.m.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (s *memoryJobStore) Save(job *model.DevAppJob) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if job.ID == 0 {
+		job.ID = s.m.id()
+	}
+	s.m.jobs[job.ID] = copyJob(job)
+	return nil
+}
+
+func (s *memoryJobStore) Get(owner, jobID string) (*model.DevAppJob, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, j := range s.m.jobs {
+		if j.Owner == owner && j.JobID == jobID {
+			return copyJob(j), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryJobStore) List(owner, appName string, limit int) ([]*model.DevAppJob, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.DevAppJob, 0)
+	for _, j := range s.m.jobs {
+		if j.Owner == owner && j.AppName == appName {
+			list = append(list, copyJob(j))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (s *memoryJobStore) UpdateStates(from []string, state, reason string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for _, j := range s.m.jobs {
+		for _, f := range from {
+			if j.State == f {
+				j.State = state
+				j.Reason = reason
+				j.UpdateTime = time.Now()
+				break
+			}
+		}
+	}
+	return nil
+}
+
+type memoryCollaboratorStore struct {
+	m *memoryDB
+}
+
+func (s *memoryCollaboratorStore) List(appID uint) ([]*model.DevAppCollaborator, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.DevAppCollaborator, 0)
+	for _, c := range s.m.collaborators {
+		if c.AppID == appID {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+	return list, nil
+}
+
+func (s *memoryCollaboratorStore) find(appID uint, username string) *model.DevAppCollaborator {
+	for _, c := range s.m.collaborators {
+		if c.AppID == appID && c.Username == username {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *memoryCollaboratorStore) Get(appID uint, username string) (*model.DevAppCollaborator, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	c := s.find(appID, username)
+	if c == nil {
+		return nil, ErrNotFound
+	}
+	cp := *c
+	return &cp, nil
+}
+
+func (s *memoryCollaboratorStore) Save(c *model.DevAppCollaborator) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if exists := s.find(c.AppID, c.Username); exists != nil {
+		c.ID = exists.ID
+		c.CreateTime = exists.CreateTime
+		c.UpdateTime = time.Now()
+	} else {
+		c.ID = s.m.id()
+		setTimes(&c.CreateTime, &c.UpdateTime)
+	}
+	cp := *c
+	s.m.collaborators[c.ID] = &cp
+	return nil
+}
+
+func (s *memoryCollaboratorStore) Delete(appID uint, username string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	if c := s.find(appID, username); c != nil {
+		delete(s.m.collaborators, c.ID)
+	}
+	return nil
+}
+
+func (s *memoryCollaboratorStore) DeleteAll(appID uint) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	for id, c := range s.m.collaborators {
+		if c.AppID == appID {
+			delete(s.m.collaborators, id)
+		}
+	}
+	return nil
+}
+
+type memoryAuditStore struct {
+	m *memoryDB
+}
+
+func (s *memoryAuditStore) Append(entry *model.AuditLog) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	entry.ID = s.m.id()
+	if entry.CreateTime.IsZero() {
+		entry.CreateTime = time.Now()
+	}
+	cp := *entry
+	s.m.audit = append(s.m.audit, &cp)
+	return nil
+}
+
+func (s *memoryAuditStore) List(q AuditQuery) ([]*model.AuditLog, int64, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+	list := make([]*model.AuditLog, 0)
+	for i := len(s.m.audit) - 1; i >= 0; i-- {
+		e := s.m.audit[i]
+		if e.Owner != q.Username && e.Actor != q.Username {
+			continue
+		}
+		if (q.AppName != "" && e.AppName != q.AppName) || (q.Action != "" && e.Action != q.Action) {
+			continue
+		}
+		cp := *e
+		list = append(list, &cp)
+	}
+	total := int64(len(list))
+	if q.Offset >= len(list) {
+		return []*model.AuditLog{}, total, nil
+	}
+	list = list[q.Offset:]
+	if q.Limit > 0 && len(list) > q.Limit {
+		list = list[:q.Limit]
+	}
+	return list, total, nil
+}
@@ -0,0 +1,156 @@
+package db
+
+import "time"
+
+// The tables as each migration leaves them. A migration creates and alters tables from
+// these, never from the models, so it replays the same way on every database however
+// the models change later. A change of the schema is a new migration with its own types.
+
+type devAppV1 struct {
+	ID           uint      `gorm:"primarykey"`
+	Title        string    `gorm:"type:varchar(50);column:title;index:title"`
+	AppName      string    `gorm:"type:varchar(50);not null;column:app_name;index:app_name"`
+	DevEnv       string    `gorm:"type:varchar(256);not null;column:dev_env"`
+	AppType      string    `gorm:"type:varchar(20);column:app_type"`
+	Description  string    `gorm:"type:text;column:description"`
+	CreateTime   time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime   time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time;index:update_time"`
+	State        string    `gorm:"type:varchar(20);column:state"`
+	Owner        string    `gorm:"type:varchar(20);column:owner"`
+	Reason       string    `gorm:"type:text;column:reason"`
+	ChartVersion string    `gorm:"type:varchar(20);column:chart_version"`
+}
+
+func (devAppV1) TableName() string {
+	return "dev_apps"
+}
+
+type devContainerV2 struct {
+	ID         uint      `gorm:"primarykey"`
+	DevEnv     string    `gorm:"type:varchar(256);not null;column:dev_env"`
+	Name       string    `gorm:"type:varchar(256);not null;column:name"`
+	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time"`
+}
+
+func (devContainerV2) TableName() string {
+	return "dev_containers"
+}
+
+type devAppContainerV3 struct {
+	ID            uint      `gorm:"primarykey"`
+	AppName       string    `gorm:"type:varchar(50);column:app_name"`
+	AppID         uint      `gorm:"column:app_id"`
+	ContainerID   uint      `gorm:"column:container_id"`
+	PodSelector   string    `gorm:"type:varchar(128);column:pod_selector"`
+	ContainerName string    `gorm:"type:varchar(50);column:container_name"`
+	Image         string    `gorm:"type:varchar(128);column:image"`
+	CreateTime    time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime    time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time"`
+}
+
+func (devAppContainerV3) TableName() string {
+	return "dev_app_containers"
+}
+
+type devAppJobV4 struct {
+	ID         uint      `gorm:"primarykey"`
+	JobID      string    `gorm:"type:varchar(64);not null;column:job_id;uniqueIndex:idx_dev_app_jobs_job_id"`
+	AppName    string    `gorm:"type:varchar(50);not null;column:app_name;index:idx_dev_app_jobs_app"`
+	Owner      string    `gorm:"type:varchar(20);column:owner;index:idx_dev_app_jobs_app"`
+	Kind       string    `gorm:"type:varchar(20);column:kind"`
+	State      string    `gorm:"type:varchar(20);column:state"`
+	Step       string    `gorm:"type:varchar(20);column:step"`
+	Steps      string    `gorm:"type:text;column:steps"`
+	Version    string    `gorm:"type:varchar(20);column:version"`
+	Reason     string    `gorm:"type:text;column:reason"`
+	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time"`
+}
+
+func (devAppJobV4) TableName() string {
+	return "dev_app_jobs"
+}
+
+type devAppV5 struct {
+	ID           uint      `gorm:"primarykey"`
+	Title        string    `gorm:"type:varchar(50);column:title;index:title"`
+	AppName      string    `gorm:"type:varchar(50);not null;column:app_name;index:app_name;uniqueIndex:idx_dev_apps_owner_app_name,priority:2"`
+	DevEnv       string    `gorm:"type:varchar(256);not null;column:dev_env"`
+	AppType      string    `gorm:"type:varchar(20);column:app_type"`
+	Description  string    `gorm:"type:text;column:description"`
+	CreateTime   time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime   time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time;index:update_time"`
+	State        string    `gorm:"type:varchar(20);column:state"`
+	Owner        string    `gorm:"type:varchar(20);column:owner;uniqueIndex:idx_dev_apps_owner_app_name,priority:1"`
+	Reason       string    `gorm:"type:text;column:reason"`
+	ChartVersion string    `gorm:"type:varchar(20);column:chart_version"`
+}
+
+func (devAppV5) TableName() string {
+	return "dev_apps"
+}
+
+type devContainerV5 struct {
+	ID         uint      `gorm:"primarykey"`
+	DevEnv     string    `gorm:"type:varchar(256);not null;column:dev_env"`
+	Name       string    `gorm:"type:varchar(256);not null;column:name"`
+	Owner      string    `gorm:"type:varchar(20);column:owner;index:idx_dev_containers_owner"`
+	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time"`
+}
+
+func (devContainerV5) TableName() string {
+	return "dev_containers"
+}
+
+type devAppCollaboratorV6 struct {
+	ID         uint      `gorm:"primarykey"`
+	AppID      uint      `gorm:"not null;column:app_id;uniqueIndex:idx_dev_app_collaborators_app_user"`
+	Username   string    `gorm:"type:varchar(20);not null;column:username;uniqueIndex:idx_dev_app_collaborators_app_user;index:idx_dev_app_collaborators_user"`
+	Role       string    `gorm:"type:varchar(20);not null;column:role"`
+	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time"`
+}
+
+func (devAppCollaboratorV6) TableName() string {
+	return "dev_app_collaborators"
+}
+
+type auditLogV7 struct {
+	ID         uint      `gorm:"primarykey"`
+	Actor      string    `gorm:"type:varchar(20);not null;column:actor;index:idx_audit_logs_actor"`
+	Owner      string    `gorm:"type:varchar(20);column:owner;index:idx_audit_logs_app"`
+	AppName    string    `gorm:"type:varchar(50);column:app_name;index:idx_audit_logs_app"`
+	Action     string    `gorm:"type:varchar(64);not null;column:action"`
+	Method     string    `gorm:"type:varchar(10);column:method"`
+	Path       string    `gorm:"type:varchar(256);column:path"`
+	Params     string    `gorm:"type:text;column:params"`
+	Outcome    string    `gorm:"type:varchar(20);column:outcome"`
+	Message    string    `gorm:"type:text;column:message"`
+	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time;index:idx_audit_logs_create_time"`
+}
+
+func (auditLogV7) TableName() string {
+	return "audit_logs"
+}
+
+type devAppV8 struct {
+	ID                uint      `gorm:"primarykey"`
+	Title             string    `gorm:"type:varchar(50);column:title;index:title"`
+	AppName           string    `gorm:"type:varchar(50);not null;column:app_name;index:app_name;uniqueIndex:idx_dev_apps_owner_app_name,priority:2"`
+	DevEnv            string    `gorm:"type:varchar(256);not null;column:dev_env"`
+	AppType           string    `gorm:"type:varchar(20);column:app_type"`
+	Description       string    `gorm:"type:text;column:description"`
+	CreateTime        time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time"`
+	UpdateTime        time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time;index:update_time"`
+	State             string    `gorm:"type:varchar(20);column:state"`
+	Owner             string    `gorm:"type:varchar(20);column:owner;uniqueIndex:idx_dev_apps_owner_app_name,priority:1"`
+	Reason            string    `gorm:"type:text;column:reason"`
+	ChartVersion      string    `gorm:"type:varchar(20);column:chart_version"`
+	SecurityAllowlist string    `gorm:"type:text;column:security_allowlist"`
+}
+
+func (devAppV8) TableName() string {
+	return "dev_apps"
+}
@@ -0,0 +1,384 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"k8s.io/klog/v2"
+)
+
+// Migration is a numbered schema change, Up must be safe to run on a database
+// created by the table checks that predate migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+type SchemaMigration struct {
+	Version   int       `gorm:"primarykey;autoIncrement:false;column:version"`
+	Name      string    `gorm:"type:varchar(128);column:name"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (m SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create dev_apps",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasTable(devAppV1{}) {
+				return tx.Migrator().CreateTable(devAppV1{})
+			}
+			err := addColumns(tx, &devAppV1{}, "State", "Title", "Owner", "Reason", "ChartVersion")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().AlterColumn(&devAppV1{}, "DevEnv")
+		},
+		Down: dropTable(devAppV1{}),
+	},
+	{
+		Version: 2,
+		Name:    "create dev_containers",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasTable(devContainerV2{}) {
+				return tx.Migrator().CreateTable(devContainerV2{})
+			}
+			return tx.Migrator().AlterColumn(&devContainerV2{}, "DevEnv")
+		},
+		Down: dropTable(devContainerV2{}),
+	},
+	{
+		Version: 3,
+		Name:    "create dev_app_containers",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasTable(devAppContainerV3{}) {
+				return tx.Migrator().CreateTable(devAppContainerV3{})
+			}
+			err := addColumns(tx, &devAppContainerV3{}, "Image", "AppName")
+			if err != nil {
+				return err
+			}
+			return tx.Migrator().AlterColumn(&devAppContainerV3{}, "PodSelector")
+		},
+		Down: dropTable(devAppContainerV3{}),
+	},
+	{
+		Version: 4,
+		Name:    "create dev_app_jobs",
+		Up:      createTable(devAppJobV4{}),
+		Down:    dropTable(devAppJobV4{}),
+	},
+	{
+		Version: 5,
+		Name:    "scope dev apps and containers by owner",
+		Up: func(tx *gorm.DB) error {
+			err := addColumns(tx, &devContainerV5{}, "Owner")
+			if err != nil {
+				return err
+			}
+			// dev containers take the owner of the app they are bound to
+			err = tx.Exec(`update dev_containers set owner = (
+				select a.owner from dev_apps a join dev_app_containers ac on a.id = ac.app_id
+				where ac.container_id = dev_containers.id limit 1)
+			where owner is null or owner = ''`).Error
+			if err != nil {
+				return err
+			}
+			// the rest are unbound, they can only belong to the owner of a single user devbox
+			var owners []string
+			err = tx.Table(devAppV5{}.TableName()).Where("owner <> ''").Distinct().Pluck("owner", &owners).Error
+			if err != nil {
+				return err
+			}
+			if len(owners) == 1 {
+				err = tx.Exec(`update dev_containers set owner = ? where owner is null or owner = ''`, owners[0]).Error
+				if err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasIndex(&devContainerV5{}, "idx_dev_containers_owner") {
+				err = tx.Migrator().CreateIndex(&devContainerV5{}, "idx_dev_containers_owner")
+				if err != nil {
+					return err
+				}
+			}
+
+			conflicts, err := AppNameConflicts(tx)
+			if err != nil {
+				return err
+			}
+			unowned, err := UnownedContainers(tx)
+			if err != nil {
+				return err
+			}
+			reports := make([]string, 0, 2)
+			if len(conflicts) > 0 {
+				msgs := make([]string, 0, len(conflicts))
+				for _, c := range conflicts {
+					klog.Errorf("dev app %s of owner %s exists %d times", c.AppName, c.Owner, c.Count)
+					msgs = append(msgs, fmt.Sprintf("%s/%s (%d)", c.Owner, c.AppName, c.Count))
+				}
+				reports = append(reports, "duplicated dev apps must be renamed or deleted first: "+strings.Join(msgs, ", "))
+			}
+			if len(unowned) > 0 {
+				msgs := make([]string, 0, len(unowned))
+				for _, c := range unowned {
+					klog.Errorf("dev container %s (%d) is not bound to any app and has no owner", c.Name, c.ID)
+					msgs = append(msgs, fmt.Sprintf("%s (%d)", c.Name, c.ID))
+				}
+				reports = append(reports, "dev containers without owner must be given one or deleted first: "+strings.Join(msgs, ", "))
+			}
+			if len(reports) > 0 {
+				return errors.New(strings.Join(reports, "; "))
+			}
+			if tx.Migrator().HasIndex(&devAppV5{}, "idx_dev_apps_owner_app_name") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&devAppV5{}, "idx_dev_apps_owner_app_name")
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Migrator().HasIndex(&devAppV5{}, "idx_dev_apps_owner_app_name") {
+				err := tx.Migrator().DropIndex(&devAppV5{}, "idx_dev_apps_owner_app_name")
+				if err != nil {
+					return err
+				}
+			}
+			if tx.Migrator().HasIndex(&devContainerV5{}, "idx_dev_containers_owner") {
+				err := tx.Migrator().DropIndex(&devContainerV5{}, "idx_dev_containers_owner")
+				if err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropColumn(&devContainerV5{}, "Owner")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create dev_app_collaborators",
+		Up:      createTable(devAppCollaboratorV6{}),
+		Down:    dropTable(devAppCollaboratorV6{}),
+	},
+	{
+		Version: 7,
+		Name:    "create audit_logs",
+		Up:      createTable(auditLogV7{}),
+		Down:    dropTable(auditLogV7{}),
+	},
+	{
+		Version: 8,
+		Name:    "add security_allowlist to dev_apps",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &devAppV8{}, "SecurityAllowlist")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&devAppV8{}, "SecurityAllowlist")
+		},
+	},
+}
+
+// AppNameConflict is an app name used by more than one dev app of the same owner.
+type AppNameConflict struct {
+	Owner   string
+	AppName string
+	Count   int
+}
+
+func AppNameConflicts(d *gorm.DB) ([]AppNameConflict, error) {
+	list := make([]AppNameConflict, 0)
+	err := d.Table(devAppV5{}.TableName()).
+		Select("owner, app_name, count(*) as count").
+		Group("owner, app_name").
+		Having("count(*) > 1").
+		Order("owner, app_name").
+		Scan(&list).Error
+	return list, err
+}
+
+// UnownedContainer is a dev container the owner backfill could not give an owner to.
+type UnownedContainer struct {
+	ID   uint
+	Name string
+}
+
+func UnownedContainers(d *gorm.DB) ([]UnownedContainer, error) {
+	list := make([]UnownedContainer, 0)
+	err := d.Table(devContainerV5{}.TableName()).
+		Select("id, name").
+		Where("owner is null or owner = ''").
+		Order("id").
+		Scan(&list).Error
+	return list, err
+}
+
+func createTable(m interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		if tx.Migrator().HasTable(m) {
+			return nil
+		}
+		return tx.Migrator().CreateTable(m)
+	}
+}
+
+func dropTable(m interface{}) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(m)
+	}
+}
+
+func addColumns(tx *gorm.DB, m interface{}, fields ...string) error {
+	for _, f := range fields {
+		if tx.Migrator().HasColumn(m, f) {
+			continue
+		}
+		err := tx.Migrator().AddColumn(m, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Migrations() []Migration {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return sorted
+}
+
+func appliedMigrations(d *gorm.DB) (map[int]SchemaMigration, error) {
+	if !d.Migrator().HasTable(SchemaMigration{}) {
+		err := d.Migrator().CreateTable(SchemaMigration{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	list := make([]SchemaMigration, 0)
+	err := d.Order("version").Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(list))
+	for _, m := range list {
+		applied[m.Version] = m
+	}
+	return applied, nil
+}
+
+// MigrateUp applies the pending migrations up to target, a target of 0 applies all of them.
+func MigrateUp(d *gorm.DB, target int) error {
+	if err := checkMigrations(); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(d)
+	if err != nil {
+		return err
+	}
+	for _, m := range Migrations() {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		klog.Infof("apply migration %d: %s", m.Version, m.Name)
+		err = d.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d %s failed: %v", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown rolls back the last steps applied migrations.
+func MigrateDown(d *gorm.DB, steps int) error {
+	applied, err := appliedMigrations(d)
+	if err != nil {
+		return err
+	}
+	list := Migrations()
+	for i := len(list) - 1; i >= 0 && steps > 0; i-- {
+		m := list[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %d %s can not be rolled back", m.Version, m.Name)
+		}
+		klog.Infof("roll back migration %d: %s", m.Version, m.Name)
+		err = d.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("roll back migration %d %s failed: %v", m.Version, m.Name, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+func GetMigrationStatus(d *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(d)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range Migrations() {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+		}
+		status = append(status, s)
+	}
+	for v, a := range applied {
+		if !hasMigration(v) {
+			klog.Warningf("applied migration %d %s is unknown to this devbox", v, a.Name)
+		}
+	}
+	return status, nil
+}
+
+func hasMigration(version int) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func checkMigrations() error {
+	seen := make(map[int]bool)
+	for _, m := range migrations {
+		if m.Version <= 0 || seen[m.Version] {
+			return fmt.Errorf("invalid or duplicate migration version %d", m.Version)
+		}
+		seen[m.Version] = true
+	}
+	return nil
+}
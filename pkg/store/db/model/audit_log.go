@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// AuditLog records a mutating studio operation, rows are only ever appended.
+type AuditLog struct {
+	ID         uint                   `gorm:"primarykey" json:"id"`
+	Actor      string                 `gorm:"type:varchar(20);not null;column:actor;index:idx_audit_logs_actor" json:"actor"`
+	Owner      string                 `gorm:"type:varchar(20);column:owner;index:idx_audit_logs_app" json:"owner"`
+	AppName    string                 `gorm:"type:varchar(50);column:app_name;index:idx_audit_logs_app" json:"appName"`
+	Action     string                 `gorm:"type:varchar(64);not null;column:action" json:"action"`
+	Method     string                 `gorm:"type:varchar(10);column:method" json:"method,omitempty"`
+	Path       string                 `gorm:"type:varchar(256);column:path" json:"path,omitempty"`
+	Params     map[string]interface{} `gorm:"type:text;column:params;serializer:json" json:"params,omitempty"`
+	Outcome    string                 `gorm:"type:varchar(20);column:outcome" json:"outcome"`
+	Message    string                 `gorm:"type:text;column:message" json:"message,omitempty"`
+	CreateTime time.Time              `gorm:"default:CURRENT_TIMESTAMP;column:create_time;index:idx_audit_logs_create_time" json:"createTime"`
+}
+
+func (a AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+type DevAppCollaborator struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	AppID      uint      `gorm:"not null;column:app_id;uniqueIndex:idx_dev_app_collaborators_app_user" json:"appId"`
+	Username   string    `gorm:"type:varchar(20);not null;column:username;uniqueIndex:idx_dev_app_collaborators_app_user;index:idx_dev_app_collaborators_user" json:"username"`
+	Role       string    `gorm:"type:varchar(20);not null;column:role" json:"role"`
+	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time" json:"createTime"`
+	UpdateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time" json:"updateTime"`
+}
+
+func (c DevAppCollaborator) TableName() string {
+	return "dev_app_collaborators"
+}
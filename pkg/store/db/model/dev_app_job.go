@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type DevAppJob struct {
+	ID         uint         `gorm:"primarykey" json:"id"`
+	JobID      string       `gorm:"type:varchar(64);not null;column:job_id;uniqueIndex:idx_dev_app_jobs_job_id" json:"jobId"`
+	AppName    string       `gorm:"type:varchar(50);not null;column:app_name;index:idx_dev_app_jobs_app" json:"appName"`
+	Owner      string       `gorm:"type:varchar(20);column:owner;index:idx_dev_app_jobs_app" json:"owner"`
+	Kind       string       `gorm:"type:varchar(20);column:kind" json:"kind"`
+	State      string       `gorm:"type:varchar(20);column:state" json:"state"`
+	Step       string       `gorm:"type:varchar(20);column:step" json:"step"`
+	Steps      []DevJobStep `gorm:"type:text;column:steps;serializer:json" json:"steps"`
+	Version    string       `gorm:"type:varchar(20);column:version" json:"version"`
+	Reason     string       `gorm:"type:text;column:reason" json:"reason"`
+	CreateTime time.Time    `gorm:"default:CURRENT_TIMESTAMP;column:create_time" json:"createTime"`
+	UpdateTime time.Time    `gorm:"default:CURRENT_TIMESTAMP;column:update_time" json:"updateTime"`
+}
+
+type DevJobStep struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+	// Detail is the structured outcome of the step, the lint result of the lint step
+	Detail    interface{} `json:"detail,omitempty"`
+	StartTime *time.Time  `json:"startTime,omitempty"`
+	EndTime   *time.Time  `json:"endTime,omitempty"`
+}
+
+func (j DevAppJob) TableName() string {
+	return "dev_app_jobs"
+}
@@ -6,6 +6,7 @@ type DevContainers struct {
 	ID         uint      `gorm:"primarykey" json:"id"`
 	DevEnv     string    `gorm:"type:varchar(256);not null;column:dev_env" json:"devEnv"`
 	Name       string    `gorm:"type:varchar(256);not null;column:name" json:"devContainerName"`
+	Owner      string    `gorm:"type:varchar(20);column:owner;index:idx_dev_containers_owner" json:"owner"`
 	CreateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:create_time" json:"createTime"`
 	UpdateTime time.Time `gorm:"default:CURRENT_TIMESTAMP;column:update_time" json:"updateTime"`
 }
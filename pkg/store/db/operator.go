@@ -3,134 +3,125 @@ package db
 import (
 	"fmt"
 	"os"
+	"sync"
 
-	"github.com/beclab/devbox/pkg/store/db/model"
-
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
 type DbOperator struct {
 	DB *gorm.DB
 }
 
+type Config struct {
+	Driver string
+	// DSN is the connection string for postgres and the database file for sqlite
+	DSN string
+}
+
 var (
-	db *gorm.DB
+	db     *gorm.DB
+	dbErr  error
+	once   sync.Once
+	config = ConfigFromEnv("")
 )
 
-func init() {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=5432 sslmode=allow",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USERNAME"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"))
-
-	var err error
-	db, err = gorm.Open(postgres.New(
-		postgres.Config{
-			DSN:                  dsn,
-			PreferSimpleProtocol: true,
-		}),
-		&gorm.Config{})
-	if err != nil {
-		panic(err)
+// ConfigFromEnv reads DB_PATH for sqlite, or DB_HOST, DB_USERNAME, DB_PASSWORD and DB_NAME for postgres.
+// An empty driver falls back to DB_DRIVER, then to postgres.
+func ConfigFromEnv(driver string) Config {
+	if driver == "" {
+		driver = os.Getenv("DB_DRIVER")
 	}
-	err = createTableIfNotExists()
-	if err != nil {
-		panic(err)
+	if driver == DriverSqlite {
+		path := os.Getenv("DB_PATH")
+		if path == "" {
+			path = "devbox.db"
+		}
+		return Config{Driver: DriverSqlite, DSN: path}
+	}
+	if driver == "" {
+		driver = DriverPostgres
+	}
+	return Config{
+		Driver: driver,
+		DSN: fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=5432 sslmode=allow",
+			os.Getenv("DB_HOST"),
+			os.Getenv("DB_USERNAME"),
+			os.Getenv("DB_PASSWORD"),
+			os.Getenv("DB_NAME")),
 	}
 }
 
-func createTableIfNotExists() (err error) {
-	if !db.Migrator().HasTable(model.DevApp{}) {
-		err = db.Migrator().CreateTable(model.DevApp{})
-		if err != nil {
-			return err
-		}
-	} else {
-		if !db.Migrator().HasColumn(&model.DevApp{}, "State") {
-			err = db.Migrator().AddColumn(&model.DevApp{}, "State")
-			if err != nil {
-				return err
-			}
-		}
-		if db.Migrator().HasColumn(&model.DevApp{}, "DevEnv") {
-			err = db.Migrator().AlterColumn(&model.DevApp{}, "DevEnv")
-			if err != nil {
-				return err
-			}
-		}
-		if !db.Migrator().HasColumn(&model.DevApp{}, "Title") {
-			err = db.Migrator().AddColumn(&model.DevApp{}, "Title")
-			if err != nil {
-				return err
-			}
-		}
-		if !db.Migrator().HasColumn(&model.DevApp{}, "Owner") {
-			err = db.Migrator().AddColumn(&model.DevApp{}, "Owner")
-			if err != nil {
-				return err
-			}
-		}
-		if !db.Migrator().HasColumn(&model.DevApp{}, "Reason") {
-			err = db.Migrator().AddColumn(&model.DevApp{}, "Reason")
-			if err != nil {
-				return err
-			}
+// SetConfig sets the database to open, it has no effect once the database is opened.
+func SetConfig(cfg Config) {
+	config = cfg
+}
+
+// Open opens the configured database and applies the pending migrations, only the first call does the work.
+func Open() error {
+	once.Do(func() {
+		var d *gorm.DB
+		d, dbErr = Connect(config)
+		if dbErr != nil {
+			return
 		}
-		if !db.Migrator().HasColumn(&model.DevApp{}, "ChartVersion") {
-			err = db.Migrator().AddColumn(&model.DevApp{}, "ChartVersion")
-			if err != nil {
-				return err
-			}
+		dbErr = MigrateUp(d, 0)
+		if dbErr == nil {
+			db = d
 		}
+	})
+	return dbErr
+}
+
+// Connect opens a database without touching its schema.
+func Connect(cfg Config) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverPostgres:
+		dialector = postgres.New(
+			postgres.Config{
+				DSN:                  cfg.DSN,
+				PreferSimpleProtocol: true,
+			})
+	case DriverSqlite:
+		dialector = sqlite.Open(cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported db driver %q", cfg.Driver)
 	}
 
-	if !db.Migrator().HasTable(model.DevContainers{}) {
-		err = db.Migrator().CreateTable(model.DevContainers{})
-		if err != nil {
-			return err
-		}
-	} else {
-		if db.Migrator().HasColumn(&model.DevContainers{}, "DevEnv") {
-			err = db.Migrator().AlterColumn(&model.DevContainers{}, "DevEnv")
-			if err != nil {
-				return err
-			}
-		}
+	d, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
 	}
-	if !db.Migrator().HasTable(model.DevAppContainers{}) {
-		err = db.Migrator().CreateTable(model.DevAppContainers{})
+	if cfg.Driver == DriverSqlite {
+		// sqlite allows one writer at a time, serialize access instead of failing with database is locked
+		sqlDB, err := d.DB()
 		if err != nil {
-			return err
-		}
-	} else {
-		if !db.Migrator().HasColumn(&model.DevAppContainers{}, "Image") {
-			err = db.Migrator().AddColumn(&model.DevAppContainers{}, "Image")
-			if err != nil {
-				return err
-			}
-		}
-		if db.Migrator().HasColumn(&model.DevAppContainers{}, "PodSelector") {
-			err = db.Migrator().AlterColumn(&model.DevAppContainers{}, "PodSelector")
-			if err != nil {
-				return err
-			}
-		}
-		if !db.Migrator().HasColumn(&model.DevAppContainers{}, "AppName") {
-			err = db.Migrator().AddColumn(&model.DevAppContainers{}, "AppName")
-			if err != nil {
-				return err
-			}
+			return nil, err
 		}
+		sqlDB.SetMaxOpenConns(1)
 	}
-	return nil
+	return d, nil
 }
 
+// NewDbOperator opens the database on first use and panics if it fails, call Open first to handle the error.
 func NewDbOperator() *DbOperator {
+	if err := Open(); err != nil {
+		panic(err)
+	}
 	return &DbOperator{DB: db}
 }
 
 func (db *DbOperator) Close() error {
-	return db.Close()
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
 }
@@ -0,0 +1,22 @@
+//go:build !cgo
+
+package db
+
+import (
+	"testing"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestOpenSqliteWithoutCgo opens sqlite the way the server image is built, run it with CGO_ENABLED=0.
+func TestOpenSqliteWithoutCgo(t *testing.T) {
+	d := openTestDB(t)
+	if err := MigrateUp(d, 0); err != nil {
+		t.Fatal(err)
+	}
+	s := NewStores(&DbOperator{DB: d})
+	assert.NoError(t, s.Apps.Create(&model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice"}))
+	assert.ErrorIs(t, s.Apps.Create(&model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice"}), ErrDuplicated)
+}
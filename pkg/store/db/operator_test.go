@@ -0,0 +1,128 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	d, err := Connect(Config{Driver: DriverSqlite, DSN: filepath.Join(t.TempDir(), "devbox.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestOpenSqlite(t *testing.T) {
+	d := openTestDB(t)
+	if err := MigrateUp(d, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []interface{}{model.DevApp{}, model.DevContainers{}, model.DevAppContainers{}, model.DevAppJob{}} {
+		assert.True(t, d.Migrator().HasTable(table))
+	}
+
+	app := &model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice"}
+	assert.NoError(t, d.Create(app).Error)
+
+	var got model.DevApp
+	assert.NoError(t, d.Where("owner = ?", "alice").Where("app_name = ?", "app").First(&got).Error)
+	assert.Equal(t, app.ID, got.ID)
+}
+
+func TestOpenUnsupportedDriver(t *testing.T) {
+	_, err := Connect(Config{Driver: "mysql"})
+	assert.Error(t, err)
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	d := openTestDB(t)
+	assert.NoError(t, MigrateUp(d, 2))
+
+	status, err := GetMigrationStatus(d)
+	assert.NoError(t, err)
+	assert.Len(t, status, len(migrations))
+	assert.NotNil(t, status[0].AppliedAt)
+	assert.NotNil(t, status[1].AppliedAt)
+	assert.Nil(t, status[2].AppliedAt)
+	assert.False(t, d.Migrator().HasTable(model.DevAppContainers{}))
+
+	assert.NoError(t, MigrateUp(d, 0))
+	// running it again is a no-op
+	assert.NoError(t, MigrateUp(d, 0))
+	assert.True(t, d.Migrator().HasTable(model.DevAppJob{}))
+
+	// roll back to version 3
+	assert.NoError(t, MigrateDown(d, len(migrations)-3))
+	assert.False(t, d.Migrator().HasTable(model.DevAppJob{}))
+	assert.True(t, d.Migrator().HasTable(model.DevAppContainers{}))
+
+	status, err = GetMigrationStatus(d)
+	assert.NoError(t, err)
+	assert.NotNil(t, status[2].AppliedAt)
+	assert.Nil(t, status[3].AppliedAt)
+	assert.Nil(t, status[len(status)-1].AppliedAt)
+}
+
+func TestMigrateLegacySchema(t *testing.T) {
+	d := openTestDB(t)
+	// tables created before migrations were tracked
+	assert.NoError(t, d.Migrator().CreateTable(model.DevApp{}))
+	assert.NoError(t, d.Migrator().DropColumn(&model.DevApp{}, "ChartVersion"))
+
+	assert.NoError(t, MigrateUp(d, 0))
+	assert.True(t, d.Migrator().HasColumn(&model.DevApp{}, "ChartVersion"))
+}
+
+func TestMigrateAppNameConflicts(t *testing.T) {
+	d := openTestDB(t)
+	assert.NoError(t, MigrateUp(d, 4))
+	// dev apps created before the owner scoped index existed
+	assert.NoError(t, d.Create(&devAppV1{AppName: "app", DevEnv: "default", Owner: "alice"}).Error)
+	assert.NoError(t, d.Create(&devAppV1{AppName: "app", DevEnv: "default", Owner: "alice"}).Error)
+	assert.NoError(t, d.Create(&devAppV1{AppName: "app", DevEnv: "default", Owner: "bob"}).Error)
+
+	err := MigrateUp(d, 0)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "alice/app (2)")
+		assert.NotContains(t, err.Error(), "bob/app")
+	}
+
+	assert.NoError(t, d.Where("owner = ?", "alice").Where("id > ?", 1).Delete(&devAppV1{}).Error)
+	assert.NoError(t, MigrateUp(d, 0))
+	err = d.Create(&devAppV1{AppName: "app", DevEnv: "default", Owner: "bob"}).Error
+	assert.ErrorIs(t, err, ErrDuplicated)
+}
+
+func TestMigrateUnownedContainers(t *testing.T) {
+	d := openTestDB(t)
+	assert.NoError(t, MigrateUp(d, 4))
+	app := &devAppV1{AppName: "app", DevEnv: "default", Owner: "alice"}
+	assert.NoError(t, d.Create(app).Error)
+	bound := &devContainerV2{DevEnv: "default", Name: "bound"}
+	assert.NoError(t, d.Create(bound).Error)
+	assert.NoError(t, d.Create(&devAppContainerV3{AppID: app.ID, ContainerID: bound.ID}).Error)
+	assert.NoError(t, d.Create(&devContainerV2{DevEnv: "default", Name: "unbound"}).Error)
+	assert.NoError(t, d.Create(&devAppV1{AppName: "other", DevEnv: "default", Owner: "bob"}).Error)
+
+	// with apps of two owners an unbound container can not be given one
+	err := MigrateUp(d, 0)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unbound (2)")
+		assert.NotContains(t, err.Error(), "bound (1)")
+	}
+
+	assert.NoError(t, d.Where("owner = ?", "bob").Delete(&devAppV1{}).Error)
+	assert.NoError(t, MigrateUp(d, 0))
+	var containers []model.DevContainers
+	assert.NoError(t, d.Order("id").Find(&containers).Error)
+	if assert.Len(t, containers, 2) {
+		assert.Equal(t, "alice", containers[0].Owner)
+		assert.Equal(t, "alice", containers[1].Owner)
+	}
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is returned by the stores when a record does not exist.
+	ErrNotFound = gorm.ErrRecordNotFound
+	// ErrDuplicated is returned by the stores when a record breaks a unique index.
+	ErrDuplicated = gorm.ErrDuplicatedKey
+)
+
+// All lookups of apps and dev containers are scoped to an owner, app names are
+// only unique per owner.
+
+type DevAppStore interface {
+	List(owner string) ([]*model.DevApp, error)
+	Get(owner, name string) (*model.DevApp, error)
+	GetByTitle(owner, title string) (*model.DevApp, error)
+	// ListShared returns the apps of other owners the user is a collaborator of.
+	ListShared(username string) ([]*model.DevApp, error)
+	// ListInStates returns the apps of all owners in one of the states.
+	ListInStates(states ...string) ([]*model.DevApp, error)
+	Create(app *model.DevApp) error
+	// Update sets the columns in updates of the app and returns the updated app.
+	Update(owner, name string, updates map[string]interface{}) (*model.DevApp, error)
+	Delete(id uint) error
+	DeleteByName(owner, name string) error
+}
+
+type DevContainerStore interface {
+	Get(id uint) (*model.DevContainers, error)
+	GetByName(owner, name string) (*model.DevContainers, error)
+	Create(c *model.DevContainers) error
+	Rename(owner, name, newName string) error
+	DeleteByName(owner, name string) error
+
+	ListAppContainers(appID uint) ([]*model.DevAppContainers, error)
+	GetAppContainer(appID uint, containerName string) (*model.DevAppContainers, error)
+	// GetBinding returns the app container the dev container is bound to.
+	GetBinding(containerID uint) (*model.DevAppContainers, error)
+	CreateAppContainer(c *model.DevAppContainers) error
+	DeleteAppContainer(c *model.DevAppContainers) error
+	DeleteAppContainers(appID uint) error
+	// ListContainerInfo returns the dev containers bound to the app with their binding.
+	ListContainerInfo(owner, appName string) ([]*model.DevContainerInfo, error)
+}
+
+type DevAppJobStore interface {
+	Create(job *model.DevAppJob) error
+	Save(job *model.DevAppJob) error
+	Get(owner, jobID string) (*model.DevAppJob, error)
+	List(owner, appName string, limit int) ([]*model.DevAppJob, error)
+	// UpdateStates moves the jobs in one of the from states to state.
+	UpdateStates(from []string, state, reason string) error
+}
+
+type DevAppCollaboratorStore interface {
+	List(appID uint) ([]*model.DevAppCollaborator, error)
+	Get(appID uint, username string) (*model.DevAppCollaborator, error)
+	// Save creates the collaborator or updates the role of an existing one.
+	Save(c *model.DevAppCollaborator) error
+	Delete(appID uint, username string) error
+	DeleteAll(appID uint) error
+}
+
+// AuditQuery selects the audit logs a user may read, the ones of the user's apps
+// and the ones the user is the actor of.
+type AuditQuery struct {
+	Username string
+	AppName  string
+	Action   string
+	Offset   int
+	Limit    int
+}
+
+// AuditStore is append-only, there is no way to change or remove a log.
+type AuditStore interface {
+	Append(entry *model.AuditLog) error
+	// List returns a page of the matching logs, newest first, and the number of all matching logs.
+	List(q AuditQuery) ([]*model.AuditLog, int64, error)
+}
+
+type Stores struct {
+	Apps          DevAppStore
+	Containers    DevContainerStore
+	Jobs          DevAppJobStore
+	Collaborators DevAppCollaboratorStore
+	Audit         AuditStore
+}
+
+func NewStores(op *DbOperator) *Stores {
+	return &Stores{
+		Apps:          &devAppStore{db: op.DB},
+		Containers:    &devContainerStore{db: op.DB},
+		Jobs:          &devAppJobStore{db: op.DB},
+		Collaborators: &devAppCollaboratorStore{db: op.DB},
+		Audit:         &auditStore{db: op.DB},
+	}
+}
+
+var (
+	storesMu sync.Mutex
+	stores   *Stores
+)
+
+// DefaultStores returns the stores used outside of the api server, backed by the
+// opened database unless SetStores replaced them.
+func DefaultStores() *Stores {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if stores == nil {
+		stores = NewStores(NewDbOperator())
+	}
+	return stores
+}
+
+func SetStores(s *Stores) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	stores = s
+}
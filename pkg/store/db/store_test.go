@@ -0,0 +1,207 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStores(t *testing.T) map[string]*Stores {
+	d := openTestDB(t)
+	if err := MigrateUp(d, 0); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]*Stores{
+		"sqlite": NewStores(&DbOperator{DB: d}),
+		"memory": NewMemoryStores(),
+	}
+}
+
+func TestDevAppStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			app := &model.DevApp{AppName: "app", Title: "App", DevEnv: "default", Owner: "alice"}
+			assert.NoError(t, s.Apps.Create(app))
+			assert.NotZero(t, app.ID)
+			assert.NoError(t, s.Apps.Create(&model.DevApp{AppName: "other", DevEnv: "default", Owner: "bob"}))
+
+			list, err := s.Apps.List("alice")
+			assert.NoError(t, err)
+			assert.Len(t, list, 1)
+
+			_, err = s.Apps.Get("bob", "app")
+			assert.True(t, errors.Is(err, ErrNotFound))
+
+			got, err := s.Apps.GetByTitle("alice", "App")
+			assert.NoError(t, err)
+			assert.Equal(t, app.ID, got.ID)
+
+			updated, err := s.Apps.Update("alice", "app", map[string]interface{}{"state": "deploying", "reason": "deploying"})
+			assert.NoError(t, err)
+			assert.Equal(t, app.ID, updated.ID)
+			got, err = s.Apps.Get("alice", "app")
+			assert.NoError(t, err)
+			assert.Equal(t, "deploying", got.State)
+
+			list, err = s.Apps.ListInStates("deploying", "running")
+			assert.NoError(t, err)
+			if assert.Len(t, list, 1) {
+				assert.Equal(t, app.ID, list[0].ID)
+			}
+
+			// a name that would break a string built query is just a value
+			_, err = s.Apps.Get("alice", "app' or '1'='1")
+			assert.True(t, errors.Is(err, ErrNotFound))
+
+			// app names are unique per owner only
+			err = s.Apps.Create(&model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice"})
+			assert.True(t, errors.Is(err, ErrDuplicated))
+			assert.NoError(t, s.Apps.Create(&model.DevApp{AppName: "app", DevEnv: "default", Owner: "bob"}))
+
+			assert.NoError(t, s.Apps.Delete(app.ID))
+			_, err = s.Apps.Get("alice", "app")
+			assert.True(t, errors.Is(err, ErrNotFound))
+		})
+	}
+}
+
+func TestDevContainerStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			app := &model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice"}
+			assert.NoError(t, s.Apps.Create(app))
+			dc := &model.DevContainers{Name: "app", DevEnv: "go", Owner: "alice"}
+			assert.NoError(t, s.Containers.Create(dc))
+			ac := &model.DevAppContainers{AppID: app.ID, AppName: "app", ContainerID: dc.ID, PodSelector: "app=app", ContainerName: "main", Image: "nginx"}
+			assert.NoError(t, s.Containers.CreateAppContainer(ac))
+
+			bound, err := s.Containers.GetBinding(dc.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "main", bound.ContainerName)
+
+			_, err = s.Containers.GetAppContainer(app.ID, "sidecar")
+			assert.True(t, errors.Is(err, ErrNotFound))
+
+			infos, err := s.Containers.ListContainerInfo("alice", "app")
+			assert.NoError(t, err)
+			if assert.Len(t, infos, 1) {
+				assert.Equal(t, "go", infos[0].DevEnv)
+				assert.Equal(t, "nginx", *infos[0].Image)
+				assert.Equal(t, "app=app", *infos[0].PodSelector)
+			}
+			infos, err = s.Containers.ListContainerInfo("alice", "app' or '1'='1")
+			assert.NoError(t, err)
+			assert.Len(t, infos, 0)
+			infos, err = s.Containers.ListContainerInfo("bob", "app")
+			assert.NoError(t, err)
+			assert.Len(t, infos, 0)
+
+			assert.NoError(t, s.Containers.Rename("bob", "app", "renamed"))
+			_, err = s.Containers.GetByName("alice", "app")
+			assert.NoError(t, err)
+			assert.NoError(t, s.Containers.Rename("alice", "app", "renamed"))
+			got, err := s.Containers.Get(dc.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "renamed", got.Name)
+
+			assert.NoError(t, s.Containers.DeleteAppContainer(ac))
+			list, err := s.Containers.ListAppContainers(app.ID)
+			assert.NoError(t, err)
+			assert.Len(t, list, 0)
+		})
+	}
+}
+
+func TestDevAppJobStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			job := &model.DevAppJob{JobID: "1", AppName: "app", Owner: "alice", State: "running",
+				Steps: []model.DevJobStep{{Name: "lint", State: "running"}}}
+			assert.NoError(t, s.Jobs.Create(job))
+			job.Steps[0].State = "succeeded"
+			assert.NoError(t, s.Jobs.Save(job))
+
+			got, err := s.Jobs.Get("alice", "1")
+			assert.NoError(t, err)
+			assert.Equal(t, "succeeded", got.Steps[0].State)
+
+			assert.NoError(t, s.Jobs.UpdateStates([]string{"pending", "running"}, "failed", "interrupted"))
+			list, err := s.Jobs.List("alice", "app", 10)
+			assert.NoError(t, err)
+			if assert.Len(t, list, 1) {
+				assert.Equal(t, "failed", list[0].State)
+			}
+		})
+	}
+}
+
+func TestDevAppCollaboratorStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			app := &model.DevApp{AppName: "app", DevEnv: "default", Owner: "alice"}
+			assert.NoError(t, s.Apps.Create(app))
+			assert.NoError(t, s.Apps.Create(&model.DevApp{AppName: "mine", DevEnv: "default", Owner: "bob"}))
+
+			assert.NoError(t, s.Collaborators.Save(&model.DevAppCollaborator{AppID: app.ID, Username: "bob", Role: "viewer"}))
+			assert.NoError(t, s.Collaborators.Save(&model.DevAppCollaborator{AppID: app.ID, Username: "bob", Role: "editor"}))
+			list, err := s.Collaborators.List(app.ID)
+			assert.NoError(t, err)
+			if assert.Len(t, list, 1) {
+				assert.Equal(t, "editor", list[0].Role)
+			}
+
+			shared, err := s.Apps.ListShared("bob")
+			assert.NoError(t, err)
+			if assert.Len(t, shared, 1) {
+				assert.Equal(t, "alice", shared[0].Owner)
+			}
+
+			assert.NoError(t, s.Collaborators.Delete(app.ID, "bob"))
+			_, err = s.Collaborators.Get(app.ID, "bob")
+			assert.True(t, errors.Is(err, ErrNotFound))
+			shared, err = s.Apps.ListShared("bob")
+			assert.NoError(t, err)
+			assert.Len(t, shared, 0)
+		})
+	}
+}
+
+func TestAuditStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, e := range []model.AuditLog{
+				{Actor: "alice", Owner: "alice", AppName: "app", Action: "install"},
+				{Actor: "bob", Owner: "alice", AppName: "app", Action: "file.save", Params: map[string]interface{}{"path": "app/values.yaml"}},
+				{Actor: "alice", Owner: "alice", AppName: "other", Action: "delete"},
+				{Actor: "bob", Owner: "bob", AppName: "mine", Action: "install"},
+			} {
+				e := e
+				e.Outcome = "succeeded"
+				assert.NoError(t, s.Audit.Append(&e), i)
+			}
+
+			list, total, err := s.Audit.List(AuditQuery{Username: "alice", Limit: 2})
+			assert.NoError(t, err)
+			assert.EqualValues(t, 3, total)
+			if assert.Len(t, list, 2) {
+				assert.Equal(t, "delete", list[0].Action)
+				assert.Equal(t, "app/values.yaml", list[1].Params["path"])
+			}
+			list, _, err = s.Audit.List(AuditQuery{Username: "alice", Offset: 2, Limit: 2})
+			assert.NoError(t, err)
+			assert.Len(t, list, 1)
+
+			// bob sees the operations done on alice's app and on the own apps
+			list, total, err = s.Audit.List(AuditQuery{Username: "bob", Action: "install", Limit: 10})
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, total)
+			assert.Len(t, list, 1)
+			_, total, err = s.Audit.List(AuditQuery{Username: "bob", AppName: "app", Limit: 10})
+			assert.NoError(t, err)
+			assert.EqualValues(t, 1, total)
+		})
+	}
+}
@@ -22,7 +22,6 @@ import (
 
 	"github.com/containerd/containerd/reference/docker"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 	admissionv1 "k8s.io/api/admission/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -75,16 +74,15 @@ func (wh *Webhook) MutateAppName(ctx context.Context, req *admissionv1.Admission
 // check the deployment is the app main workload or not
 // just the app main workload must to be mutated
 func (wh *Webhook) mustMutateApp(ctx context.Context, releaseName, owner string) (bool, error) {
-	var devApps []*model.DevApp
-	if err := wh.DB.DB.Where("owner = ?", owner).Where("app_name = ?", appName(releaseName)).Find(&devApps).Error; err != nil {
+	_, err := wh.Store.Apps.Get(owner, appName(releaseName))
+	if errors.Is(err, db.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return false, err
 	}
 
-	if len(devApps) == 0 {
-		return false, nil
-	}
-
 	return true, nil
 }
 
@@ -194,16 +192,15 @@ func mutateName[T workloadInterface](ctx context.Context, wh *Webhook, workload
 		}
 	}
 
-	var app *model.DevApp
-	err = wh.DB.DB.Where("owner = ?", owner).Where("app_name = ?", appName(releaseName)).First(&app).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	app, err := wh.Store.Apps.Get(owner, appName(releaseName))
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		klog.Error("exec sql error, ", err)
 		return nil, err
 	}
 
 	if err == nil {
-		containers := make([]*model.DevAppContainers, 0)
-		if err = wh.DB.DB.Where("app_id = ?", app.ID).Find(&containers).Error; err != nil {
+		containers, err := wh.Store.Containers.ListAppContainers(app.ID)
+		if err != nil {
 			klog.Error("exec sql error, ", err)
 			return nil, err
 		}
@@ -321,21 +318,19 @@ func (wh *Webhook) mustMutatePod(ctx context.Context, pod *corev1.Pod) (string,
 
 	klog.Infof("try to find release %s", releaseName)
 
-	var app *model.DevApp
-	err := wh.DB.DB.Where("owner = ?", owner).Where("app_name = ?", appName(releaseName)).First(&app).Error
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	app, err := wh.Store.Apps.Get(owner, appName(releaseName))
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
 		klog.Error("exec sql error, ", err)
 		return "", "", nil, err
 	}
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(err, db.ErrNotFound) {
 		return "", "", nil, nil
 	}
 
 	klog.Info("try to find app bind containers, ", app.ID)
 
-	containers := make([]*model.DevAppContainers, 0)
-	err = wh.DB.DB.Where("app_id = ?", app.ID).Find(&containers).Error
+	containers, err := wh.Store.Containers.ListAppContainers(app.ID)
 	if err != nil {
 		klog.Error("exec sql error, ", err)
 		return "", "", nil, err
@@ -369,14 +364,13 @@ func (wh *Webhook) mutateContainerToDevContainer(ctx context.Context, pod *corev
 		if c.Name == devcontainer.ContainerName {
 			klog.Info("mutating container, ", c.Name, ", ", pod.Name, ", ", pod.Namespace)
 			// change container image to dev image
-			var dc *model.DevContainers
-			err := wh.DB.DB.Where("id = ?", devcontainer.ContainerID).First(&dc).Error
-			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			dc, err := wh.Store.Containers.Get(devcontainer.ContainerID)
+			if err != nil && !errors.Is(err, db.ErrNotFound) {
 				klog.Error("exec sql error, ", err)
 				return nil, err
 			}
 
-			if errors.Is(err, gorm.ErrRecordNotFound) {
+			if errors.Is(err, db.ErrNotFound) {
 				klog.Error("container not found, ", devcontainer.ContainerID)
 				return nil, errors.New("container not found")
 			}
@@ -549,15 +543,17 @@ func (wh *Webhook) MutateIm(ctx context.Context, raw []byte, proxyUUID uuid.UUID
 	originAppName := strings.TrimSuffix(appName, "-dev")
 	refs, _, _ := unstructured.NestedSlice(obj.Object, "spec", "refs")
 
-	sql := `select dc.id,dc.dev_env,dc.name, dc.create_time, dc.update_time, ac.pod_selector,ac.app_id, ac.container_name,ac.image,a.app_name
-	from dev_apps a
-	join dev_app_containers ac on a.id = ac.app_id
-	join dev_containers dc on ac.container_id = dc.id
-	where a.app_name = '%s'`
-	sql = fmt.Sprintf(sql, originAppName)
-	list := make([]*model.DevContainerInfo, 0)
-	db := db.NewDbOperator()
-	err = db.DB.Raw(sql).Scan(&list).Error
+	owner, _, _ := unstructured.NestedString(obj.Object, "spec", "appOwner")
+	if owner == "" {
+		appNamespace, _, _ := unstructured.NestedString(obj.Object, "spec", "appNamespace")
+		owner, err = getOwnerFromNamespace(appNamespace)
+		if err != nil {
+			klog.Infof("can not find owner of app %s, skip mutating", appName)
+			return makePatches(raw, obj.Object, appName)
+		}
+	}
+
+	list, err := wh.Store.Containers.ListContainerInfo(owner, originAppName)
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,16 @@
 package webhook
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	"github.com/beclab/devbox/pkg/development/container"
+	"github.com/beclab/devbox/pkg/store/db"
+	"github.com/beclab/devbox/pkg/store/db/model"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -20,3 +28,33 @@ func TestLabelSelector(t *testing.T) {
 
 	t.Log("matched: ", selector.Matches(labs))
 }
+
+func TestMutateIm(t *testing.T) {
+	store := db.NewMemoryStores()
+	app := &model.DevApp{AppName: "demo", DevEnv: "default", Owner: "alice"}
+	assert.NoError(t, store.Apps.Create(app))
+	dc := &model.DevContainers{Name: "demo", DevEnv: "Golang"}
+	assert.NoError(t, store.Containers.Create(dc))
+	assert.NoError(t, store.Containers.CreateAppContainer(&model.DevAppContainers{
+		AppID: app.ID, AppName: "demo", ContainerID: dc.ID, PodSelector: "app=demo", ContainerName: "main", Image: "nginx:1.25",
+	}))
+
+	wh := &Webhook{Store: store}
+	raw := []byte(`{"apiVersion":"app.bytetrade.io/v1alpha1","kind":"ImageManager","spec":{"appName":"demo-dev","appOwner":"alice","refs":[{"name":"docker.io/library/nginx:1.25","imagePullPolicy":"IfNotPresent"}]}}`)
+	patch, err := wh.MutateIm(context.Background(), raw, uuid.New())
+	assert.NoError(t, err)
+	assert.Contains(t, string(patch), container.DevEnvImage("Golang"))
+
+	// the same app name of another owner is left alone
+	other := []byte(strings.Replace(string(raw), `"appOwner":"alice"`, `"appOwner":"bob"`, 1))
+	patch, err = wh.MutateIm(context.Background(), other, uuid.New())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(patch), container.DevEnvImage("Golang"))
+
+	ok, err := wh.mustMutateApp(context.Background(), "demo-dev", "alice")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = wh.mustMutateApp(context.Background(), "demo-dev", "bob")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -48,7 +48,7 @@ var (
 
 type Webhook struct {
 	KubeClient *kubernetes.Clientset
-	DB         *db.DbOperator
+	Store      *db.Stores
 }
 
 func (wh *Webhook) CreateOrUpdateDevContainerMutatingWebhook() error {